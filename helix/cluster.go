@@ -0,0 +1,264 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package helix provides a Go API to bootstrap, extend, inspect & reset
+// Kubernetes clusters, the same way the helix command does.
+package helix
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/ericchiang/k8s"
+	corev1 "github.com/ericchiang/k8s/apis/core/v1"
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/service/script"
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	defaultSSHUser = "pi"
+)
+
+// Cluster is a Kubernetes cluster managed by Helix.
+type Cluster struct {
+	flags    service.ServiceFlags
+	log      zerolog.Logger
+	dialSSH  util.SSHDialer
+	services []service.Service
+	registry *service.Registry
+}
+
+// Status holds the state of a cluster as seen by the Kubernetes API.
+type Status struct {
+	APIServer string       // Hostname or IP address of the apiserver
+	Nodes     []NodeStatus // Status of all configured nodes
+}
+
+// NodeStatus holds the state of a single node.
+type NodeStatus struct {
+	Name           string   // Name of the node (as configured)
+	Address        string   // IP address of the node
+	IsControlPlane bool     // Set if the node is part of the control-plane
+	Roles          []string // Roles of the node
+	Registered     bool     // Set if the node is registered in Kubernetes
+	Ready          bool     // Set if Kubernetes reports the node as ready
+	KubeletVersion string   // Version of the kubelet running on the node
+}
+
+// New creates a new cluster with given configuration.
+// By default all built-in services are used, extended with all
+// services registered in service.DefaultRegistry.
+func New(flags service.ServiceFlags, options ...Option) *Cluster {
+	c := &Cluster{
+		flags:    flags,
+		log:      zerolog.New(os.Stderr).With().Timestamp().Logger(),
+		services: DefaultServices(),
+		registry: service.DefaultRegistry,
+	}
+	if c.flags.SSH.User == "" {
+		c.flags.SSH.User = defaultSSHUser
+	}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+// Init bootstraps all services on all nodes of the cluster.
+func (c *Cluster) Init(ctx context.Context) error {
+	return c.init(ctx, c.flags)
+}
+
+// init bootstraps all services on all nodes of a cluster with given configuration.
+func (c *Cluster) init(ctx context.Context, flags service.ServiceFlags) error {
+	flags, err := c.prepareFlags(flags, true)
+	if err != nil {
+		return maskAny(err)
+	}
+	services, err := c.createServices(flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	if err := service.Run(ctx, c.newDependencies(), flags, services); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// Preflight runs all preflight checks on all nodes of the cluster,
+// without changing anything.
+// If one or more checks fail, a PreflightError is returned that lists all failures.
+func (c *Cluster) Preflight(ctx context.Context) error {
+	flags, err := c.prepareFlags(c.flags, false)
+	if err != nil {
+		return maskAny(err)
+	}
+	services, err := c.createServices(flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	if err := service.RunPreflight(ctx, c.newDependencies(), flags, services); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// Reset removes all services from all nodes of the cluster.
+// Services are reset in reverse order.
+func (c *Cluster) Reset(ctx context.Context) error {
+	flags, err := c.prepareFlags(c.flags, false)
+	if err != nil {
+		return maskAny(err)
+	}
+	services, err := c.createServices(flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	revServices := make([]service.Service, len(services))
+	for i, s := range services {
+		revServices[len(services)-(1+i)] = s
+	}
+	if err := service.Reset(ctx, c.newDependencies(), flags, revServices); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// AddNode adds a worker node with given hostname or IP address to the cluster
+// and initializes all services such that the node joins the cluster.
+// The node is only added to the configuration of the cluster when that succeeds.
+func (c *Cluster) AddNode(ctx context.Context, member string) error {
+	if member == "" {
+		return invalidArgument("member", "must not be empty")
+	}
+	for _, m := range append(c.flags.Members, c.flags.ControlPlane.Members...) {
+		if strings.EqualFold(m, member) {
+			return invalidArgument("member", "'%s' is already part of the cluster", member)
+		}
+	}
+	for _, n := range c.flags.Nodes {
+		if strings.EqualFold(n.Name, member) || strings.EqualFold(n.Address, member) {
+			return invalidArgument("member", "'%s' is already part of the cluster", member)
+		}
+	}
+	flags := c.flags
+	flags.Members = append(append([]string{}, c.flags.Members...), member)
+	if err := c.init(ctx, flags); err != nil {
+		return maskAny(err)
+	}
+	c.flags.Members = flags.Members
+	return nil
+}
+
+// Status returns the state of all nodes of the cluster, as seen by the Kubernetes API.
+func (c *Cluster) Status(ctx context.Context) (Status, error) {
+	if c.flags.LocalConfDir == "" {
+		// Needed to connect to the apiserver
+		return Status{}, invalidArgument("conf-dir", "must be set")
+	}
+	flags, err := c.prepareFlags(c.flags, false)
+	if err != nil {
+		return Status{}, maskAny(err)
+	}
+	client, sctx, err := c.newKubernetesClient(flags)
+	if err != nil {
+		return Status{}, maskAny(err)
+	}
+	var list corev1.NodeList
+	if err := client.List(ctx, k8s.AllNamespaces, &list); err != nil {
+		return Status{}, maskAny(err)
+	}
+
+	result := Status{
+		APIServer: sctx.GetAPIServer(),
+	}
+	for _, n := range sctx.Nodes() {
+		ns := NodeStatus{
+			Name:           n.Name,
+			Address:        n.Address,
+			IsControlPlane: n.IsControlPlane,
+			Roles:          n.GetRoles(),
+		}
+		if kn := findKubernetesNode(list.GetItems(), n); kn != nil {
+			ns.Registered = true
+			ns.KubeletVersion = kn.GetStatus().GetNodeInfo().GetKubeletVersion()
+			for _, cond := range kn.GetStatus().GetConditions() {
+				if cond.GetType() == "Ready" {
+					ns.Ready = cond.GetStatus() == "True"
+				}
+			}
+		}
+		result.Nodes = append(result.Nodes, ns)
+	}
+	return result, nil
+}
+
+// prepareFlags validates the given configuration of the cluster and
+// returns a copy of it, filled with default values.
+func (c *Cluster) prepareFlags(flags service.ServiceFlags, isSetup bool) (service.ServiceFlags, error) {
+	if isSetup && flags.LocalConfDir == "" {
+		return flags, invalidArgument("conf-dir", "must be set")
+	}
+	if len(flags.Members) == 0 && len(flags.Nodes) == 0 {
+		return flags, invalidArgument("members", "must be set (or specify nodes)")
+	}
+	if err := flags.SetupDefaults(c.log, isSetup); err != nil {
+		return flags, invalidArgument("flags", "%v", err)
+	}
+	return flags, nil
+}
+
+// createServices returns the ordered list of all services of the cluster,
+// including registered services & scripts configured in the given flags.
+func (c *Cluster) createServices(flags service.ServiceFlags) ([]service.Service, error) {
+	r := c.registry.Clone()
+	for _, x := range flags.Scripts {
+		if err := r.Register(script.NewService(x), x.DependsOn...); err != nil {
+			return nil, invalidArgument("scripts", "%v", err)
+		}
+	}
+	services, err := r.Merge(c.services)
+	if err != nil {
+		return nil, invalidArgument("services", "%v", err)
+	}
+	return services, nil
+}
+
+// newDependencies creates the dependencies passed to all services.
+func (c *Cluster) newDependencies() service.ServiceDependencies {
+	return service.ServiceDependencies{
+		Logger:  c.log,
+		DialSSH: c.dialSSH,
+	}
+}
+
+// findKubernetesNode returns the Kubernetes node that matches the given node
+// by name or address, or nil if not found.
+func findKubernetesNode(items []*corev1.Node, n service.Node) *corev1.Node {
+	for _, kn := range items {
+		if strings.EqualFold(kn.GetMetadata().GetName(), n.Name) {
+			return kn
+		}
+		for _, addr := range kn.GetStatus().GetAddresses() {
+			if addr.GetAddress() == n.Address {
+				return kn
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helix
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+// InvalidArgumentError is the cause of errors returned when the
+// configuration of a cluster is invalid.
+type InvalidArgumentError struct {
+	Argument string // Name of the invalid argument
+	Reason   string // Description of the problem
+}
+
+// Error implements the error interface.
+func (e *InvalidArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument %s: %s", e.Argument, e.Reason)
+}
+
+// ServiceError is the cause of errors returned when a step of a service fails.
+type ServiceError = service.ServiceError
+
+// PreflightError is the cause of errors returned when one or more preflight checks failed.
+type PreflightError = service.PreflightError
+
+// IsInvalidArgument returns true if the given error is or is caused by an InvalidArgumentError.
+func IsInvalidArgument(err error) bool {
+	_, ok := errors.Cause(err).(*InvalidArgumentError)
+	return ok
+}
+
+// AsServiceError returns the ServiceError that caused the given error.
+// Returns false if the given error is not caused by a ServiceError.
+func AsServiceError(err error) (*ServiceError, bool) {
+	serr, ok := errors.Cause(err).(*ServiceError)
+	return serr, ok
+}
+
+// AsPreflightError returns the PreflightError that caused the given error.
+// Returns false if the given error is not caused by a PreflightError.
+func AsPreflightError(err error) (*PreflightError, bool) {
+	perr, ok := errors.Cause(err).(*PreflightError)
+	return perr, ok
+}
+
+// invalidArgument returns a new InvalidArgumentError.
+func invalidArgument(argument, format string, args ...interface{}) error {
+	return maskAny(&InvalidArgumentError{
+		Argument: argument,
+		Reason:   fmt.Sprintf(format, args...),
+	})
+}
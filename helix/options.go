@@ -0,0 +1,72 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helix
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+// Option is a functional option used to configure a Cluster.
+type Option func(*Cluster)
+
+// WithLogger sets the logger used by the cluster and all its services.
+func WithLogger(log zerolog.Logger) Option {
+	return func(c *Cluster) {
+		c.log = log
+	}
+}
+
+// WithSSHUser sets the user name used to login on all machines.
+func WithSSHUser(userName string) Option {
+	return func(c *Cluster) {
+		c.flags.SSH.User = userName
+	}
+}
+
+// WithSSHDialer sets the function used to connect to machines.
+// By default util.DialSSH is used.
+func WithSSHDialer(dialer util.SSHDialer) Option {
+	return func(c *Cluster) {
+		c.dialSSH = dialer
+	}
+}
+
+// WithServices replaces the list of services used by the cluster.
+// The services are initialized in the given order and reset in reverse order.
+func WithServices(services ...service.Service) Option {
+	return func(c *Cluster) {
+		c.services = services
+	}
+}
+
+// WithAdditionalServices appends the given services to the
+// list of services used by the cluster.
+func WithAdditionalServices(services ...service.Service) Option {
+	return func(c *Cluster) {
+		c.services = append(c.services, services...)
+	}
+}
+
+// WithRegistry sets the registry containing custom services that are
+// run alongside the built-in services.
+// By default service.DefaultRegistry is used.
+func WithRegistry(registry *service.Registry) Option {
+	return func(c *Cluster) {
+		c.registry = registry
+	}
+}
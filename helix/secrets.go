@@ -0,0 +1,209 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helix
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ericchiang/k8s"
+	corev1 "github.com/ericchiang/k8s/apis/core/v1"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/service/kubernetes/apiserver"
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	apiserverWaitTimeout = time.Minute * 5
+)
+
+// RotateEncryptionKey replaces the key used to encrypt secrets at rest by a new key
+// and rewrites all secrets, such that they are encrypted with the new key.
+// The new key is rolled out in stages, such that every apiserver can read all
+// secrets at all times:
+// 1. All apiservers can decrypt using the new key.
+// 2. All apiservers encrypt using the new key.
+// 3. All secrets are rewritten.
+// 4. The old keys are removed.
+func (c *Cluster) RotateEncryptionKey(ctx context.Context) error {
+	flags, err := c.prepareFlags(c.flags, true)
+	if err != nil {
+		return maskAny(err)
+	}
+	if flags.DryRun {
+		return invalidArgument("dry-run", "not supported when rotating the encryption key")
+	}
+	if !flags.Encryption.IsEnabled() {
+		return invalidArgument("encryption", "provider %s does not encrypt secrets", flags.Encryption.Provider)
+	}
+	keysPath := service.EncryptionKeysPath(flags.LocalConfDir)
+	keys, err := util.LoadEncryptionKeys(keysPath)
+	if err != nil {
+		return maskAny(err)
+	}
+	if len(keys) == 0 {
+		return invalidArgument("conf-dir", "contains no encryption keys, initialize the cluster first")
+	}
+	newKey, err := keys.NewKey(flags.Encryption.Provider)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Allow all apiservers to decrypt using the new key
+	c.log.Info().Msgf("Adding encryption key %s", newKey.Name)
+	if err := c.applyEncryptionKeys(ctx, flags, append(append(util.EncryptionKeys{}, keys...), newKey)); err != nil {
+		return maskAny(err)
+	}
+
+	// Encrypt using the new key
+	c.log.Info().Msgf("Encrypting with key %s", newKey.Name)
+	if err := c.applyEncryptionKeys(ctx, flags, append(util.EncryptionKeys{newKey}, keys...)); err != nil {
+		return maskAny(err)
+	}
+
+	// Rewrite all secrets
+	if err := c.rewriteSecrets(ctx, flags); err != nil {
+		return maskAny(err)
+	}
+
+	// Remove old keys
+	c.log.Info().Msg("Removing old encryption keys")
+	if err := c.applyEncryptionKeys(ctx, flags, util.EncryptionKeys{newKey}); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// applyEncryptionKeys saves the given keys, updates all apiservers & waits
+// until they all use the new encryption configuration.
+func (c *Cluster) applyEncryptionKeys(ctx context.Context, flags service.ServiceFlags, keys util.EncryptionKeys) error {
+	if err := keys.Save(service.EncryptionKeysPath(flags.LocalConfDir)); err != nil {
+		return maskAny(err)
+	}
+	// The cluster is running, so preflight checks would only report the running apiservers
+	flags.Preflight.Skip = true
+	if err := service.Run(ctx, c.newDependencies(), flags, []service.Service{apiserver.NewService()}); err != nil {
+		return maskAny(err)
+	}
+	hash := service.EncryptionConfigHash(flags.Encryption.CreateEncryptionConfig(flags.Kubernetes.Version, keys))
+	if err := c.waitForAPIServers(ctx, flags, hash); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// waitForAPIServers waits until the apiservers on all control-plane nodes
+// are ready & use the encryption configuration with given hash.
+func (c *Cluster) waitForAPIServers(ctx context.Context, flags service.ServiceFlags, hash string) error {
+	client, sctx, err := c.newKubernetesClient(flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	expected := 0
+	for _, n := range sctx.Nodes() {
+		if n.IsControlPlane {
+			expected++
+		}
+	}
+	c.log.Info().Msg("Waiting for apiservers to restart")
+	ctx, cancel := context.WithTimeout(ctx, apiserverWaitTimeout)
+	defer cancel()
+	for {
+		op := func() error {
+			lctx, cancel := context.WithTimeout(ctx, time.Second*15)
+			defer cancel()
+			selector := new(k8s.LabelSelector)
+			selector.Eq("component", "kube-apiserver")
+			var pods corev1.PodList
+			if err := client.List(lctx, "kube-system", &pods, selector.Selector()); err != nil {
+				return maskAny(err)
+			}
+			ready := 0
+			for _, p := range pods.GetItems() {
+				if p.GetMetadata().GetAnnotations()[apiserver.EncryptionConfigHashAnnotation] != hash {
+					continue
+				}
+				for _, cond := range p.GetStatus().GetConditions() {
+					if cond.GetType() == "Ready" && cond.GetStatus() == "True" {
+						ready++
+					}
+				}
+			}
+			if ready < expected {
+				return maskAny(fmt.Errorf("%d of %d apiservers ready", ready, expected))
+			}
+			return nil
+		}
+		err := op()
+		if err == nil {
+			break
+		}
+		select {
+		case <-time.After(time.Second * 5):
+			// Retry
+		case <-ctx.Done():
+			return maskAny(fmt.Errorf("Apiservers did not restart in time: %v", err))
+		}
+	}
+	return nil
+}
+
+// rewriteSecrets updates all secrets without changing them, such that
+// the apiserver stores them encrypted with the current encryption key.
+func (c *Cluster) rewriteSecrets(ctx context.Context, flags service.ServiceFlags) error {
+	client, _, err := c.newKubernetesClient(flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	var secrets corev1.SecretList
+	if err := client.List(ctx, k8s.AllNamespaces, &secrets); err != nil {
+		return maskAny(err)
+	}
+	c.log.Info().Msgf("Rewriting %d secrets", len(secrets.GetItems()))
+	for _, s := range secrets.GetItems() {
+		if err := client.Update(ctx, s); err != nil {
+			if util.IsK8sConflict(err) || util.IsK8sNotFound(err) {
+				// Secret has been changed (and therefore rewritten) or removed in the meantime
+				continue
+			}
+			return maskAny(fmt.Errorf("Failed to rewrite secret %s/%s: %v", s.GetMetadata().GetNamespace(), s.GetMetadata().GetName(), err))
+		}
+	}
+	return nil
+}
+
+// newKubernetesClient creates a client for the Kubernetes API of the cluster,
+// using the certificates in the local conf dir.
+func (c *Cluster) newKubernetesClient(flags service.ServiceFlags) (*k8s.Client, *service.ServiceContext, error) {
+	if _, err := os.Stat(flags.LocalConfDir); err != nil {
+		return nil, nil, invalidArgument("conf-dir", "%v", err)
+	}
+	deps := c.newDependencies()
+	if err := deps.LoadCertificates(flags.LocalConfDir); err != nil {
+		return nil, nil, maskAny(err)
+	}
+	sctx, err := service.NewServiceContext(c.log, flags, false)
+	if err != nil {
+		return nil, nil, maskAny(err)
+	}
+	client, err := service.NewKubernetesClient(sctx, deps, flags)
+	if err != nil {
+		return nil, nil, maskAny(err)
+	}
+	return client, sctx, nil
+}
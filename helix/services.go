@@ -0,0 +1,70 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helix
+
+import (
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/service/architecture"
+	"github.com/pulcy/helix/service/containerd"
+	"github.com/pulcy/helix/service/etcd"
+	"github.com/pulcy/helix/service/kubernetes/apiserver"
+	"github.com/pulcy/helix/service/kubernetes/ca"
+	"github.com/pulcy/helix/service/kubernetes/cni"
+	"github.com/pulcy/helix/service/kubernetes/controllermanager"
+	"github.com/pulcy/helix/service/kubernetes/controlplane"
+	"github.com/pulcy/helix/service/kubernetes/coredns"
+	"github.com/pulcy/helix/service/kubernetes/hyperkube"
+	"github.com/pulcy/helix/service/kubernetes/keepalived"
+	"github.com/pulcy/helix/service/kubernetes/kubelet"
+	"github.com/pulcy/helix/service/kubernetes/kubeletauth"
+	"github.com/pulcy/helix/service/kubernetes/loadbalancer"
+	"github.com/pulcy/helix/service/kubernetes/network"
+	"github.com/pulcy/helix/service/kubernetes/nodelabels"
+	"github.com/pulcy/helix/service/kubernetes/proxy"
+	"github.com/pulcy/helix/service/kubernetes/scheduler"
+	"github.com/pulcy/helix/service/nodeprep"
+)
+
+// DefaultServices returns a new instance of all built-in services,
+// in the order in which they must be initialized.
+func DefaultServices() []service.Service {
+	bootstrapServices := []service.Service{
+		// The order of entries is relevant!
+		architecture.NewService(),
+		nodeprep.NewService(),
+		containerd.NewService(),
+		cni.NewService(),
+		hyperkube.NewService(),
+		keepalived.NewService(),
+		loadbalancer.NewService(),
+		ca.NewService(),
+		kubelet.NewService(),
+		etcd.NewService(),
+		apiserver.NewService(),
+		scheduler.NewService(),
+		controllermanager.NewService(),
+	}
+	k8sServices := []service.Service{
+		// The order of entries is relevant!
+		architecture.NewService(),
+		controlplane.NewService(),
+		kubeletauth.NewService(),
+		nodelabels.NewService(),
+		proxy.NewService(),
+		network.NewService(),
+		coredns.NewService(),
+	}
+	return append(bootstrapServices, k8sServices...)
+}
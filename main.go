@@ -15,10 +15,15 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
+
+	"github.com/pulcy/helix/helix"
 )
 
 var (
@@ -53,8 +58,30 @@ func Exitf(format string, args ...interface{}) {
 	os.Exit(1)
 }
 
-func assertArgIsSet(arg, argKey string) {
-	if arg == "" {
-		Exitf("%s must be set\n", argKey)
+// exitOnError logs the given error and terminates the process.
+func exitOnError(msg string, err error) {
+	if _, isPreflight := helix.AsPreflightError(err); isPreflight || helix.IsInvalidArgument(err) {
+		Exitf("%s: %v\n", msg, err)
 	}
+	Exitf("%s: %#v\n", msg, err)
+}
+
+// interruptContext returns a context that is cancelled when the process
+// receives an interrupt or termination signal.
+// A second signal terminates the process immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigChan:
+			cliLog.Warn().Msgf("Received %s, cancelling...", sig)
+			cancel()
+		case <-ctx.Done():
+			// Normal completion
+		}
+		signal.Stop(sigChan)
+	}()
+	return ctx, cancel
 }
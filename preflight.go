@@ -0,0 +1,60 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/pulcy/helix/helix"
+	"github.com/pulcy/helix/service"
+)
+
+var (
+	cmdPreflight = &cobra.Command{
+		Use:   "preflight",
+		Short: "Check all nodes of the cluster without changing anything",
+		Run:   runPreflight,
+	}
+	preflightFlags = service.ServiceFlags{}
+)
+
+func init() {
+	f := cmdPreflight.Flags()
+	// General
+	f.StringVar(&specPath, "spec", "", "Path of cluster specification file (JSON)")
+	f.StringSliceVarP(&preflightFlags.Members, "members", "m", nil, "IP addresses (or hostnames) of normal machines (may include control-plane members)")
+	f.StringVar(&preflightFlags.SSH.User, "ssh-user", "pi", "SSH user on all machines")
+	f.StringVar(&preflightFlags.ContainerRuntime.Name, "container-runtime", "", "Container runtime used on all machines (docker|containerd)")
+	// Control plane
+	f.StringVar(&preflightFlags.ControlPlane.APIServerVirtualIP, "apiserver-virtual-ip", "", "Virtual IP address of apiserver")
+	f.StringVar(&preflightFlags.ControlPlane.APIServerDNSName, "apiserver-dns-name", "", "DNS name of apiserver")
+	f.StringSliceVar(&preflightFlags.ControlPlane.Members, "control-plane-members", nil, "IP addresses (or hostnames) of control-plane members")
+	// Preflight
+	f.StringSliceVar(&preflightFlags.Preflight.IgnoreChecks, "ignore-preflight-checks", nil, "Names of preflight checks whose failures are ignored")
+
+	cmdMain.AddCommand(cmdPreflight)
+}
+
+func runPreflight(cmd *cobra.Command, args []string) {
+	loadSpec(cmd, &preflightFlags)
+	c := helix.New(preflightFlags, helix.WithLogger(cliLog))
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if err := c.Preflight(ctx); err != nil {
+		exitOnError("Preflight failed", err)
+	}
+	cliLog.Info().Msg("Done")
+}
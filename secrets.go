@@ -0,0 +1,70 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/pulcy/helix/helix"
+	"github.com/pulcy/helix/service"
+)
+
+var (
+	cmdSecrets = &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage encryption of secrets at rest",
+		Run:   showUsage,
+	}
+	cmdSecretsRotateKey = &cobra.Command{
+		Use:   "rotate-key",
+		Short: "Encrypt all secrets with a new encryption key",
+		Run:   runSecretsRotateKey,
+	}
+	rotateKeyFlags = service.ServiceFlags{}
+)
+
+func init() {
+	f := cmdSecretsRotateKey.Flags()
+	// General
+	f.StringVarP(&rotateKeyFlags.LocalConfDir, "conf-dir", "c", "", "Local directory containing cluster configuration")
+	f.StringVar(&specPath, "spec", "", "Path of cluster specification file (JSON)")
+	f.StringSliceVarP(&rotateKeyFlags.Members, "members", "m", nil, "IP addresses (or hostnames) of normal machines (may include control-plane members)")
+	f.StringVar(&rotateKeyFlags.SSH.User, "ssh-user", "pi", "SSH user on all machines")
+	// Timeouts
+	f.DurationVar(&rotateKeyFlags.Timeouts.Default, "timeout", 0, "Maximum duration of each service step (0 means no timeout)")
+	// Control plane
+	f.StringVar(&rotateKeyFlags.ControlPlane.APIServerVirtualIP, "apiserver-virtual-ip", "", "Virtual IP address of apiserver")
+	f.StringVar(&rotateKeyFlags.ControlPlane.APIServerDNSName, "apiserver-dns-name", "", "DNS name of apiserver")
+	f.StringSliceVar(&rotateKeyFlags.ControlPlane.Members, "control-plane-members", nil, "IP addresses (or hostnames) of control-plane members")
+	// Encryption
+	f.StringVar(&rotateKeyFlags.Encryption.Provider, "encryption-provider", "", "Provider of the new encryption key (aescbc|secretbox)")
+
+	cmdSecrets.AddCommand(cmdSecretsRotateKey)
+	cmdMain.AddCommand(cmdSecrets)
+}
+
+func runSecretsRotateKey(cmd *cobra.Command, args []string) {
+	showVersion(cmd, args)
+	loadSpec(cmd, &rotateKeyFlags)
+
+	c := helix.New(rotateKeyFlags, helix.WithLogger(cliLog))
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if err := c.RotateEncryptionKey(ctx); err != nil {
+		exitOnError("Rotating encryption key failed", err)
+	}
+	cliLog.Info().Msg("Done")
+}
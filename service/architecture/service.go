@@ -15,6 +15,7 @@
 package architecture
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -33,36 +34,76 @@ func NewService() service.Service {
 }
 
 type archService struct {
+	willInit bool
 }
 
+var (
+	// Maps output of `uname -m` to architecture names
+	machineArchitectures = map[string]string{
+		"x86_64":  "amd64",
+		"amd64":   "amd64",
+		"armv6l":  "armv6",
+		"armv7l":  "arm",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"ppc64le": "ppc64le",
+		"s390x":   "s390x",
+	}
+	// Maps output of `dpkg --print-architecture` to architecture names
+	dpkgArchitectures = map[string]string{
+		"amd64":   "amd64",
+		"armel":   "armv6",
+		"armhf":   "arm",
+		"arm64":   "arm64",
+		"ppc64el": "ppc64le",
+		"s390x":   "s390x",
+	}
+)
+
 func (t *archService) Name() string {
 	return "architecture"
 }
 
-func (t *archService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *archService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	t.willInit = willInit
 	return nil
 }
 
-// InitNode detects the architecture of the node.
-func (t *archService) InitNode(node *service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+// InitNode detects the architecture of the node and verifies
+// that images are available for the components that run on it.
+// This cannot be done in Prepare, since architectures are not known before they are detected.
+func (t *archService) InitNode(ctx context.Context, node *service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	if node.Architecture == "" {
-		result, err := client.Run(log, "uname -p", "", true)
+		machine, err := client.Run(ctx, log, "uname -m", "", true)
 		if err != nil {
 			return maskAny(err)
 		}
-		result = strings.TrimSpace(result)
-		switch result {
-		case "armv7l":
-			node.Architecture = "arm"
-		case "x86_64":
-			node.Architecture = "amd64"
-		default:
-			return maskAny(fmt.Errorf("Unsupported architecture '%s'", result))
+		machine = strings.TrimSpace(machine)
+		if arch, found := machineArchitectures[machine]; found {
+			node.Architecture = arch
+		} else {
+			// Fallback to package architecture
+			dpkgArch, err := client.Run(ctx, log, "dpkg --print-architecture", "", true)
+			if err != nil {
+				return maskAny(fmt.Errorf("Unsupported architecture '%s'", machine))
+			}
+			dpkgArch = strings.TrimSpace(dpkgArch)
+			arch, found := dpkgArchitectures[dpkgArch]
+			if !found {
+				return maskAny(fmt.Errorf("Unsupported architecture '%s' (%s)", machine, dpkgArch))
+			}
+			node.Architecture = arch
 		}
 		log.Info().Msgf("Found '%s' architecture on node", node.Architecture)
 	}
 
+	if t.willInit {
+		if err := flags.Images.ValidateNode(sctx, *node); err != nil {
+			return maskAny(err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,159 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Audit holds the audit logging settings of the apiserver.
+type Audit struct {
+	Enabled   bool         // If set, the apiserver writes an audit log
+	LogDir    string       // Directory (on control-plane nodes) containing the audit log
+	MaxAge    int          // Maximum number of days to retain old audit log files
+	MaxBackup int          // Maximum number of old audit log files to retain
+	MaxSize   int          // Maximum size in megabytes of an audit log file before it is rotated
+	Rules     []AuditRule  // Rules of the audit policy, evaluated before the Helix default rules
+	Webhook   AuditWebhook // Optional webhook backend
+}
+
+// AuditRule is a rule of the audit policy.
+type AuditRule struct {
+	Level           string               // Audit level (None|Metadata|Request|RequestResponse)
+	Users           []string             // Users this rule applies to (empty means all)
+	UserGroups      []string             // User groups this rule applies to (empty means all)
+	Verbs           []string             // Verbs this rule applies to (empty means all)
+	Resources       []AuditGroupResource // Resources this rule applies to (empty means all)
+	Namespaces      []string             // Namespaces this rule applies to (empty means all)
+	NonResourceURLs []string             // Non-resource URL paths this rule applies to (empty means all)
+	OmitStages      []string             // Stages for which no events are generated
+}
+
+// AuditGroupResource selects resources of an API group.
+type AuditGroupResource struct {
+	Group         string   // API group ("" is the core group)
+	Resources     []string // Resources of the group (empty means all)
+	ResourceNames []string // Names of the resources (empty means all)
+}
+
+// AuditWebhook holds the settings of the audit webhook backend.
+type AuditWebhook struct {
+	Server string // URL of the webhook server (empty means no webhook)
+	CAFile string // Path (on the local machine) of a CA certificate used to verify the webhook server
+	Mode   string // Mode of sending events (batch|blocking)
+
+	ca string // Content of CAFile
+}
+
+const (
+	defaultAuditLogDir    = "/var/log/kubernetes/audit"
+	defaultAuditMaxAge    = 30
+	defaultAuditMaxBackup = 10
+	defaultAuditMaxSize   = 100
+
+	AuditWebhookModeBatch    = "batch"
+	AuditWebhookModeBlocking = "blocking"
+)
+
+var (
+	auditLevels = []string{"None", "Metadata", "Request", "RequestResponse"}
+	auditStages = []string{"RequestReceived", "ResponseStarted", "ResponseComplete", "Panic"}
+)
+
+// setupDefaults fills given flags with default value
+func (flags *Audit) setupDefaults(log zerolog.Logger, apiServer ControlPlaneComponent) error {
+	if !flags.Enabled {
+		return nil
+	}
+	if flags.LogDir == "" {
+		flags.LogDir = defaultAuditLogDir
+	} else if !path.IsAbs(flags.LogDir) {
+		return maskAny(fmt.Errorf("Audit log directory must be an absolute path, got '%s'", flags.LogDir))
+	}
+	if flags.MaxAge == 0 {
+		flags.MaxAge = defaultAuditMaxAge
+	}
+	if flags.MaxBackup == 0 {
+		flags.MaxBackup = defaultAuditMaxBackup
+	}
+	if flags.MaxSize == 0 {
+		flags.MaxSize = defaultAuditMaxSize
+	}
+	if flags.MaxAge < 0 || flags.MaxBackup < 0 || flags.MaxSize < 0 {
+		return maskAny(fmt.Errorf("Audit log rotation settings cannot be negative"))
+	}
+	for i, r := range flags.Rules {
+		if !containsString(auditLevels, r.Level) {
+			return maskAny(fmt.Errorf("Audit rule %d has invalid level '%s', expected one of %s", i+1, r.Level, strings.Join(auditLevels, ", ")))
+		}
+		for _, s := range r.OmitStages {
+			if !containsString(auditStages, s) {
+				return maskAny(fmt.Errorf("Audit rule %d has invalid stage '%s', expected one of %s", i+1, s, strings.Join(auditStages, ", ")))
+			}
+		}
+		if len(r.NonResourceURLs) > 0 && (len(r.Resources) > 0 || len(r.Namespaces) > 0) {
+			return maskAny(fmt.Errorf("Audit rule %d cannot combine non-resource URLs with resources or namespaces", i+1))
+		}
+	}
+	if err := flags.Webhook.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	// Audit arguments are managed by these settings
+	for arg := range apiServer.ExtraArgs {
+		if strings.HasPrefix(arg, "audit-") {
+			return maskAny(fmt.Errorf("Argument --%s of %s cannot be used when audit logging is enabled, use the audit settings instead", arg, ComponentAPIServer))
+		}
+	}
+	return nil
+}
+
+// setupDefaults fills given flags with default value
+func (flags *AuditWebhook) setupDefaults(log zerolog.Logger) error {
+	if !flags.IsEnabled() {
+		return nil
+	}
+	if u, err := url.Parse(flags.Server); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return maskAny(fmt.Errorf("Invalid audit webhook server '%s', expected an http(s) URL", flags.Server))
+	}
+	if flags.Mode == "" {
+		flags.Mode = AuditWebhookModeBatch
+	} else if flags.Mode != AuditWebhookModeBatch && flags.Mode != AuditWebhookModeBlocking {
+		return maskAny(fmt.Errorf("Invalid audit webhook mode '%s', expected %s or %s", flags.Mode, AuditWebhookModeBatch, AuditWebhookModeBlocking))
+	}
+	if flags.CAFile != "" {
+		content, err := ioutil.ReadFile(flags.CAFile)
+		if err != nil {
+			return maskAny(fmt.Errorf("Failed to read audit webhook CA file '%s': %v", flags.CAFile, err))
+		}
+		flags.ca = string(content)
+	}
+	return nil
+}
+
+// IsEnabled returns true if audit events are sent to a webhook.
+func (flags AuditWebhook) IsEnabled() bool {
+	return flags.Server != ""
+}
+
+// CA returns the content of the CA certificate used to verify the webhook server.
+func (flags AuditWebhook) CA() string {
+	return flags.ca
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// RuntimeDocker uses docker (through the kubelet build-in dockershim) as container runtime.
+	RuntimeDocker = "docker"
+	// RuntimeContainerd uses containerd (through its CRI plugin) as container runtime.
+	RuntimeContainerd = "containerd"
+
+	defaultContainerRuntime = RuntimeDocker
+	containerdSocket        = "/run/containerd/containerd.sock"
+)
+
+// ContainerRuntime configures the container runtime used on all nodes.
+type ContainerRuntime struct {
+	Name string // Name of the runtime (docker|containerd)
+}
+
+// setupDefaults fills given flags with default value
+func (flags *ContainerRuntime) setupDefaults(log zerolog.Logger) error {
+	if flags.Name == "" {
+		flags.Name = defaultContainerRuntime
+	}
+	switch flags.Name {
+	case RuntimeDocker, RuntimeContainerd:
+		return nil
+	default:
+		return maskAny(fmt.Errorf("Unknown container runtime '%s', expected %s or %s", flags.Name, RuntimeDocker, RuntimeContainerd))
+	}
+}
+
+// IsContainerd returns true if containerd is used as container runtime.
+func (flags ContainerRuntime) IsContainerd() bool {
+	return flags.Name == RuntimeContainerd
+}
+
+// SystemdUnit returns the name of the systemd unit running the container runtime.
+func (flags ContainerRuntime) SystemdUnit() string {
+	return flags.Name + ".service"
+}
+
+// RemoteEndpoint returns the CRI endpoint used by the kubelet,
+// or an empty string if the kubelet talks to docker directly.
+func (flags ContainerRuntime) RemoteEndpoint() string {
+	if flags.IsContainerd() {
+		return "unix://" + containerdSocket
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerd
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	ServiceName = "containerd"
+	configPath  = "/etc/containerd/config.toml"
+	crictlPath  = "/etc/crictl.yaml"
+
+	configFileMode = os.FileMode(0644)
+)
+
+func NewService() service.Service {
+	return &containerdService{}
+}
+
+type containerdService struct {
+}
+
+func (t *containerdService) Name() string {
+	return ServiceName
+}
+
+// IsDisruptive returns true.
+func (t *containerdService) IsDisruptive() bool {
+	return true
+}
+
+func (t *containerdService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	return nil
+}
+
+// InitMachine installs & configures containerd on the machine.
+func (t *containerdService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	if !flags.ContainerRuntime.IsContainerd() {
+		log.Info().Msg("No containerd on this machine")
+		return nil
+	}
+
+	// Install containerd
+	log.Info().Msg("Installing containerd")
+	if _, err := client.Run(ctx, log, "command -v containerd || (sudo apt-get update && sudo apt-get install -y containerd)", "", false); err != nil {
+		return maskAny(err)
+	}
+
+	// Create configuration
+	cfg := config{
+		Endpoint:   flags.ContainerRuntime.RemoteEndpoint(),
+		CniBinDir:  "/opt/cni/bin",
+		CniConfDir: "/etc/cni/net.d",
+	}
+	if err := client.Render(ctx, log, configTemplate, configPath, cfg, configFileMode); err != nil {
+		return maskAny(err)
+	}
+	if err := client.Render(ctx, log, crictlTemplate, crictlPath, cfg, configFileMode); err != nil {
+		return maskAny(err)
+	}
+
+	// Restart service
+	if _, err := client.Run(ctx, log, "sudo systemctl daemon-reload", "", false); err != nil {
+		return maskAny(err)
+	}
+	if _, err := client.Run(ctx, log, "sudo systemctl enable "+ServiceName, "", false); err != nil {
+		return maskAny(err)
+	}
+	if _, err := client.Run(ctx, log, "sudo systemctl restart "+ServiceName, "", false); err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// ResetMachine stops containerd and removes its configuration.
+// The containerd package itself is left installed.
+func (t *containerdService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	if !flags.ContainerRuntime.IsContainerd() {
+		log.Info().Msg("No containerd on this machine")
+		return nil
+	}
+
+	// Stop service
+	if _, err := client.Run(ctx, log, "sudo systemctl stop "+ServiceName, "", true); err != nil {
+		log.Warn().Err(err).Msg("Failed to stop containerd service")
+	}
+	if _, err := client.Run(ctx, log, "sudo systemctl disable "+ServiceName, "", true); err != nil {
+		log.Warn().Err(err).Msg("Failed to disable containerd service")
+	}
+
+	// Remove configuration
+	if err := client.RemoveFile(ctx, log, crictlPath); err != nil {
+		return maskAny(err)
+	}
+	if err := client.RemoveFile(ctx, log, configPath); err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+type config struct {
+	Endpoint   string // CRI endpoint of containerd
+	CniBinDir  string // Directory containing CNI plugins
+	CniConfDir string // Directory containing CNI configuration
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerd
+
+const (
+	configTemplate = `[plugins.cri]
+  sandbox_image = "k8s.gcr.io/pause:3.1"
+  [plugins.cri.containerd]
+    snapshotter = "overlayfs"
+  [plugins.cri.cni]
+    bin_dir = "{{ .CniBinDir }}"
+    conf_dir = "{{ .CniConfDir }}"
+`
+
+	crictlTemplate = `runtime-endpoint: {{ .Endpoint }}
+image-endpoint: {{ .Endpoint }}
+`
+)
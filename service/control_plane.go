@@ -28,6 +28,7 @@ type ControlPlane struct {
 	APIServerVirtualIP string   // Virtual IP address of APIServer
 	APIServerDNSName   string   // DNS name of APIServer
 	Members            []string // Hostnames / IP address of all nodes that form the control plane.
+	Schedulable        bool     // If set, control-plane nodes are not tainted, allowing normal workloads to run on them.
 }
 
 // setupDefaults fills given flags with default value
@@ -39,9 +40,9 @@ func (flags *ControlPlane) setupDefaults(log zerolog.Logger, isSetup bool) error
 }
 
 // setupDefaults fills given flags with default value
-func (flags *ControlPlane) createNodes(log zerolog.Logger) ([]*Node, error) {
+func (flags *ControlPlane) createNodes(log zerolog.Logger, ipFamily string) ([]*Node, error) {
 	if len(flags.Members) > 0 {
-		nodes, err := CreateNodes(flags.Members, true)
+		nodes, err := CreateNodes(flags.Members, true, ipFamily)
 		if err != nil {
 			return nil, maskAny(err)
 		}
@@ -53,6 +54,7 @@ func (flags *ControlPlane) createNodes(log zerolog.Logger) ([]*Node, error) {
 		if err != nil {
 			return nil, maskAny(err)
 		}
+		addrs = filterAddresses(addrs, ipFamily)
 		nodes := make([]*Node, len(addrs))
 		errors := make(chan error, len(addrs))
 		defer close(errors)
@@ -87,3 +89,18 @@ func (flags *ControlPlane) createNodes(log zerolog.Logger) ([]*Node, error) {
 	}
 	return nil, nil
 }
+
+// filterAddresses returns all addresses of the given IP family (IPv4|IPv6) in the given list.
+// If there are no such addresses, all addresses are returned.
+func filterAddresses(addrs []string, ipFamily string) []string {
+	var result []string
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ipFamilyOf(ip) == ipFamily {
+			result = append(result, addr)
+		}
+	}
+	if len(result) == 0 {
+		return addrs
+	}
+	return result
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ControlPlaneComponent holds customizations of a control-plane component (apiserver|controller-manager|scheduler).
+type ControlPlaneComponent struct {
+	ExtraArgs    map[string]string // Command line arguments (name without leading --) that are added to, or override, the Helix defaults
+	ExtraVolumes []HostPathMount   // Host paths mounted into the static pod of the component
+	Resources    Resources         // Resource requests & limits, merged over the Helix defaults
+}
+
+// HostPathMount is a host path mounted into a static pod.
+type HostPathMount struct {
+	Name      string // Name of the volume (unique per component)
+	HostPath  string // Path on the host
+	MountPath string // Path in the container
+	ReadOnly  bool   // If set, the volume is mounted read-only
+	PathType  string // Type of the host path (DirectoryOrCreate|Directory|FileOrCreate|File|Socket|CharDevice|BlockDevice), defaults to DirectoryOrCreate
+}
+
+// Resources holds resource requests & limits of a container (resource -> quantity).
+type Resources struct {
+	Requests map[string]string
+	Limits   map[string]string
+}
+
+const (
+	ComponentAPIServer         = "apiserver"
+	ComponentControllerManager = "controller-manager"
+	ComponentScheduler         = "scheduler"
+
+	defaultHostPathType = "DirectoryOrCreate"
+)
+
+var (
+	// Arguments that are managed by Helix (argument -> setting to use instead, if any)
+	managedComponentArgs = map[string]map[string]string{
+		ComponentAPIServer: {
+			"client-ca-file":             "",
+			"encryption-provider-config": "encryption",
+			"etcd-cafile":                "",
+			"etcd-certfile":              "",
+			"etcd-keyfile":               "",
+			"etcd-servers":               "",
+			"experimental-encryption-provider-config": "encryption",
+			"feature-gates":                 "kubernetes.featureGates",
+			"kubelet-certificate-authority": "",
+			"kubelet-client-certificate":    "",
+			"kubelet-client-key":            "",
+			"proxy-client-cert-file":        "",
+			"proxy-client-key-file":         "",
+			"requestheader-client-ca-file":  "",
+			"secure-port":                   "",
+			"service-account-key-file":      "",
+			"service-cluster-ip-range":      "kubernetes.serviceClusterIPRange",
+			"tls-cert-file":                 "",
+			"tls-private-key-file":          "",
+		},
+		ComponentControllerManager: {
+			"allocate-node-cidrs":              "",
+			"cluster-cidr":                     "kubernetes.podNetworkCIDR",
+			"cluster-signing-cert-file":        "",
+			"cluster-signing-key-file":         "",
+			"feature-gates":                    "kubernetes.featureGates",
+			"kubeconfig":                       "",
+			"node-cidr-mask-size":              "kubernetes.nodeCIDRMaskSize",
+			"node-cidr-mask-size-ipv4":         "kubernetes.nodeCIDRMaskSize",
+			"node-cidr-mask-size-ipv6":         "kubernetes.nodeCIDRMaskSizeIPv6",
+			"root-ca-file":                     "",
+			"service-account-private-key-file": "",
+			"service-cluster-ip-range":         "kubernetes.serviceClusterIPRange",
+		},
+		ComponentScheduler: {
+			"feature-gates": "kubernetes.featureGates",
+			"kubeconfig":    "",
+		},
+	}
+	hostPathTypes      = []string{"DirectoryOrCreate", "Directory", "FileOrCreate", "File", "Socket", "CharDevice", "BlockDevice"}
+	containerResources = []string{"cpu", "memory", "ephemeral-storage"}
+	// Names of extra volumes are prefixed with "extra-" and must result in a DNS label
+	volumeNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,55}[a-z0-9])?$`)
+)
+
+// validate checks the customizations of the control-plane component with given name.
+func (c ControlPlaneComponent) validate(name string) error {
+	managed := managedComponentArgs[name]
+	for arg, value := range c.ExtraArgs {
+		if arg == "" || strings.HasPrefix(arg, "-") {
+			return maskAny(fmt.Errorf("Invalid extra argument '%s' of %s, specify names without leading dashes", arg, name))
+		}
+		if instead, found := managed[arg]; found {
+			if instead != "" {
+				return maskAny(fmt.Errorf("Argument --%s of %s is managed by Helix, use %s instead", arg, name, instead))
+			}
+			return maskAny(fmt.Errorf("Argument --%s of %s is managed by Helix", arg, name))
+		}
+		if err := validateComponentArg(name, arg, value); err != nil {
+			return maskAny(err)
+		}
+	}
+	if name == ComponentAPIServer && c.HasExtraArg("admission-control") && c.HasExtraArg("enable-admission-plugins") {
+		return maskAny(fmt.Errorf("Arguments --admission-control and --enable-admission-plugins of %s cannot be combined", name))
+	}
+	names := make(map[string]struct{})
+	for _, v := range c.ExtraVolumes {
+		if v.Name == "" {
+			return maskAny(fmt.Errorf("Extra volume of %s has no name", name))
+		}
+		if !volumeNamePattern.MatchString(v.Name) {
+			return maskAny(fmt.Errorf("Invalid name '%s' of extra volume of %s, expected at most 57 lowercase alphanumeric characters or '-'", v.Name, name))
+		}
+		if _, found := names[v.Name]; found {
+			return maskAny(fmt.Errorf("Duplicate extra volume '%s' of %s", v.Name, name))
+		}
+		names[v.Name] = struct{}{}
+		if !path.IsAbs(v.HostPath) || !path.IsAbs(v.MountPath) {
+			return maskAny(fmt.Errorf("Extra volume '%s' of %s must have an absolute host path & mount path", v.Name, name))
+		}
+		if v.PathType != "" && !containsString(hostPathTypes, v.PathType) {
+			return maskAny(fmt.Errorf("Unknown path type '%s' of extra volume '%s' of %s, expected one of %s", v.PathType, v.Name, name, strings.Join(hostPathTypes, ", ")))
+		}
+	}
+	for _, m := range []map[string]string{c.Resources.Requests, c.Resources.Limits} {
+		for k, v := range m {
+			if !containsString(containerResources, k) {
+				return maskAny(fmt.Errorf("Unknown resource '%s' of %s, expected one of %s", k, name, strings.Join(containerResources, ", ")))
+			}
+			if v == "" {
+				return maskAny(fmt.Errorf("Resource '%s' of %s has no quantity", k, name))
+			}
+		}
+	}
+	return nil
+}
+
+// validateComponentArg checks the value of an extra argument against overrides that are known to break the cluster.
+func validateComponentArg(name, arg, value string) error {
+	requireValue := func(required string) error {
+		if value != required {
+			return maskAny(fmt.Errorf("Argument --%s of %s must be %s", arg, name, required))
+		}
+		return nil
+	}
+	requireValues := func(required ...string) error {
+		values := strings.Split(value, ",")
+		for _, r := range required {
+			if !containsString(values, r) {
+				return maskAny(fmt.Errorf("Argument --%s of %s must contain %s", arg, name, r))
+			}
+		}
+		return nil
+	}
+	switch name + "/" + arg {
+	case ComponentAPIServer + "/authorization-mode":
+		// Kubelets & Helix rely on node authorization & RBAC
+		return requireValues("Node", "RBAC")
+	case ComponentAPIServer + "/enable-admission-plugins", ComponentAPIServer + "/admission-control":
+		// Node authorization is only safe with the NodeRestriction plugin
+		return requireValues("NodeRestriction")
+	case ComponentAPIServer + "/enable-bootstrap-token-auth":
+		// Worker kubelets use a bootstrap token
+		return requireValue("true")
+	case ComponentAPIServer + "/anonymous-auth":
+		// Liveness probes & load-balancer health checks call /healthz anonymously
+		return requireValue("true")
+	case ComponentControllerManager + "/controllers":
+		// Bootstrap tokens need the bootstrap signer & token cleaner
+		return requireValues("bootstrapsigner", "tokencleaner")
+	}
+	return nil
+}
+
+// HasExtraArg returns true if any of the given arguments is set in the extra arguments.
+func (c ControlPlaneComponent) HasExtraArg(names ...string) bool {
+	for _, name := range names {
+		if _, found := c.ExtraArgs[name]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// Args returns the command line arguments of the component: the given defaults,
+// overridden by the extra arguments, formatted as --name=value & sorted by name.
+func (c ControlPlaneComponent) Args(defaults map[string]string) []string {
+	merged := mergeStringMaps(defaults, c.ExtraArgs)
+	result := make([]string, 0, len(merged))
+	for k, v := range merged {
+		result = append(result, "--"+k+"="+v)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Volumes returns the extra volumes of the component, with default path types.
+// An error is returned if one of them is mounted at one of the given (default) mount paths.
+func (c ControlPlaneComponent) Volumes(defaultMountPaths ...string) ([]HostPathMount, error) {
+	result := make([]HostPathMount, 0, len(c.ExtraVolumes))
+	for _, v := range c.ExtraVolumes {
+		for _, p := range defaultMountPaths {
+			if path.Clean(v.MountPath) == path.Clean(p) {
+				return nil, maskAny(fmt.Errorf("Extra volume '%s' is mounted at %s, which is used by Helix", v.Name, p))
+			}
+		}
+		if v.PathType == "" {
+			v.PathType = defaultHostPathType
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// MergeResources returns the given default resources, overridden by the resources of the component.
+func (c ControlPlaneComponent) MergeResources(defaults Resources) Resources {
+	return Resources{
+		Requests: mergeStringMaps(defaults.Requests, c.Resources.Requests),
+		Limits:   mergeStringMaps(defaults.Limits, c.Resources.Limits),
+	}
+}
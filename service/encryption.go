@@ -0,0 +1,155 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+// Encryption holds the settings for encryption of secrets at rest.
+type Encryption struct {
+	Provider string // Provider used to encrypt secrets (aescbc|secretbox|identity), identity disables encryption
+}
+
+const (
+	EncryptionProviderAESCBC    = "aescbc"
+	EncryptionProviderSecretBox = "secretbox"
+	EncryptionProviderIdentity  = "identity"
+
+	defaultEncryptionProvider = EncryptionProviderAESCBC
+	encryptionKeysName        = "encryption-keys"
+
+	// Minimum version supporting encryption of secrets at rest
+	minEncryptionVersion = "v1.7.0"
+	// Version from which the encryption configuration is no longer experimental
+	minEncryptionConfigurationVersion = "v1.13.0"
+)
+
+// setupDefaults fills given flags with default value
+func (flags *Encryption) setupDefaults(log zerolog.Logger, k8sVersion string) error {
+	if flags.Provider == "" {
+		flags.Provider = defaultEncryptionProvider
+	}
+	switch flags.Provider {
+	case EncryptionProviderAESCBC, EncryptionProviderSecretBox:
+		if util.CompareVersions(k8sVersion, minEncryptionVersion) < 0 {
+			return maskAny(fmt.Errorf("Encryption of secrets requires kubernetes %s or higher, use provider %s instead", minEncryptionVersion, EncryptionProviderIdentity))
+		}
+	case EncryptionProviderIdentity:
+		// Encryption disabled
+	default:
+		return maskAny(fmt.Errorf("Unknown encryption provider '%s', expected %s, %s or %s", flags.Provider, EncryptionProviderAESCBC, EncryptionProviderSecretBox, EncryptionProviderIdentity))
+	}
+	return nil
+}
+
+// IsEnabled returns true if secrets are encrypted at rest.
+func (flags Encryption) IsEnabled() bool {
+	return flags.Provider != EncryptionProviderIdentity
+}
+
+// EncryptionKeysPath returns the path of the file (in the given local conf dir)
+// that contains the encryption keys.
+func EncryptionKeysPath(confDir string) string {
+	return filepath.Join(confDir, encryptionKeysName)
+}
+
+// LoadEncryptionKeys tries to load the encryption keys from the given conf dir.
+// If encryption is enabled and there are no keys yet, a new key is created.
+// If encryption is disabled, existing keys are loaded (so encrypted secrets can
+// still be read), but no keys are created.
+func (deps *ServiceDependencies) LoadEncryptionKeys(confDir string, flags Encryption) error {
+	keysPath := EncryptionKeysPath(confDir)
+	keys, err := util.LoadEncryptionKeys(keysPath)
+	if err != nil {
+		return maskAny(err)
+	}
+	if len(keys) == 0 && flags.IsEnabled() {
+		key, err := keys.NewKey(flags.Provider)
+		if err != nil {
+			return maskAny(err)
+		}
+		keys = util.EncryptionKeys{key}
+		if err := keys.Save(keysPath); err != nil {
+			return maskAny(err)
+		}
+	}
+	deps.EncryptionKeys = keys
+	return nil
+}
+
+// EncryptionProviderConfigArg returns the name of the apiserver argument
+// that specifies the encryption configuration file for the given kubernetes version.
+func EncryptionProviderConfigArg(k8sVersion string) string {
+	if util.CompareVersions(k8sVersion, minEncryptionConfigurationVersion) < 0 {
+		return "experimental-encryption-provider-config"
+	}
+	return "encryption-provider-config"
+}
+
+// CreateEncryptionConfig returns the content of the encryption configuration
+// file for the given kubernetes version & keys, or an empty string if
+// no configuration is needed.
+// It is built without a template, since secrets can contain characters
+// that would otherwise be escaped.
+func (flags Encryption) CreateEncryptionConfig(k8sVersion string, keys util.EncryptionKeys) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	w := &bytes.Buffer{}
+	if util.CompareVersions(k8sVersion, minEncryptionConfigurationVersion) < 0 {
+		fmt.Fprintln(w, "kind: EncryptionConfig")
+		fmt.Fprintln(w, "apiVersion: v1")
+	} else {
+		fmt.Fprintln(w, "kind: EncryptionConfiguration")
+		fmt.Fprintln(w, "apiVersion: apiserver.config.k8s.io/v1")
+	}
+	fmt.Fprintln(w, "resources:")
+	fmt.Fprintln(w, "- resources:")
+	fmt.Fprintln(w, "  - secrets")
+	fmt.Fprintln(w, "  providers:")
+	if !flags.IsEnabled() {
+		// Write plain text, but keep reading encrypted secrets
+		fmt.Fprintln(w, "  - identity: {}")
+	}
+	for i, k := range keys {
+		if i == 0 || keys[i-1].Provider != k.Provider {
+			fmt.Fprintf(w, "  - %s:\n", k.Provider)
+			fmt.Fprintln(w, "      keys:")
+		}
+		fmt.Fprintf(w, "      - name: %s\n", k.Name)
+		fmt.Fprintf(w, "        secret: %s\n", k.Secret)
+	}
+	if flags.IsEnabled() {
+		// Read secrets that were written before encryption was enabled
+		fmt.Fprintln(w, "  - identity: {}")
+	}
+	return w.String()
+}
+
+// EncryptionConfigHash returns a hash of the given encryption configuration.
+func EncryptionConfigHash(config string) string {
+	if config == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(config)))
+}
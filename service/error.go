@@ -15,9 +15,45 @@
 package service
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 )
 
 var (
 	maskAny = errors.WithStack
 )
+
+// ServiceError is the cause of errors returned by Run & Reset
+// when a step of a service fails.
+type ServiceError struct {
+	Service string // Name of the failing service
+	Step    string // Name of the failing step (prepare, init, init-node, init-machine, reset-machine, reset)
+	Node    string // Name of the node on which the step failed (empty when not node specific)
+	Err     error  // The underlying error
+}
+
+// Error implements the error interface.
+func (e *ServiceError) Error() string {
+	if e.Node != "" {
+		return fmt.Sprintf("%s of service %s failed on node %s: %v", e.Step, e.Service, e.Node, e.Err)
+	}
+	return fmt.Sprintf("%s of service %s failed: %v", e.Step, e.Service, e.Err)
+}
+
+// newServiceError wraps the given error in a ServiceError.
+// Returns nil if the given error is nil.
+func newServiceError(s Service, step string, node *Node, err error) error {
+	if err == nil {
+		return nil
+	}
+	result := &ServiceError{
+		Service: s.Name(),
+		Step:    step,
+		Err:     err,
+	}
+	if node != nil {
+		result.Node = node.Name
+	}
+	return maskAny(result)
+}
@@ -15,7 +15,8 @@
 package service
 
 import (
-	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -52,13 +53,28 @@ func (flags Etcd) CreateInitialCluster(sctx *ServiceContext) string {
 func (flags Etcd) createEndpoints(sctx *ServiceContext, port int, prefixBuilder func(Node) string) string {
 	var endpoints []string
 	for _, n := range sctx.nodes {
-		if n.IsControlPlane {
+		if n.IsEtcdMember() {
 			prefix := ""
 			if prefixBuilder != nil {
 				prefix = prefixBuilder(*n)
 			}
-			endpoints = append(endpoints, fmt.Sprintf("%shttps://%s:%d", prefix, n.Address, port))
+			endpoints = append(endpoints, prefix+endpointURL(*n, port))
 		}
 	}
 	return strings.Join(endpoints, ",")
 }
+
+// ClientURL returns the URL of the ETCD server on the given node, used by clients.
+func (flags Etcd) ClientURL(node Node) string {
+	return endpointURL(node, defaultEtcdClientPort)
+}
+
+// PeerURL returns the URL of the ETCD server on the given node, used by peers.
+func (flags Etcd) PeerURL(node Node) string {
+	return endpointURL(node, defaultEtcdPeerPort)
+}
+
+// endpointURL returns the URL to reach an ETCD server on the given node at the given port.
+func endpointURL(node Node, port int) string {
+	return "https://" + net.JoinHostPort(node.GetInternalAddress(), strconv.Itoa(port))
+}
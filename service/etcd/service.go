@@ -15,6 +15,7 @@
 package etcd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -62,7 +63,12 @@ func (t *etcdService) Name() string {
 	return "etcd"
 }
 
-func (t *etcdService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+// IsDisruptive returns true, since restarting several ETCD members at once can lose quorum.
+func (t *etcdService) IsDisruptive() bool {
+	return true
+}
+
+func (t *etcdService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.isExisting = 0
 	if willInit {
 		confDir := flags.LocalConfDir
@@ -83,16 +89,16 @@ func (t *etcdService) Prepare(sctx *service.ServiceContext, deps service.Service
 }
 
 // InitNode looks for an existing ETCD data
-func (t *etcdService) InitNode(node *service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *etcdService) InitNode(ctx context.Context, node *service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Setup ETCD on this host?
-	if !node.IsControlPlane {
+	if !node.IsEtcdMember() {
 		return nil
 	}
 
 	memberDir := filepath.Join(dataDir, "member")
-	result, err := client.Run(log, fmt.Sprintf("test -d %s || echo 'not'", memberDir), "", true)
+	result, err := client.Run(ctx, log, fmt.Sprintf("test -d %s || echo 'not'", memberDir), "", true)
 	if err != nil {
 		return maskAny(err)
 	}
@@ -106,11 +112,11 @@ func (t *etcdService) InitNode(node *service.Node, client util.SSHClient, sctx *
 }
 
 // InitMachine configures the machine to run ETCD.
-func (t *etcdService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *etcdService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Setup ETCD on this host?
-	if !node.IsControlPlane {
+	if !node.IsEtcdMember() {
 		log.Info().Msg("No ETCD on this machine")
 		return nil
 	}
@@ -122,39 +128,39 @@ func (t *etcdService) InitMachine(node service.Node, client util.SSHClient, sctx
 
 	// Create certificates
 	log.Info().Msg("Creating ETCD Server Certificates")
-	clientCert, clientKey, err := deps.EtcdCA.CreateTLSServerCertificate(node.Name, "helix", client)
+	clientCert, clientKey, err := deps.EtcdCA.CreateTLSServerCertificate(node.Name, "helix", client, node.GetInternalAddress())
 	if err != nil {
 		return maskAny(err)
 	}
-	peerCert, peerKey, err := deps.EtcdCA.CreateTLSServerCertificate(node.Name, "helix", client)
+	peerCert, peerKey, err := deps.EtcdCA.CreateTLSServerCertificate(node.Name, "helix", client, node.GetInternalAddress())
 	if err != nil {
 		return maskAny(err)
 	}
 
 	// Upload certificates
 	log.Info().Msg("Uploading ETCD Server Certificates")
-	if err := client.UpdateFile(log, cfg.ClientCertFile, []byte(clientCert), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.ClientCertFile, []byte(clientCert), certFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.ClientKeyFile, []byte(clientKey), keyFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.ClientKeyFile, []byte(clientKey), keyFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.ClientCAFile, []byte(deps.EtcdCA.Cert()), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.ClientCAFile, []byte(deps.EtcdCA.Cert()), certFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.PeerCertFile, []byte(peerCert), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.PeerCertFile, []byte(peerCert), certFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.PeerKeyFile, []byte(peerKey), keyFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.PeerKeyFile, []byte(peerKey), keyFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.PeerCAFile, []byte(deps.EtcdCA.Cert()), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.PeerCAFile, []byte(deps.EtcdCA.Cert()), certFileMode); err != nil {
 		return maskAny(err)
 	}
 
 	// Create manifest
 	log.Info().Msg("Creating ETCD Manifest")
-	if err := createManifest(client, deps, cfg); err != nil {
+	if err := createManifest(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
@@ -162,7 +168,7 @@ func (t *etcdService) InitMachine(node service.Node, client util.SSHClient, sctx
 }
 
 // ResetMachine removes ETCD from the machine.
-func (t *etcdService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *etcdService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	cfg, err := t.createEtcdConfig(node, client, sctx, deps, flags)
@@ -171,32 +177,32 @@ func (t *etcdService) ResetMachine(node service.Node, client util.SSHClient, sct
 	}
 
 	// Remove manifest
-	if err := client.RemoveFile(log, manifestPath); err != nil {
+	if err := client.RemoveFile(ctx, log, manifestPath); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove certificates
-	if err := client.RemoveFile(log, cfg.ClientCertFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.ClientCertFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.ClientKeyFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.ClientKeyFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.ClientCAFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.ClientCAFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.PeerCertFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.PeerCertFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.PeerKeyFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.PeerKeyFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.PeerCAFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.PeerCAFile); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove data dir
-	if err := client.RemoveDirectory(log, cfg.DataDir); err != nil {
+	if err := client.RemoveDirectory(ctx, log, cfg.DataDir); err != nil {
 		return maskAny(err)
 	}
 
@@ -210,6 +216,8 @@ type etcdConfig struct {
 	ClusterState        string
 	InitialCluster      string
 	InitialClusterToken string
+	ClientURL           string // URL to listen on for client traffic
+	PeerURL             string // URL to listen on for peer traffic
 	CertificatesDir     string // Directory containing certificates
 	DataDir             string // Directory containing ETCD data
 	ClientCertFile      string // Path of --cert-file
@@ -228,6 +236,8 @@ func (t *etcdService) createEtcdConfig(node service.Node, client util.SSHClient,
 		ClusterState:        "new",
 		InitialCluster:      flags.Etcd.CreateInitialCluster(sctx),
 		InitialClusterToken: t.initialClusterToken,
+		ClientURL:           flags.Etcd.ClientURL(node),
+		PeerURL:             flags.Etcd.PeerURL(node),
 		CertificatesDir:     CertsDir,
 		DataDir:             dataDir,
 		ClientCertFile:      filepath.Join(CertsDir, ClientCertFileName),
@@ -244,9 +254,9 @@ func (t *etcdService) createEtcdConfig(node service.Node, client util.SSHClient,
 	return result, nil
 }
 
-func createManifest(client util.SSHClient, deps service.ServiceDependencies, opts etcdConfig) error {
+func createManifest(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts etcdConfig) error {
 	deps.Logger.Info().Msgf("Creating manifest %s", manifestPath)
-	if err := client.Render(deps.Logger, etcdManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, etcdManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -31,10 +31,10 @@ spec:
     - /usr/local/bin/etcd
     - --name={{.PeerName}}
     - --data-dir={{.DataDir}}
-    - --listen-client-urls=https://$(PRIVATE_IP):2379
-    - --advertise-client-urls=https://$(PRIVATE_IP):2379
-    - --listen-peer-urls=https://$(PRIVATE_IP):2380
-    - --initial-advertise-peer-urls=https://$(PRIVATE_IP):2380
+    - --listen-client-urls={{.ClientURL}}
+    - --advertise-client-urls={{.ClientURL}}
+    - --listen-peer-urls={{.PeerURL}}
+    - --initial-advertise-peer-urls={{.PeerURL}}
     - --cert-file={{.ClientCertFile}}
     - --key-file={{.ClientKeyFile}}
     - --client-cert-auth
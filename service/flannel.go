@@ -0,0 +1,102 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+// Flannel config
+type Flannel struct {
+	Backend       string // Backend used to forward packets between nodes (vxlan|host-gw|ipsec|wireguard)
+	VNI           int    // VXLAN network identifier (vxlan only)
+	Port          int    // UDP port used for encapsulated packets (vxlan & wireguard only)
+	DirectRouting bool   // Route directly (like host-gw) between nodes in the same subnet (vxlan only)
+	PSK           string // Pre-shared key (required for ipsec, optional for wireguard)
+	Interface     string // Name or IP address of the interface used for traffic between nodes (empty for the interface of the default route)
+}
+
+const (
+	FlannelBackendVXLAN     = "vxlan"
+	FlannelBackendHostGW    = "host-gw"
+	FlannelBackendIPSec     = "ipsec"
+	FlannelBackendWireguard = "wireguard"
+
+	defaultFlannelBackend       = FlannelBackendVXLAN
+	defaultFlannelVXLANVNI      = 1
+	defaultFlannelVXLANPort     = 8472
+	defaultFlannelWireguardPort = 51820
+	minFlannelIPSecPSKLength    = 96
+)
+
+var (
+	// Minimum flannel version per backend
+	flannelBackendVersions = map[string]string{
+		FlannelBackendVXLAN:     "",
+		FlannelBackendHostGW:    "",
+		FlannelBackendIPSec:     "v0.10.0",
+		FlannelBackendWireguard: "v0.14.0",
+	}
+)
+
+// setupDefaults fills given flags with default value
+func (flags *Flannel) setupDefaults(log zerolog.Logger, flannelVersion string) error {
+	if flags.Backend == "" {
+		flags.Backend = defaultFlannelBackend
+	}
+	minVersion, found := flannelBackendVersions[flags.Backend]
+	if !found {
+		return maskAny(fmt.Errorf("Unknown flannel backend '%s', expected one of %s, %s, %s or %s", flags.Backend, FlannelBackendVXLAN, FlannelBackendHostGW, FlannelBackendIPSec, FlannelBackendWireguard))
+	}
+	if minVersion != "" && util.CompareVersions(flannelVersion, minVersion) < 0 {
+		return maskAny(fmt.Errorf("Flannel backend '%s' requires flannel %s or higher, got %s", flags.Backend, minVersion, flannelVersion))
+	}
+	switch flags.Backend {
+	case FlannelBackendVXLAN:
+		if flags.VNI == 0 {
+			flags.VNI = defaultFlannelVXLANVNI
+		}
+		if flags.Port == 0 {
+			flags.Port = defaultFlannelVXLANPort
+		}
+	case FlannelBackendWireguard:
+		if flags.Port == 0 {
+			flags.Port = defaultFlannelWireguardPort
+		}
+	case FlannelBackendIPSec:
+		if len(flags.PSK) < minFlannelIPSecPSKLength {
+			return maskAny(fmt.Errorf("Flannel ipsec backend requires a PSK of at least %d characters", minFlannelIPSecPSKLength))
+		}
+	}
+	if flags.VNI < 0 || flags.VNI > 16777215 {
+		return maskAny(fmt.Errorf("Invalid flannel VNI %d", flags.VNI))
+	}
+	if flags.Port < 0 || flags.Port > 65535 {
+		return maskAny(fmt.Errorf("Invalid flannel port %d", flags.Port))
+	}
+	return nil
+}
+
+// KernelModules returns the kernel modules needed by the flannel backend.
+func (flags Flannel) KernelModules() []string {
+	if flags.Backend == FlannelBackendWireguard {
+		return []string{"wireguard"}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	failureHookTimeout = time.Minute
+)
+
+// Hooks configures commands that are run around services and nodes.
+// Hook commands get the following environment variables:
+// HELIX_PHASE (init|reset), HELIX_SERVICE, HELIX_NODE_NAME, HELIX_NODE_ADDRESS
+// and (for failure hooks) HELIX_ERROR.
+type Hooks struct {
+	BeforeService []Hook // Run before a service is initialized or reset
+	AfterService  []Hook // Run after a service has been initialized or reset
+	BeforeNode    []Hook // Run before a service is initialized or reset on a node
+	AfterNode     []Hook // Run after a service has been initialized or reset on a node
+	OnFailure     []Hook // Run when a service (on a node) failed
+}
+
+// Hook is a single command run at a hook point.
+type Hook struct {
+	Command  string   // Shell command to run
+	Remote   bool     // If set, the command is run on the node (using SSH), otherwise locally
+	Services []string // Names of the services to run for (empty means all services)
+	Roles    []string // Roles of the nodes to run for (empty means all nodes)
+}
+
+// hookEnv holds the information passed to hook commands.
+type hookEnv struct {
+	Phase   string
+	Service string
+	Node    *Node
+	Client  util.SSHClient
+	Err     error
+}
+
+// setupDefaults fills given flags with default value
+func (flags *Hooks) setupDefaults(log zerolog.Logger) error {
+	validate := func(point string, hooks []Hook, allowRemote bool) error {
+		for _, h := range hooks {
+			if strings.TrimSpace(h.Command) == "" {
+				return maskAny(fmt.Errorf("%s hook must have a command", point))
+			}
+			if h.Remote && !allowRemote {
+				return maskAny(fmt.Errorf("%s hook '%s' cannot be remote", point, h.Command))
+			}
+			for _, r := range h.Roles {
+				if !isValidRole(r) {
+					return maskAny(fmt.Errorf("%s hook '%s' has unknown role '%s'", point, h.Command, r))
+				}
+			}
+		}
+		return nil
+	}
+	if err := validate("beforeService", flags.BeforeService, false); err != nil {
+		return maskAny(err)
+	}
+	if err := validate("afterService", flags.AfterService, false); err != nil {
+		return maskAny(err)
+	}
+	if err := validate("beforeNode", flags.BeforeNode, true); err != nil {
+		return maskAny(err)
+	}
+	if err := validate("afterNode", flags.AfterNode, true); err != nil {
+		return maskAny(err)
+	}
+	if err := validate("onFailure", flags.OnFailure, true); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// appliesTo returns true if the hook must run in the given environment.
+func (h Hook) appliesTo(env hookEnv) bool {
+	if len(h.Services) > 0 && !containsString(h.Services, env.Service) {
+		return false
+	}
+	if len(h.Roles) > 0 && env.Node != nil {
+		found := false
+		for _, r := range h.Roles {
+			if env.Node.HasRole(r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// variables returns the environment variables passed to hook commands.
+func (env hookEnv) variables() map[string]string {
+	result := map[string]string{
+		"HELIX_PHASE":   env.Phase,
+		"HELIX_SERVICE": env.Service,
+	}
+	if env.Node != nil {
+		result["HELIX_NODE_NAME"] = env.Node.Name
+		result["HELIX_NODE_ADDRESS"] = env.Node.Address
+	}
+	if env.Err != nil {
+		result["HELIX_ERROR"] = env.Err.Error()
+	}
+	return result
+}
+
+// runHooks runs all given hooks that apply to the given environment.
+func runHooks(ctx context.Context, log zerolog.Logger, flags ServiceFlags, hooks []Hook, env hookEnv) error {
+	for _, h := range hooks {
+		if !h.appliesTo(env) {
+			continue
+		}
+		if err := h.run(ctx, log, flags.DryRun, env); err != nil {
+			return maskAny(err)
+		}
+	}
+	return nil
+}
+
+// runFailureHooks runs all failure hooks for the given error.
+// Errors of the hooks themselves are logged only.
+func runFailureHooks(ctx context.Context, log zerolog.Logger, flags ServiceFlags, sctx *ServiceContext, clients []util.SSHClient, env hookEnv, err error) {
+	if ctx.Err() != nil {
+		// The failure may be caused by a timeout or cancellation, give the hooks some time anyway.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), failureHookTimeout)
+		defer cancel()
+	}
+	env.Err = err
+	if serr, ok := errors.Cause(err).(*ServiceError); ok && serr.Node != "" {
+		for i, n := range sctx.nodes {
+			if n.Name == serr.Node {
+				env.Node = n
+				env.Client = clients[i]
+			}
+		}
+	}
+	if err := runHooks(ctx, log, flags, flags.Hooks.OnFailure, env); err != nil {
+		log.Warn().Err(err).Msg("Failure hook failed")
+	}
+}
+
+// run the command of the hook.
+func (h Hook) run(ctx context.Context, log zerolog.Logger, dryRun bool, env hookEnv) error {
+	vars := env.variables()
+	if h.Remote {
+		if env.Client == nil {
+			log.Warn().Msgf("Skipping remote hook '%s', no node available", h.Command)
+			return nil
+		}
+		var assignments []string
+		for k, v := range vars {
+			assignments = append(assignments, k+"="+util.ShellQuote(v))
+		}
+		sort.Strings(assignments)
+		cmd := strings.Join(assignments, " ") + " sh -c " + util.ShellQuote(h.Command)
+		if _, err := env.Client.Run(ctx, log, cmd, "", false); err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	if dryRun {
+		log.Info().Msgf("Will run locally: %s", h.Command)
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return maskAny(errors.Wrapf(err, "Hook '%s' failed: %s", h.Command, output.String()))
+	}
+	return nil
+}
+
+// containsString returns true if the given list contains the given value.
+func containsString(list []string, value string) bool {
+	for _, x := range list {
+		if x == value {
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,8 @@ package service
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/rs/zerolog"
 )
@@ -25,24 +27,73 @@ type Images struct {
 	CoreDNSVersion string
 	EtcdVersion    string
 	FlannelVersion string
+	CalicoVersion  string
+	HAProxyVersion string
+	Overrides      []ImageOverride // Custom images for specific components & architectures
 
-	k8sVersion string
+	k8sVersion      string
+	networkProvider string
+}
+
+// ImageOverride specifies a custom image (or download URL) for a component on a specific architecture.
+type ImageOverride struct {
+	Component    string // Name of the component (etcd|hyperkube|flannel|calico-node|calico-cni|calico-kube-controllers|haproxy|cni-plugins)
+	Architecture string // Architecture the image is used for
+	Image        string // Full image name (or download URL for cni-plugins)
 }
 
 const (
 	defaultEtcdVersion    = "3.2.17"
 	defaultFlannelVersion = "v0.9.1"
 	defaultCoreDNSVersion = "1.1.1"
+	defaultCalicoVersion  = "v3.1.3"
+	defaultHAProxyVersion = "1.8.9"
 
 	etcdImageTemplate      = "gcr.io/google-containers/etcd-%s:%s"
 	flannelImageTemplate   = "quay.io/coreos/flannel:%s-%s"
+	calicoImageTemplate    = "quay.io/calico/%s:%s"
 	hyperKubeImageTemplate = "gcr.io/google-containers/hyperkube-%s:%s"
 	coreDNSImageTemplate   = "coredns/coredns:%s"
+	haproxyImageTemplate   = "haproxy:%s-alpine"
+	cniPluginsURLTemplate  = "https://github.com/containernetworking/plugins/releases/download/v0.7.0/cni-plugins-%s-v0.7.0.tgz"
+
+	// Names of components used in image overrides
+	ComponentEtcd                  = "etcd"
+	ComponentHyperKube             = "hyperkube"
+	ComponentFlannel               = "flannel"
+	ComponentCalicoNode            = "calico-node"
+	ComponentCalicoCNI             = "calico-cni"
+	ComponentCalicoKubeControllers = "calico-kube-controllers"
+	ComponentHAProxy               = "haproxy"
+	ComponentCNIPlugins            = "cni-plugins"
+)
+
+var (
+	// Architectures for which upstream images are published (per component)
+	imageArchitectures = map[string][]string{
+		ComponentEtcd:       {"amd64", "arm", "arm64", "ppc64le", "s390x"},
+		ComponentHyperKube:  {"amd64", "arm", "arm64", "ppc64le", "s390x"},
+		ComponentFlannel:    {"amd64", "arm", "arm64", "ppc64le", "s390x"},
+		ComponentCNIPlugins: {"amd64", "arm", "arm64", "ppc64le", "s390x"},
+		ComponentHAProxy:    {"amd64", "arm", "arm64", "ppc64le", "s390x"},
+		// Calico publishes amd64 images without suffix, other architectures with an -<arch> suffix.
+		ComponentCalicoNode:            {"amd64", "arm64", "ppc64le"},
+		ComponentCalicoCNI:             {"amd64", "arm64", "ppc64le"},
+		ComponentCalicoKubeControllers: {"amd64", "arm64", "ppc64le"},
+	}
+	// Network provider that uses a component (used on all Kubernetes nodes)
+	imageNetworkProviders = map[string]string{
+		ComponentFlannel:               NetworkProviderFlannel,
+		ComponentCalicoNode:            NetworkProviderCalico,
+		ComponentCalicoCNI:             NetworkProviderCalico,
+		ComponentCalicoKubeControllers: NetworkProviderCalico,
+	}
 )
 
 // setupDefaults fills given flags with default value
-func (flags *Images) setupDefaults(log zerolog.Logger, k8sVersion string) error {
+func (flags *Images) setupDefaults(log zerolog.Logger, k8sVersion, networkProvider string) error {
 	flags.k8sVersion = k8sVersion
+	flags.networkProvider = networkProvider
 	if flags.CoreDNSVersion == "" {
 		flags.CoreDNSVersion = defaultCoreDNSVersion
 	}
@@ -52,25 +103,122 @@ func (flags *Images) setupDefaults(log zerolog.Logger, k8sVersion string) error
 	if flags.FlannelVersion == "" {
 		flags.FlannelVersion = defaultFlannelVersion
 	}
+	if flags.CalicoVersion == "" {
+		flags.CalicoVersion = defaultCalicoVersion
+	}
+	if flags.HAProxyVersion == "" {
+		flags.HAProxyVersion = defaultHAProxyVersion
+	}
+	for _, o := range flags.Overrides {
+		if _, found := imageArchitectures[o.Component]; !found {
+			return maskAny(fmt.Errorf("Unknown component '%s' in image override", o.Component))
+		}
+		if o.Architecture == "" || o.Image == "" {
+			return maskAny(fmt.Errorf("Image override for %s must have an architecture and an image", o.Component))
+		}
+	}
+	return nil
+}
+
+// ValidateNode checks that an image is available on the architecture of the given node
+// for all components that run on that node.
+func (flags Images) ValidateNode(sctx *ServiceContext, node Node) error {
+	components := []string{ComponentHyperKube}
+	if node.IsEtcdMember() {
+		components = append(components, ComponentEtcd)
+	}
+	if sctx.IsLoadBalancerNode(node) {
+		components = append(components, ComponentHAProxy)
+	}
+	if node.IsKubernetesNode() {
+		components = append(components, ComponentCNIPlugins)
+		for c, provider := range imageNetworkProviders {
+			if provider == flags.networkProvider {
+				components = append(components, c)
+			}
+		}
+	}
+	sort.Strings(components)
+	var missing []string
+	for _, c := range components {
+		if _, found := flags.override(c, node.Architecture); found {
+			continue
+		}
+		if !containsString(imageArchitectures[c], node.Architecture) {
+			missing = append(missing, c+"/"+node.Architecture)
+		}
+	}
+	if len(missing) > 0 {
+		return maskAny(fmt.Errorf("No images available for %s (used on node %s), add image overrides for them", strings.Join(missing, ", "), node.Name))
+	}
 	return nil
 }
 
+// override returns the custom image for the given component & architecture (if any).
+func (flags Images) override(component, architecture string) (string, bool) {
+	for _, o := range flags.Overrides {
+		if o.Component == component && o.Architecture == architecture {
+			return o.Image, true
+		}
+	}
+	return "", false
+}
+
 // CoreDNSImage returns the CoreDNS image name.
+// The upstream image is a multi-architecture image.
 func (flags Images) CoreDNSImage() string {
 	return fmt.Sprintf(coreDNSImageTemplate, flags.CoreDNSVersion)
 }
 
 // EtcdImage returns the ETCD image name.
 func (flags Images) EtcdImage(architecture string) string {
+	if image, found := flags.override(ComponentEtcd, architecture); found {
+		return image
+	}
 	return fmt.Sprintf(etcdImageTemplate, architecture, flags.EtcdVersion)
 }
 
 // FlannelImage returns the flannel image name.
 func (flags Images) FlannelImage(architecture string) string {
+	if image, found := flags.override(ComponentFlannel, architecture); found {
+		return image
+	}
 	return fmt.Sprintf(flannelImageTemplate, flags.FlannelVersion, architecture)
 }
 
+// CalicoImage returns the image name of the given calico component (calico-node|calico-cni|calico-kube-controllers).
+func (flags Images) CalicoImage(component, architecture string) string {
+	if image, found := flags.override(component, architecture); found {
+		return image
+	}
+	tag := flags.CalicoVersion
+	if architecture != "amd64" {
+		tag = tag + "-" + architecture
+	}
+	return fmt.Sprintf(calicoImageTemplate, strings.TrimPrefix(component, "calico-"), tag)
+}
+
+// HAProxyImage returns the haproxy image name.
+// The upstream image is a multi-architecture image.
+func (flags Images) HAProxyImage(architecture string) string {
+	if image, found := flags.override(ComponentHAProxy, architecture); found {
+		return image
+	}
+	return fmt.Sprintf(haproxyImageTemplate, flags.HAProxyVersion)
+}
+
 // HyperKubeImage returns the hyperkube image name.
 func (flags Images) HyperKubeImage(architecture string) string {
+	if image, found := flags.override(ComponentHyperKube, architecture); found {
+		return image
+	}
 	return fmt.Sprintf(hyperKubeImageTemplate, architecture, flags.k8sVersion)
 }
+
+// CNIPluginsURL returns the download URL of the CNI plugins archive.
+func (flags Images) CNIPluginsURL(architecture string) string {
+	if url, found := flags.override(ComponentCNIPlugins, architecture); found {
+		return url
+	}
+	return fmt.Sprintf(cniPluginsURLTemplate, architecture)
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// NodeSpec describes a single node in the inventory of the cluster.
+type NodeSpec struct {
+	Name            string            // Name of the node (used as Kubernetes node name)
+	Address         string            // IP address (or hostname) used to connect to the node
+	InternalAddress string            // IP address used for traffic within the cluster (defaults to Address)
+	Roles           []string          // Roles of the node (control-plane|worker|etcd|load-balancer), defaults to worker
+	Labels          map[string]string // Labels of the Kubernetes node
+	Taints          []Taint           // Taints of the Kubernetes node
+	Kubelet         Kubelet           // Kubelet settings that override the cluster wide kubelet settings
+}
+
+// Taint is a Kubernetes node taint.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string // NoSchedule|PreferNoSchedule|NoExecute
+}
+
+// String returns the taint in the format used by the kubelet (key=value:effect).
+func (t Taint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+const (
+	// MasterRoleLabel is the label (and taint key) of control-plane nodes.
+	MasterRoleLabel = "node-role.kubernetes.io/master"
+)
+
+// MasterTaint is the taint added to control-plane nodes by default.
+var MasterTaint = Taint{Key: MasterRoleLabel, Effect: "NoSchedule"}
+
+// KubernetesLabels returns the labels the Kubernetes node of this node must have.
+func (n Node) KubernetesLabels() map[string]string {
+	result := make(map[string]string)
+	if n.IsControlPlane {
+		result[MasterRoleLabel] = ""
+	}
+	for k, v := range n.Labels {
+		result[k] = v
+	}
+	return result
+}
+
+// KubernetesTaints returns the taints the Kubernetes node of this node must have.
+func (n Node) KubernetesTaints(cp ControlPlane) []Taint {
+	var result []Taint
+	if n.IsControlPlane && !cp.Schedulable {
+		result = append(result, MasterTaint)
+	}
+	for _, t := range n.Taints {
+		if !containsTaint(result, t) {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// containsTaint returns true if the given list contains the given taint.
+func containsTaint(list []Taint, t Taint) bool {
+	for _, x := range list {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatLabels returns the given labels in the format used by the kubelet (k1=v1,k2=v2), sorted by key.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// FormatTaints returns the given taints in the format used by the kubelet (k1=v1:e1,k2:e2).
+func FormatTaints(taints []Taint) string {
+	parts := make([]string, 0, len(taints))
+	for _, t := range taints {
+		parts = append(parts, t.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// validate checks the given node specification.
+func (n NodeSpec) validate() error {
+	if n.Name == "" {
+		return maskAny(fmt.Errorf("Node without name in inventory"))
+	}
+	if n.Address == "" {
+		return maskAny(fmt.Errorf("Node %s has no address", n.Name))
+	}
+	if n.InternalAddress != "" && net.ParseIP(n.InternalAddress) == nil {
+		return maskAny(fmt.Errorf("Internal address '%s' of node %s is not an IP address", n.InternalAddress, n.Name))
+	}
+	for _, r := range n.Roles {
+		if !isValidRole(r) {
+			return maskAny(fmt.Errorf("Node %s has unknown role '%s'", n.Name, r))
+		}
+	}
+	for _, t := range n.Taints {
+		if t.Key == "" {
+			return maskAny(fmt.Errorf("Node %s has a taint without key", n.Name))
+		}
+		switch t.Effect {
+		case "NoSchedule", "PreferNoSchedule", "NoExecute":
+			// OK
+		default:
+			return maskAny(fmt.Errorf("Taint %s of node %s has unknown effect '%s'", t.Key, n.Name, t.Effect))
+		}
+	}
+	if err := n.Kubelet.validate(); err != nil {
+		return maskAny(fmt.Errorf("Node %s: %v", n.Name, err))
+	}
+	return nil
+}
+
+// setupInventoryDefaults validates the given inventory.
+func setupInventoryDefaults(log zerolog.Logger, nodes []NodeSpec) error {
+	names := make(map[string]struct{})
+	addresses := make(map[string]struct{})
+	for _, n := range nodes {
+		if err := n.validate(); err != nil {
+			return maskAny(err)
+		}
+		name := strings.ToLower(n.Name)
+		if _, found := names[name]; found {
+			return maskAny(fmt.Errorf("Duplicate node name '%s' in inventory", n.Name))
+		}
+		names[name] = struct{}{}
+		if _, found := addresses[n.Address]; found {
+			return maskAny(fmt.Errorf("Duplicate node address '%s' in inventory", n.Address))
+		}
+		addresses[n.Address] = struct{}{}
+	}
+	return nil
+}
+
+// hasControlPlaneNodes returns true if the given inventory contains control-plane nodes.
+func hasControlPlaneNodes(nodes []NodeSpec) bool {
+	for _, n := range nodes {
+		if containsString(n.Roles, RoleControlPlane) {
+			return true
+		}
+	}
+	return false
+}
+
+// createInventoryNodes creates a list of Node objects for all nodes in the given inventory.
+// Addresses that are hostnames are resolved, preferring addresses of the given IP family.
+func createInventoryNodes(specs []NodeSpec, ipFamily string) ([]*Node, error) {
+	result := make([]*Node, 0, len(specs))
+	for _, spec := range specs {
+		address := spec.Address
+		if net.ParseIP(address) == nil {
+			addrs, err := net.LookupHost(address)
+			if err != nil {
+				return nil, maskAny(fmt.Errorf("Failed to resolve '%s': %v", address, err))
+			} else if len(addrs) == 0 {
+				return nil, maskAny(fmt.Errorf("Found no addresses for '%s'", address))
+			}
+			address = selectAddress(addrs, ipFamily)
+		}
+		roles := spec.Roles
+		if len(roles) == 0 {
+			roles = []string{RoleWorker}
+		}
+		result = append(result, &Node{
+			Name:            spec.Name,
+			Address:         address,
+			InternalAddress: spec.InternalAddress,
+			IsControlPlane:  containsString(roles, RoleControlPlane),
+			Roles:           roles,
+			Labels:          spec.Labels,
+			Taints:          spec.Taints,
+			Kubelet:         spec.Kubelet,
+			inInventory:     true,
+		})
+	}
+	return result, nil
+}
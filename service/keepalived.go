@@ -0,0 +1,56 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/rs/zerolog"
+)
+
+// Keepalived config (used to hold the virtual IP of the apiserver)
+type Keepalived struct {
+	Interface string // Network interface that holds the virtual IP (empty to detect per node from the route to the virtual IP)
+	RouterID  int    // VRRP virtual router ID (1-255), must be unique per LAN (0 to derive from the virtual IP)
+	Unicast   bool   // If set, VRRP advertisements are sent directly to the other nodes (for networks that block multicast)
+}
+
+const (
+	keepalivedPasswordLength = 8
+)
+
+// setupDefaults fills given flags with default value
+func (flags *Keepalived) setupDefaults(log zerolog.Logger, virtualIP string) error {
+	if virtualIP == "" {
+		return nil
+	}
+	ip := net.ParseIP(virtualIP)
+	if ip == nil {
+		return maskAny(fmt.Errorf("Virtual IP '%s' of the apiserver is not an IP address", virtualIP))
+	}
+	if flags.RouterID == 0 {
+		// Clusters on the same LAN use different virtual IPs, so the last byte
+		// distinguishes them (within a /24).
+		flags.RouterID = int(ip[len(ip)-1])
+		if flags.RouterID == 0 {
+			flags.RouterID = 1
+		}
+	}
+	if flags.RouterID < 1 || flags.RouterID > 255 {
+		return maskAny(fmt.Errorf("Invalid keepalived router ID %d, expected 1-255", flags.RouterID))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+// KubeProxy config (rendered into a KubeProxyConfiguration)
+type KubeProxy struct {
+	Mode                           string // Proxy mode (iptables|ipvs)
+	IPVSScheduler                  string // IPVS scheduler (rr|wrr|lc|wlc|lblc|lblcr|sh|dh|sed|nq), ipvs mode only
+	ConntrackMaxPerCore            int    // Maximum number of NAT connections to track per CPU core
+	ConntrackMin                   int    // Minimum number of conntrack entries to allocate
+	ConntrackTCPEstablishedTimeout string // Idle timeout of established TCP connections (e.g. 24h)
+	ConntrackTCPCloseWaitTimeout   string // Timeout of TCP connections in CLOSE_WAIT state (e.g. 1h)
+}
+
+const (
+	KubeProxyModeIPTables = "iptables"
+	KubeProxyModeIPVS     = "ipvs"
+
+	defaultKubeProxyMode                  = KubeProxyModeIPTables
+	defaultKubeProxyIPVSScheduler         = "rr"
+	defaultConntrackMaxPerCore            = 32768
+	defaultConntrackMin                   = 131072
+	defaultConntrackTCPEstablishedTimeout = "24h"
+	defaultConntrackTCPCloseWaitTimeout   = "1h"
+	// Minimum kubernetes version in which ipvs mode is enabled by default
+	minIPVSDefaultVersion = "v1.11.0"
+)
+
+var (
+	ipvsSchedulers = []string{"rr", "wrr", "lc", "wlc", "lblc", "lblcr", "sh", "dh", "sed", "nq"}
+)
+
+// setupDefaults fills given flags with default value
+func (flags *KubeProxy) setupDefaults(log zerolog.Logger) error {
+	if flags.Mode == "" {
+		flags.Mode = defaultKubeProxyMode
+	}
+	switch flags.Mode {
+	case KubeProxyModeIPTables, KubeProxyModeIPVS:
+		// OK
+	default:
+		return maskAny(fmt.Errorf("Unknown kube-proxy mode '%s', expected %s or %s", flags.Mode, KubeProxyModeIPTables, KubeProxyModeIPVS))
+	}
+	if flags.IPVSScheduler == "" {
+		flags.IPVSScheduler = defaultKubeProxyIPVSScheduler
+	}
+	if !containsString(ipvsSchedulers, flags.IPVSScheduler) {
+		return maskAny(fmt.Errorf("Unknown IPVS scheduler '%s'", flags.IPVSScheduler))
+	}
+	if flags.ConntrackMaxPerCore == 0 {
+		flags.ConntrackMaxPerCore = defaultConntrackMaxPerCore
+	}
+	if flags.ConntrackMin == 0 {
+		flags.ConntrackMin = defaultConntrackMin
+	}
+	if flags.ConntrackMaxPerCore < 0 || flags.ConntrackMin < 0 {
+		return maskAny(fmt.Errorf("Conntrack settings of kube-proxy must not be negative"))
+	}
+	if flags.ConntrackTCPEstablishedTimeout == "" {
+		flags.ConntrackTCPEstablishedTimeout = defaultConntrackTCPEstablishedTimeout
+	}
+	if flags.ConntrackTCPCloseWaitTimeout == "" {
+		flags.ConntrackTCPCloseWaitTimeout = defaultConntrackTCPCloseWaitTimeout
+	}
+	for _, d := range []string{flags.ConntrackTCPEstablishedTimeout, flags.ConntrackTCPCloseWaitTimeout} {
+		if _, err := time.ParseDuration(d); err != nil {
+			return maskAny(fmt.Errorf("Invalid kube-proxy conntrack timeout '%s': %v", d, err))
+		}
+	}
+	return nil
+}
+
+// IsIPVS returns true if kube-proxy runs in ipvs mode.
+func (flags KubeProxy) IsIPVS() bool {
+	return flags.Mode == KubeProxyModeIPVS
+}
+
+// KernelModules returns the kernel modules needed by kube-proxy.
+func (flags KubeProxy) KernelModules() []string {
+	if !flags.IsIPVS() {
+		return nil
+	}
+	result := []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+	if !containsString(result, "ip_vs_"+flags.IPVSScheduler) {
+		result = append(result, "ip_vs_"+flags.IPVSScheduler)
+	}
+	return result
+}
+
+// NeedsIPVSFeatureGate returns true if the SupportIPVSProxyMode feature gate must be enabled
+// for the given kubernetes version.
+func (flags KubeProxy) NeedsIPVSFeatureGate(k8sVersion string) bool {
+	return flags.IsIPVS() && util.CompareVersions(k8sVersion, minIPVSDefaultVersion) < 0
+}
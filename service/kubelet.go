@@ -0,0 +1,201 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Kubelet config (rendered into a KubeletConfiguration file)
+type Kubelet struct {
+	MaxPods                     int               // Maximum number of pods per node
+	EvictionHard                map[string]string // Hard eviction thresholds (signal -> quantity or percentage)
+	EvictionSoft                map[string]string // Soft eviction thresholds (signal -> quantity or percentage)
+	EvictionSoftGracePeriod     map[string]string // Grace period per soft eviction signal (e.g. 1m30s)
+	SystemReserved              map[string]string // Resources reserved for the OS (resource -> quantity)
+	KubeReserved                map[string]string // Resources reserved for the kubelet & container runtime (resource -> quantity)
+	ImageGCHighThresholdPercent int               // Disk usage after which image garbage collection is always run
+	ImageGCLowThresholdPercent  int               // Disk usage to which image garbage collection frees disk space
+	TLSMinVersion               string            // Minimum TLS version of the kubelet server (VersionTLS10..VersionTLS13)
+	TLSCipherSuites             []string          // Allowed TLS cipher suites of the kubelet server (empty for Go defaults)
+}
+
+const (
+	defaultKubeletMaxPods                     = 110
+	defaultKubeletImageGCHighThresholdPercent = 85
+	defaultKubeletImageGCLowThresholdPercent  = 80
+	defaultKubeletTLSMinVersion               = "VersionTLS12"
+)
+
+var (
+	defaultKubeletEvictionHard = map[string]string{
+		"memory.available":  "100Mi",
+		"nodefs.available":  "10%",
+		"nodefs.inodesFree": "5%",
+		"imagefs.available": "15%",
+	}
+	evictionSignals = []string{
+		"memory.available",
+		"nodefs.available",
+		"nodefs.inodesFree",
+		"imagefs.available",
+		"imagefs.inodesFree",
+		"pid.available",
+	}
+	reservableResources = []string{"cpu", "memory", "ephemeral-storage", "pid"}
+	tlsVersions         = []string{"VersionTLS10", "VersionTLS11", "VersionTLS12", "VersionTLS13"}
+)
+
+// setupDefaults fills given flags with default value
+func (flags *Kubelet) setupDefaults(log zerolog.Logger) error {
+	if flags.MaxPods == 0 {
+		flags.MaxPods = defaultKubeletMaxPods
+	}
+	if flags.EvictionHard == nil {
+		flags.EvictionHard = make(map[string]string)
+		for k, v := range defaultKubeletEvictionHard {
+			flags.EvictionHard[k] = v
+		}
+	}
+	if flags.ImageGCHighThresholdPercent == 0 {
+		flags.ImageGCHighThresholdPercent = defaultKubeletImageGCHighThresholdPercent
+	}
+	if flags.ImageGCLowThresholdPercent == 0 {
+		flags.ImageGCLowThresholdPercent = defaultKubeletImageGCLowThresholdPercent
+	}
+	if flags.TLSMinVersion == "" {
+		flags.TLSMinVersion = defaultKubeletTLSMinVersion
+	}
+	if err := flags.validate(); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// validate checks the kubelet settings.
+func (flags Kubelet) validate() error {
+	if flags.MaxPods < 0 {
+		return maskAny(fmt.Errorf("Invalid kubelet maxPods %d", flags.MaxPods))
+	}
+	for _, m := range []map[string]string{flags.EvictionHard, flags.EvictionSoft, flags.EvictionSoftGracePeriod} {
+		for k := range m {
+			if !containsString(evictionSignals, k) {
+				return maskAny(fmt.Errorf("Unknown kubelet eviction signal '%s', expected one of %s", k, strings.Join(evictionSignals, ", ")))
+			}
+		}
+	}
+	for k := range flags.EvictionSoft {
+		if _, found := flags.EvictionSoftGracePeriod[k]; !found {
+			return maskAny(fmt.Errorf("Kubelet soft eviction signal '%s' has no grace period", k))
+		}
+	}
+	for _, m := range []map[string]string{flags.SystemReserved, flags.KubeReserved} {
+		for k := range m {
+			if !containsString(reservableResources, k) {
+				return maskAny(fmt.Errorf("Unknown kubelet reserved resource '%s', expected one of %s", k, strings.Join(reservableResources, ", ")))
+			}
+		}
+	}
+	for _, p := range []int{flags.ImageGCHighThresholdPercent, flags.ImageGCLowThresholdPercent} {
+		if p < 0 || p > 100 {
+			return maskAny(fmt.Errorf("Invalid kubelet image GC threshold %d%%", p))
+		}
+	}
+	if flags.ImageGCHighThresholdPercent != 0 && flags.ImageGCLowThresholdPercent >= flags.ImageGCHighThresholdPercent {
+		return maskAny(fmt.Errorf("Kubelet imageGCLowThresholdPercent (%d) must be lower than imageGCHighThresholdPercent (%d)", flags.ImageGCLowThresholdPercent, flags.ImageGCHighThresholdPercent))
+	}
+	if flags.TLSMinVersion != "" && !containsString(tlsVersions, flags.TLSMinVersion) {
+		return maskAny(fmt.Errorf("Unknown kubelet TLS version '%s', expected one of %s", flags.TLSMinVersion, strings.Join(tlsVersions, ", ")))
+	}
+	return nil
+}
+
+// Merge returns a copy of the given settings with all non-empty fields of the given override applied.
+// Maps are merged per key.
+func (flags Kubelet) Merge(override Kubelet) Kubelet {
+	result := flags
+	if override.MaxPods != 0 {
+		result.MaxPods = override.MaxPods
+	}
+	result.EvictionHard = mergeStringMaps(flags.EvictionHard, override.EvictionHard)
+	result.EvictionSoft = mergeStringMaps(flags.EvictionSoft, override.EvictionSoft)
+	result.EvictionSoftGracePeriod = mergeStringMaps(flags.EvictionSoftGracePeriod, override.EvictionSoftGracePeriod)
+	result.SystemReserved = mergeStringMaps(flags.SystemReserved, override.SystemReserved)
+	result.KubeReserved = mergeStringMaps(flags.KubeReserved, override.KubeReserved)
+	if override.ImageGCHighThresholdPercent != 0 {
+		result.ImageGCHighThresholdPercent = override.ImageGCHighThresholdPercent
+	}
+	if override.ImageGCLowThresholdPercent != 0 {
+		result.ImageGCLowThresholdPercent = override.ImageGCLowThresholdPercent
+	}
+	if override.TLSMinVersion != "" {
+		result.TLSMinVersion = override.TLSMinVersion
+	}
+	if len(override.TLSCipherSuites) > 0 {
+		result.TLSCipherSuites = override.TLSCipherSuites
+	}
+	return result
+}
+
+// mergeStringMaps returns a new map containing all entries of a, overwritten by all entries of b.
+func mergeStringMaps(a, b map[string]string) map[string]string {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	result := make(map[string]string)
+	for k, v := range a {
+		result[k] = v
+	}
+	for k, v := range b {
+		result[k] = v
+	}
+	return result
+}
+
+// KubeletFor returns the kubelet settings for the given node.
+func (flags ServiceFlags) KubeletFor(node Node) (Kubelet, error) {
+	result := flags.Kubelet.Merge(node.Kubelet)
+	if err := result.validate(); err != nil {
+		return Kubelet{}, maskAny(fmt.Errorf("Node %s: %v", node.Name, err))
+	}
+	return result, nil
+}
+
+// FeatureGateMap returns the feature gates (name=bool) as a map, as used in component configuration files.
+// Gates without value are enabled.
+func (flags Kubernetes) FeatureGateMap() (map[string]bool, error) {
+	result := make(map[string]bool)
+	for _, gate := range flags.FeatureGates {
+		parts := strings.SplitN(gate, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			continue
+		}
+		enabled := true
+		if len(parts) == 2 {
+			var err error
+			enabled, err = strconv.ParseBool(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, maskAny(fmt.Errorf("Invalid value of feature gate '%s'", gate))
+			}
+		}
+		result[name] = enabled
+	}
+	return result, nil
+}
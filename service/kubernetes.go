@@ -16,28 +16,52 @@ package service
 
 import (
 	"fmt"
+	"net"
+	"strings"
 
 	"github.com/ericchiang/k8s"
 	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
 )
 
 // K8s config
 type Kubernetes struct {
 	Version               string
 	APIServerPort         int
-	ServiceClusterIPRange string
+	ServiceClusterIPRange string   // IP range(s) of services (comma separated, one per IP family for dual-stack)
+	PodNetworkCIDR        string   // IP range(s) from which pod IP addresses are allocated (comma separated, one per IP family for dual-stack)
+	NodeCIDRMaskSize      int      // Size of the IPv4 pod subnet (mask) allocated to every node
+	NodeCIDRMaskSizeIPv6  int      // Size of the IPv6 pod subnet (mask) allocated to every node
 	ClusterDNS            string   // IP address of DNS server
 	ClusterDomain         string   // Name of culster domain
 	FeatureGates          []string // List of activated feature gates
+	CgroupDriver          string   // Expected cgroup driver (cgroupfs|systemd), empty to use the driver of the container runtime
 	Metadata              string
 }
 
 const (
 	defaultKubernetesVersion     = "v1.10.0"
 	defaultServiceClusterIPRange = "10.71.0.0/16"
+	defaultPodNetworkCIDR        = "10.244.0.0/16"
+	defaultNodeCIDRMaskSize      = 24
+	defaultNodeCIDRMaskSizeIPv6  = 64
 	defaultAPIServerPort         = 6443
-	defaultClusterDNS            = "10.71.0.10"
 	defaultClusterDomain         = "cluster.local"
+
+	// Offset of the DNS server IP address in the service cluster IP range (10.71.0.10 by default)
+	clusterDNSIPOffset = 10
+	// Offset of the IP address of the kubernetes service in the service cluster IP range
+	apiServerServiceIPOffset = 1
+
+	IPFamilyIPv4 = "IPv4"
+	IPFamilyIPv6 = "IPv6"
+
+	// Minimum kubernetes version that supports dual-stack networking
+	minDualStackVersion = "v1.16.0"
+	// Minimum kubernetes version that has dual-stack networking enabled by default
+	minDualStackDefaultVersion = "v1.21.0"
+	dualStackFeatureGate       = "IPv6DualStack"
 )
 
 // setupDefaults fills given flags with default value
@@ -51,15 +75,231 @@ func (flags *Kubernetes) setupDefaults(log zerolog.Logger) error {
 	if flags.ServiceClusterIPRange == "" {
 		flags.ServiceClusterIPRange = defaultServiceClusterIPRange
 	}
-	if flags.ClusterDNS == "" {
-		flags.ClusterDNS = defaultClusterDNS
+	if flags.PodNetworkCIDR == "" {
+		flags.PodNetworkCIDR = defaultPodNetworkCIDR
+	}
+	if flags.NodeCIDRMaskSize == 0 {
+		flags.NodeCIDRMaskSize = defaultNodeCIDRMaskSize
+	}
+	if flags.NodeCIDRMaskSizeIPv6 == 0 {
+		flags.NodeCIDRMaskSizeIPv6 = defaultNodeCIDRMaskSizeIPv6
 	}
 	if flags.ClusterDomain == "" {
 		flags.ClusterDomain = defaultClusterDomain
 	}
+	switch flags.CgroupDriver {
+	case "", CgroupDriverCgroupfs, CgroupDriverSystemd:
+		// OK
+	default:
+		return maskAny(fmt.Errorf("Unknown cgroup driver '%s', expected %s or %s", flags.CgroupDriver, CgroupDriverCgroupfs, CgroupDriverSystemd))
+	}
+	if err := flags.validateNetworks(); err != nil {
+		return maskAny(err)
+	}
+	if flags.ClusterDNS == "" {
+		ip, err := nthIP(flags.ServiceClusterIPRanges()[0], clusterDNSIPOffset)
+		if err != nil {
+			return maskAny(err)
+		}
+		flags.ClusterDNS = ip.String()
+	}
+	if flags.IsDualStack() {
+		if util.CompareVersions(flags.Version, minDualStackVersion) < 0 {
+			return maskAny(fmt.Errorf("Dual-stack networking requires kubernetes %s or higher", minDualStackVersion))
+		}
+		if util.CompareVersions(flags.Version, minDualStackDefaultVersion) < 0 {
+			gates, err := flags.FeatureGateMap()
+			if err != nil {
+				return maskAny(err)
+			}
+			if _, found := gates[dualStackFeatureGate]; !found {
+				flags.FeatureGates = append(flags.FeatureGates, dualStackFeatureGate+"=true")
+			}
+		}
+	}
+	return nil
+}
+
+// ServiceClusterIPRanges returns the IP ranges of services, primary range first.
+func (flags Kubernetes) ServiceClusterIPRanges() []string {
+	return splitCIDRs(flags.ServiceClusterIPRange)
+}
+
+// PodNetworkCIDRs returns the IP ranges of pods, primary range first.
+func (flags Kubernetes) PodNetworkCIDRs() []string {
+	return splitCIDRs(flags.PodNetworkCIDR)
+}
+
+// PodNetworkCIDRFor returns the IP range of pods of the given IP family (IPv4|IPv6),
+// or an empty string if the pod network has no such range.
+func (flags Kubernetes) PodNetworkCIDRFor(ipFamily string) string {
+	for _, cidr := range flags.PodNetworkCIDRs() {
+		if ip, _, err := net.ParseCIDR(cidr); err == nil && ipFamilyOf(ip) == ipFamily {
+			return cidr
+		}
+	}
+	return ""
+}
+
+// IsDualStack returns true if the cluster uses both IPv4 & IPv6.
+func (flags Kubernetes) IsDualStack() bool {
+	return len(flags.PodNetworkCIDRs()) > 1 || len(flags.ServiceClusterIPRanges()) > 1
+}
+
+// IPFamily returns the primary IP family (IPv4|IPv6) of the cluster.
+func (flags Kubernetes) IPFamily() string {
+	if ranges := flags.ServiceClusterIPRanges(); len(ranges) > 0 {
+		if ip, _, err := net.ParseCIDR(ranges[0]); err == nil {
+			return ipFamilyOf(ip)
+		}
+	}
+	return IPFamilyIPv4
+}
+
+// APIServerServiceIP returns the IP address of the kubernetes service
+// (the first address of the primary service cluster IP range).
+func (flags Kubernetes) APIServerServiceIP() (net.IP, error) {
+	ip, err := nthIP(flags.ServiceClusterIPRanges()[0], apiServerServiceIPOffset)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	return ip, nil
+}
+
+// NodeCIDRMaskSizeFor returns the size of the pod subnet allocated to every node
+// for the IP family of the given pod network CIDR.
+func (flags Kubernetes) NodeCIDRMaskSizeFor(cidr string) int {
+	if ip, _, err := net.ParseCIDR(cidr); err == nil && ipFamilyOf(ip) == IPFamilyIPv6 {
+		return flags.NodeCIDRMaskSizeIPv6
+	}
+	return flags.NodeCIDRMaskSize
+}
+
+// validateNetworks checks the pod network & service IP ranges.
+func (flags Kubernetes) validateNetworks() error {
+	serviceNets, err := parseCIDRs("service cluster IP range", flags.ServiceClusterIPRange)
+	if err != nil {
+		return maskAny(err)
+	}
+	podNets, err := parseCIDRs("pod network CIDR", flags.PodNetworkCIDR)
+	if err != nil {
+		return maskAny(err)
+	}
+	if len(serviceNets) > 1 && len(podNets) < 2 {
+		return maskAny(fmt.Errorf("Dual-stack service cluster IP range %s requires a dual-stack pod network CIDR", flags.ServiceClusterIPRange))
+	}
+	if ipFamilyOf(podNets[0].IP) != ipFamilyOf(serviceNets[0].IP) {
+		return maskAny(fmt.Errorf("Primary pod network CIDR %s and primary service cluster IP range %s must have the same IP family", podNets[0], serviceNets[0]))
+	}
+	for _, podNet := range podNets {
+		for _, serviceNet := range serviceNets {
+			if networksOverlap(podNet, serviceNet) {
+				return maskAny(fmt.Errorf("Pod network CIDR %s overlaps with service cluster IP range %s", podNet, serviceNet))
+			}
+		}
+		podPrefix, bits := podNet.Mask.Size()
+		maskSize := flags.NodeCIDRMaskSizeFor(podNet.String())
+		if maskSize < podPrefix || maskSize > bits {
+			return maskAny(fmt.Errorf("Node CIDR mask size %d must be between %d and %d for pod network CIDR %s", maskSize, podPrefix, bits, podNet))
+		}
+	}
+	return nil
+}
+
+// validateNodeAddresses checks that the addresses of the given nodes are not part of the pod network.
+func (flags Kubernetes) validateNodeAddresses(nodes []*Node) error {
+	podNets, err := parseCIDRs("pod network CIDR", flags.PodNetworkCIDR)
+	if err != nil {
+		return maskAny(err)
+	}
+	for _, n := range nodes {
+		for _, addr := range []string{n.Address, n.InternalAddress} {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+			for _, podNet := range podNets {
+				if podNet.Contains(ip) {
+					return maskAny(fmt.Errorf("Address %s of node %s is part of the pod network CIDR %s", addr, n.Name, podNet))
+				}
+			}
+		}
+	}
 	return nil
 }
 
+// splitCIDRs splits a comma separated list of CIDRs.
+func splitCIDRs(list string) []string {
+	var result []string
+	for _, x := range strings.Split(list, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+// parseCIDRs parses a comma separated list of CIDRs, containing at most one CIDR per IP family.
+func parseCIDRs(kind, list string) ([]*net.IPNet, error) {
+	cidrs := splitCIDRs(list)
+	if len(cidrs) == 0 {
+		return nil, maskAny(fmt.Errorf("Empty %s", kind))
+	}
+	if len(cidrs) > 2 {
+		return nil, maskAny(fmt.Errorf("Invalid %s '%s': expected at most 2 CIDRs", kind, list))
+	}
+	var result []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, maskAny(fmt.Errorf("Invalid %s '%s': %v", kind, cidr, err))
+		}
+		result = append(result, ipNet)
+	}
+	if len(result) == 2 && ipFamilyOf(result[0].IP) == ipFamilyOf(result[1].IP) {
+		return nil, maskAny(fmt.Errorf("Invalid %s '%s': dual-stack requires one IPv4 and one IPv6 CIDR", kind, list))
+	}
+	return result, nil
+}
+
+// ipFamilyOf returns the IP family (IPv4|IPv6) of the given address.
+func ipFamilyOf(ip net.IP) string {
+	if ip.To4() != nil {
+		return IPFamilyIPv4
+	}
+	return IPFamilyIPv6
+}
+
+// nthIP returns the n'th IP address of the given network.
+func nthIP(cidr string, n int) (net.IP, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	ip := ipNet.IP.To4()
+	if ip == nil {
+		ip = ipNet.IP.To16()
+	}
+	result := make(net.IP, len(ip))
+	copy(result, ip)
+	// Add n to the network address, starting at the last byte
+	carry := n
+	for i := len(result) - 1; i >= 0 && carry > 0; i-- {
+		sum := int(result[i]) + carry
+		result[i] = byte(sum & 0xff)
+		carry = sum >> 8
+	}
+	if !ipNet.Contains(result) {
+		return nil, maskAny(fmt.Errorf("Network %s is too small to contain address #%d", cidr, n))
+	}
+	return result, nil
+}
+
+// networksOverlap returns true if the given networks have addresses in common.
+func networksOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
 // NewKubernetesClient creates a client from the outside to the k8s cluster
 func NewKubernetesClient(sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) (*k8s.Client, error) {
 	cert, key, err := deps.KubernetesCA.CreateTLSClientAuthCertificate("kubernetes-admin", "system:masters", nil)
@@ -71,7 +311,7 @@ func NewKubernetesClient(sctx *ServiceContext, deps ServiceDependencies, flags S
 			k8s.NamedCluster{
 				Name: "k8s",
 				Cluster: k8s.Cluster{
-					Server: fmt.Sprintf("https://%s:6443", sctx.GetAPIServer()),
+					Server: sctx.GetAPIServerURL(),
 					CertificateAuthorityData: []byte(deps.KubernetesCA.Cert()),
 				},
 			},
@@ -0,0 +1,231 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	auditConfigDir         = "/etc/kubernetes/audit"
+	auditPolicyName        = "policy.yaml"
+	auditWebhookConfigName = "webhook.kubeconfig"
+	auditWebhookCAName     = "webhook-ca.crt"
+	auditLogName           = "audit.log"
+
+	// Version from which audit.k8s.io/v1 is available
+	minAuditV1Version = "v1.12.0"
+)
+
+var (
+	// Rules of the audit policy that follow the user provided rules
+	defaultAuditRules = []service.AuditRule{
+		// Frequent, low-risk requests
+		{
+			Level:     "None",
+			Users:     []string{"system:kube-proxy"},
+			Verbs:     []string{"watch"},
+			Resources: []service.AuditGroupResource{{Resources: []string{"endpoints", "services", "services/status"}}},
+		},
+		{
+			Level:      "None",
+			Users:      []string{"system:kube-controller-manager", "system:kube-scheduler"},
+			Verbs:      []string{"get", "update"},
+			Namespaces: []string{"kube-system"},
+			Resources:  []service.AuditGroupResource{{Resources: []string{"endpoints"}}},
+		},
+		{
+			Level:           "None",
+			NonResourceURLs: []string{"/healthz*", "/version", "/swagger*"},
+		},
+		{
+			Level:     "None",
+			Resources: []service.AuditGroupResource{{Resources: []string{"events"}}},
+		},
+		// Requests & responses of these resources can contain sensitive data
+		{
+			Level: "Metadata",
+			Resources: []service.AuditGroupResource{
+				{Resources: []string{"secrets", "configmaps"}},
+				{Group: "authentication.k8s.io", Resources: []string{"tokenreviews"}},
+			},
+		},
+		// Reads
+		{
+			Level: "Metadata",
+			Verbs: []string{"get", "list", "watch"},
+		},
+		// Everything else
+		{
+			Level: "Request",
+		},
+	}
+)
+
+// auditConfig holds the content of the audit configuration files.
+type auditConfig struct {
+	Policy        string // Content of the audit policy file
+	WebhookConfig string // Content of the webhook kubeconfig file (if any)
+	WebhookCA     string // Content of the webhook CA certificate file (if any)
+	Hash          string // Hash of the configuration files
+}
+
+// createAuditConfig creates the audit configuration files and adds the audit arguments.
+func createAuditConfig(flags service.ServiceFlags, args map[string]string) auditConfig {
+	audit := flags.Audit
+	apiVersion := "audit.k8s.io/v1"
+	if util.CompareVersions(flags.Kubernetes.Version, minAuditV1Version) < 0 {
+		apiVersion = "audit.k8s.io/v1beta1"
+	}
+	rules := append(append([]service.AuditRule{}, audit.Rules...), defaultAuditRules...)
+	result := auditConfig{Policy: createAuditPolicy(apiVersion, rules)}
+
+	args["audit-policy-file"] = filepath.Join(auditConfigDir, auditPolicyName)
+	args["audit-log-path"] = filepath.Join(audit.LogDir, auditLogName)
+	args["audit-log-maxage"] = strconv.Itoa(audit.MaxAge)
+	args["audit-log-maxbackup"] = strconv.Itoa(audit.MaxBackup)
+	args["audit-log-maxsize"] = strconv.Itoa(audit.MaxSize)
+
+	if audit.Webhook.IsEnabled() {
+		result.WebhookCA = audit.Webhook.CA()
+		caFile := ""
+		if result.WebhookCA != "" {
+			caFile = filepath.Join(auditConfigDir, auditWebhookCAName)
+		}
+		result.WebhookConfig = createAuditWebhookConfig(audit.Webhook.Server, caFile)
+		args["audit-webhook-config-file"] = filepath.Join(auditConfigDir, auditWebhookConfigName)
+		args["audit-webhook-mode"] = audit.Webhook.Mode
+	}
+	result.Hash = fmt.Sprintf("%x", sha1.Sum([]byte(result.Policy+result.WebhookConfig+result.WebhookCA)))
+
+	return result
+}
+
+// createAuditPolicy returns the content of an audit policy file containing the given rules.
+// All values are quoted, since they are user provided.
+func createAuditPolicy(apiVersion string, rules []service.AuditRule) string {
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "apiVersion: %s\n", apiVersion)
+	fmt.Fprintln(w, "kind: Policy")
+	fmt.Fprintln(w, "omitStages:")
+	fmt.Fprintln(w, "- RequestReceived")
+	fmt.Fprintln(w, "rules:")
+	writeList := func(indent, key string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = strconv.Quote(v)
+		}
+		fmt.Fprintf(w, "%s%s: [%s]\n", indent, key, strings.Join(quoted, ", "))
+	}
+	for _, r := range rules {
+		fmt.Fprintf(w, "- level: %s\n", strconv.Quote(r.Level))
+		writeList("  ", "users", r.Users)
+		writeList("  ", "userGroups", r.UserGroups)
+		writeList("  ", "verbs", r.Verbs)
+		if len(r.Resources) > 0 {
+			fmt.Fprintln(w, "  resources:")
+			for _, gr := range r.Resources {
+				fmt.Fprintf(w, "  - group: %s\n", strconv.Quote(gr.Group))
+				writeList("    ", "resources", gr.Resources)
+				writeList("    ", "resourceNames", gr.ResourceNames)
+			}
+		}
+		writeList("  ", "namespaces", r.Namespaces)
+		writeList("  ", "nonResourceURLs", r.NonResourceURLs)
+		writeList("  ", "omitStages", r.OmitStages)
+	}
+	return w.String()
+}
+
+// createAuditWebhookConfig returns the content of a kubeconfig file
+// used by the apiserver to send audit events to the given server.
+func createAuditWebhookConfig(server, caFile string) string {
+	w := &bytes.Buffer{}
+	fmt.Fprintln(w, "apiVersion: v1")
+	fmt.Fprintln(w, "kind: Config")
+	fmt.Fprintln(w, "clusters:")
+	fmt.Fprintln(w, "- name: audit-webhook")
+	fmt.Fprintln(w, "  cluster:")
+	fmt.Fprintf(w, "    server: %s\n", strconv.Quote(server))
+	if caFile != "" {
+		fmt.Fprintf(w, "    certificate-authority: %s\n", strconv.Quote(caFile))
+	}
+	fmt.Fprintln(w, "contexts:")
+	fmt.Fprintln(w, "- name: audit-webhook")
+	fmt.Fprintln(w, "  context:")
+	fmt.Fprintln(w, "    cluster: audit-webhook")
+	fmt.Fprintln(w, "    user: audit-webhook")
+	fmt.Fprintln(w, "current-context: audit-webhook")
+	fmt.Fprintln(w, "users:")
+	fmt.Fprintln(w, "- name: audit-webhook")
+	fmt.Fprintln(w, "  user: {}")
+	return w.String()
+}
+
+// uploadAuditConfig uploads the audit configuration files to the machine,
+// or removes them when audit logging is disabled.
+func uploadAuditConfig(ctx context.Context, log zerolog.Logger, client util.SSHClient, flags service.ServiceFlags, cfg auditConfig) error {
+	if !flags.Audit.Enabled {
+		return maskAny(removeAuditConfig(ctx, log, client))
+	}
+	log.Info().Msg("Uploading audit configuration")
+	if err := client.EnsureDirectory(ctx, log, auditConfigDir, 0755); err != nil {
+		return maskAny(err)
+	}
+	if err := client.EnsureDirectory(ctx, log, flags.Audit.LogDir, 0700); err != nil {
+		return maskAny(err)
+	}
+	if err := client.UpdateFile(ctx, log, filepath.Join(auditConfigDir, auditPolicyName), []byte(cfg.Policy), manifestFileMode); err != nil {
+		return maskAny(err)
+	}
+	files := map[string]string{
+		auditWebhookConfigName: cfg.WebhookConfig,
+		auditWebhookCAName:     cfg.WebhookCA,
+	}
+	for name, content := range files {
+		filePath := filepath.Join(auditConfigDir, name)
+		if content != "" {
+			if err := client.UpdateFile(ctx, log, filePath, []byte(content), keyFileMode); err != nil {
+				return maskAny(err)
+			}
+		} else if err := client.RemoveFile(ctx, log, filePath); err != nil {
+			return maskAny(err)
+		}
+	}
+	return nil
+}
+
+// removeAuditConfig removes the audit configuration files from the machine.
+// Audit logs are kept.
+func removeAuditConfig(ctx context.Context, log zerolog.Logger, client util.SSHClient) error {
+	if err := client.RemoveDirectory(ctx, log, auditConfigDir); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiserver
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	// EncryptionConfigHashAnnotation is the annotation of the apiserver pod
+	// that holds the hash of its encryption configuration.
+	EncryptionConfigHashAnnotation = "helix.pulcy.com/encryption-config-hash"
+
+	encryptionConfigDir  = "/etc/kubernetes/encryption"
+	encryptionConfigName = "config.yaml"
+)
+
+// encryptionConfig holds the rendered encryption configuration.
+type encryptionConfig struct {
+	Config string // Content of the encryption configuration file (empty if there are no keys)
+	Hash   string // Hash of the encryption configuration
+}
+
+// uploadEncryptionConfig uploads the encryption configuration to the machine,
+// or removes it when there are no encryption keys.
+func uploadEncryptionConfig(ctx context.Context, log zerolog.Logger, client util.SSHClient, cfg encryptionConfig) error {
+	if cfg.Config == "" {
+		return maskAny(removeEncryptionConfig(ctx, log, client))
+	}
+	log.Info().Msg("Uploading encryption configuration")
+	if err := client.EnsureDirectory(ctx, log, encryptionConfigDir, 0700); err != nil {
+		return maskAny(err)
+	}
+	if err := client.UpdateFile(ctx, log, filepath.Join(encryptionConfigDir, encryptionConfigName), []byte(cfg.Config), keyFileMode); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// removeEncryptionConfig removes the encryption configuration from the machine.
+func removeEncryptionConfig(ctx context.Context, log zerolog.Logger, client util.SSHClient) error {
+	if err := client.RemoveDirectory(ctx, log, encryptionConfigDir); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
@@ -15,9 +15,11 @@
 package apiserver
 
 import (
-	"net"
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -25,6 +27,7 @@ import (
 	"github.com/pulcy/helix/service"
 	"github.com/pulcy/helix/service/etcd"
 	"github.com/pulcy/helix/service/kubernetes/component"
+	"github.com/pulcy/helix/service/kubernetes/kubeletauth"
 	"github.com/pulcy/helix/util"
 )
 
@@ -35,6 +38,11 @@ var (
 const (
 	manifestPath = "/etc/kubernetes/manifests/kube-apiserver.yaml"
 
+	// Version from which --admission-control is deprecated in favor of --enable-admission-plugins
+	minEnableAdmissionPluginsVersion = "v1.10.0"
+	// Version from which the Initializers admission plugin no longer exists
+	minNoInitializersVersion = "v1.14.0"
+
 	manifestFileMode = os.FileMode(0644)
 	certFileMode     = os.FileMode(0644)
 	keyFileMode      = os.FileMode(0600)
@@ -52,13 +60,18 @@ func (t *apiserverService) Name() string {
 	return "kube-apiserver"
 }
 
-func (t *apiserverService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+// IsDisruptive returns true.
+func (t *apiserverService) IsDisruptive() bool {
+	return true
+}
+
+func (t *apiserverService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.Component.Name = "apiserver"
 	return nil
 }
 
 // InitMachine configures the machine to run apiserver.
-func (t *apiserverService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *apiserverService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Setup apiserver on this host?
@@ -73,18 +86,19 @@ func (t *apiserverService) InitMachine(node service.Node, client util.SSHClient,
 	}
 
 	// Create & Upload certificates
-	ip, _, err := net.ParseCIDR(flags.Kubernetes.ServiceClusterIPRange)
+	ip, err := flags.Kubernetes.APIServerServiceIP()
 	if err != nil {
 		return maskAny(err)
 	}
-	ip[len(ip)-1] = 1
 	altNames := []string{
 		"127.0.0.1",
+		"::1",
 		ip.String(),
 		"kubernetes.default.svc." + flags.Kubernetes.ClusterDomain,
 		"kubernetes.default.svc",
 		"kubernetes.default",
 		"kubernetes",
+		node.GetInternalAddress(),
 	}
 	if flags.ControlPlane.APIServerVirtualIP != "" {
 		altNames = append(altNames, flags.ControlPlane.APIServerVirtualIP)
@@ -92,8 +106,12 @@ func (t *apiserverService) InitMachine(node service.Node, client util.SSHClient,
 	if flags.ControlPlane.APIServerDNSName != "" {
 		altNames = append(altNames, flags.ControlPlane.APIServerDNSName)
 	}
+	// Clients can reach every apiserver through every load-balancer node
+	for _, n := range sctx.LoadBalancerNodes() {
+		altNames = append(altNames, n.Address)
+	}
 	log.Info().Strs("alt-names", altNames).Msg("apiserver.crt/key")
-	if err := t.Component.UploadCertificates("kubernetes", "Kubernetes API Server", client, deps, altNames...); err != nil {
+	if err := t.Component.UploadCertificates(ctx, "kubernetes", "Kubernetes API Server", client, deps, altNames...); err != nil {
 		return maskAny(err)
 	}
 
@@ -103,10 +121,10 @@ func (t *apiserverService) InitMachine(node service.Node, client util.SSHClient,
 	if err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.ProxyClientCertFile, []byte(proxyCert), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.ProxyClientCertFile, []byte(proxyCert), certFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.ProxyClientKeyFile, []byte(proxyKey), keyFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.ProxyClientKeyFile, []byte(proxyKey), keyFileMode); err != nil {
 		return maskAny(err)
 	}
 
@@ -116,29 +134,39 @@ func (t *apiserverService) InitMachine(node service.Node, client util.SSHClient,
 	if err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.EtcdCertFile, []byte(etcdCert), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.EtcdCertFile, []byte(etcdCert), certFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.EtcdKeyFile, []byte(etcdKey), keyFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.EtcdKeyFile, []byte(etcdKey), keyFileMode); err != nil {
 		return maskAny(err)
 	}
 
 	// Create & Upload apiserver-kubelet client certificate
 	log.Info().Msg("Uploading apiserver-kubelet-client Certificates")
-	kubeletCert, kubeletKey, err := deps.KubernetesCA.CreateTLSClientAuthCertificate("kubernetes", "system:masters", client)
+	kubeletCert, kubeletKey, err := deps.KubernetesCA.CreateTLSClientAuthCertificate(kubeletauth.KubeletAPIClientUser, "Kubernetes API Server", client)
 	if err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.KubeletCertFile, []byte(kubeletCert), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, cfg.KubeletCertFile, []byte(kubeletCert), certFileMode); err != nil {
+		return maskAny(err)
+	}
+	if err := client.UpdateFile(ctx, log, cfg.KubeletKeyFile, []byte(kubeletKey), keyFileMode); err != nil {
+		return maskAny(err)
+	}
+
+	// Create & Upload audit configuration
+	if err := uploadAuditConfig(ctx, log, client, flags, cfg.Audit); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, cfg.KubeletKeyFile, []byte(kubeletKey), keyFileMode); err != nil {
+
+	// Create & Upload encryption configuration
+	if err := uploadEncryptionConfig(ctx, log, client, cfg.Encryption); err != nil {
 		return maskAny(err)
 	}
 
 	// Create manifest
 	log.Info().Msg("Creating kube-apiserver manifest")
-	if err := createManifest(client, deps, cfg); err != nil {
+	if err := createManifest(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
@@ -146,7 +174,7 @@ func (t *apiserverService) InitMachine(node service.Node, client util.SSHClient,
 }
 
 // ResetMachine removes kube-apiserver from the machine.
-func (t *apiserverService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *apiserverService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	cfg, err := t.createConfig(node, client, sctx, deps, flags)
@@ -155,28 +183,38 @@ func (t *apiserverService) ResetMachine(node service.Node, client util.SSHClient
 	}
 
 	// Remove  manifest
-	if err := client.RemoveFile(log, manifestPath); err != nil {
+	if err := client.RemoveFile(ctx, log, manifestPath); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove certificates
-	if err := t.Component.RemoveCertificates(client, deps); err != nil {
+	if err := t.Component.RemoveCertificates(ctx, client, deps); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove front proxy certificates
-	if err := client.RemoveFile(log, cfg.ProxyClientCertFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.ProxyClientCertFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.ProxyClientKeyFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.ProxyClientKeyFile); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove kubelet certificates
-	if err := client.RemoveFile(log, cfg.KubeletCertFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.KubeletCertFile); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.KubeletKeyFile); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.KubeletKeyFile); err != nil {
+		return maskAny(err)
+	}
+
+	// Remove audit configuration
+	if err := removeAuditConfig(ctx, log, client); err != nil {
+		return maskAny(err)
+	}
+
+	// Remove encryption configuration
+	if err := removeEncryptionConfig(ctx, log, client); err != nil {
 		return maskAny(err)
 	}
 
@@ -184,61 +222,124 @@ func (t *apiserverService) ResetMachine(node service.Node, client util.SSHClient
 }
 
 type config struct {
-	Image                  string // HyperKube docker images
-	PodName                string
-	ServiceClusterIPRange  string
-	ClusterDomain          string
-	PkiDir                 string
-	EtcdEndpoints          string
-	EtcdKeyFile            string
-	EtcdCertFile           string
-	EtcdCAFile             string
-	FeatureGates           string // Feature gates to use
-	APIServerCertFile      string // File containing x509 Certificate used for serving HTTPS (with intermediate certs, if any, concatenated after server cert).
-	APIServerKeyFile       string // File containing x509 private key matching CertPath
-	ClientCAFile           string // Path of --client-ca-file
-	KubeletKeyFile         string
-	KubeletCertFile        string
-	KubeletCAFile          string
-	ProxyClientKeyFile     string
-	ProxyClientCertFile    string
-	ProxyClientCAFile      string
-	ProxyClientCAKeyFile   string
-	ServiceAccountCertFile string
+	Image                string                  // HyperKube docker images
+	PodName              string                  // Name of the static pod
+	PkiDir               string                  // Directory containing certificates
+	SecurePort           int                     // Port serving HTTPS
+	EtcdKeyFile          string                  // Client key used to connect to etcd
+	EtcdCertFile         string                  // Client certificate used to connect to etcd
+	KubeletKeyFile       string                  // Client key used to connect to kubelets
+	KubeletCertFile      string                  // Client certificate used to connect to kubelets
+	ProxyClientKeyFile   string                  // Client key of the front proxy
+	ProxyClientCertFile  string                  // Client certificate of the front proxy
+	ProxyClientCAKeyFile string                  // Key of the CA used to sign the front proxy certificate
+	Audit                auditConfig             // Audit configuration files (if audit logging is enabled)
+	AuditConfigDir       string                  // Directory containing the audit configuration files
+	AuditLogDir          string                  // Directory containing the audit log
+	Encryption           encryptionConfig        // Encryption configuration (if there are encryption keys)
+	EncryptionConfigDir  string                  // Directory containing the encryption configuration
+	Args                 []string                // Command line arguments (defaults merged with extra arguments)
+	ExtraVolumes         []service.HostPathMount // Additional host paths to mount
+	Resources            service.Resources       // Resource requests & limits
 }
 
 func (t *apiserverService) createConfig(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
 	certDir := t.Component.CertDir()
 	result := config{
-		Image:                  flags.Images.HyperKubeImage(node.Architecture),
-		PodName:                "kube-apiserver-" + node.Name,
-		ServiceClusterIPRange:  flags.Kubernetes.ServiceClusterIPRange,
-		ClusterDomain:          flags.Kubernetes.ClusterDomain,
-		PkiDir:                 t.Component.CertDir(),
-		EtcdEndpoints:          flags.Etcd.CreateClientEndpoints(sctx),
-		EtcdCertFile:           filepath.Join(certDir, "apiserver-etcd-client.crt"),
-		EtcdKeyFile:            filepath.Join(certDir, "apiserver-etcd-client.key"),
-		EtcdCAFile:             filepath.Join(etcd.CertsDir, etcd.ClientCAFileName),
-		FeatureGates:           strings.Join(flags.Kubernetes.FeatureGates, ","),
-		APIServerCertFile:      t.CertPath(),
-		APIServerKeyFile:       t.KeyPath(),
-		ClientCAFile:           t.CACertPath(),
-		KubeletKeyFile:         filepath.Join(certDir, "apiserver-kubelet-client.key"),
-		KubeletCertFile:        filepath.Join(certDir, "apiserver-kubelet-client.crt"),
-		KubeletCAFile:          t.CACertPath(),
-		ProxyClientKeyFile:     filepath.Join(certDir, "front-proxy.key"),
-		ProxyClientCertFile:    filepath.Join(certDir, "front-proxy.crt"),
-		ProxyClientCAFile:      t.CACertPath(),
-		ProxyClientCAKeyFile:   t.CAKeyPath(),
-		ServiceAccountCertFile: t.SACertPath(),
+		Image:                flags.Images.HyperKubeImage(node.Architecture),
+		PodName:              "kube-apiserver-" + node.Name,
+		PkiDir:               certDir,
+		SecurePort:           service.APIServerPort,
+		EtcdCertFile:         filepath.Join(certDir, "apiserver-etcd-client.crt"),
+		EtcdKeyFile:          filepath.Join(certDir, "apiserver-etcd-client.key"),
+		KubeletKeyFile:       filepath.Join(certDir, "apiserver-kubelet-client.key"),
+		KubeletCertFile:      filepath.Join(certDir, "apiserver-kubelet-client.crt"),
+		ProxyClientKeyFile:   filepath.Join(certDir, "front-proxy.key"),
+		ProxyClientCertFile:  filepath.Join(certDir, "front-proxy.crt"),
+		ProxyClientCAKeyFile: t.CAKeyPath(),
+	}
+	args := map[string]string{
+		"advertise-address":                  "$(PUBLIC_IP)",
+		"allow-privileged":                   "true",
+		"authorization-mode":                 "Node,RBAC",
+		"client-ca-file":                     t.CACertPath(),
+		"enable-bootstrap-token-auth":        "true",
+		"endpoint-reconciler-type":           "lease",
+		"etcd-cafile":                        filepath.Join(etcd.CertsDir, etcd.ClientCAFileName),
+		"etcd-certfile":                      result.EtcdCertFile,
+		"etcd-keyfile":                       result.EtcdKeyFile,
+		"etcd-servers":                       flags.Etcd.CreateClientEndpoints(sctx),
+		"feature-gates":                      strings.Join(flags.Kubernetes.FeatureGates, ","),
+		"kubelet-certificate-authority":      t.CACertPath(),
+		"kubelet-client-certificate":         result.KubeletCertFile,
+		"kubelet-client-key":                 result.KubeletKeyFile,
+		"kubelet-https":                      "true",
+		"kubelet-preferred-address-types":    "InternalIP,ExternalIP,Hostname",
+		"proxy-client-cert-file":             result.ProxyClientCertFile,
+		"proxy-client-key-file":              result.ProxyClientKeyFile,
+		"requestheader-allowed-names":        "",
+		"requestheader-client-ca-file":       t.CACertPath(),
+		"requestheader-extra-headers-prefix": "X-Remote-Extra-",
+		"requestheader-group-headers":        "X-Remote-Group",
+		"requestheader-username-headers":     "X-Remote-User",
+		"secure-port":                        strconv.Itoa(result.SecurePort),
+		"service-account-key-file":           t.SACertPath(),
+		"service-cluster-ip-range":           flags.Kubernetes.ServiceClusterIPRange,
+		"tls-cert-file":                      t.CertPath(),
+		"tls-private-key-file":               t.KeyPath(),
+	}
+	if flags.APIServer.HasExtraArg("enable-admission-plugins") && util.CompareVersions(flags.Kubernetes.Version, minEnableAdmissionPluginsVersion) < 0 {
+		return config{}, maskAny(fmt.Errorf("Argument --enable-admission-plugins requires kubernetes %s or higher, use --admission-control instead", minEnableAdmissionPluginsVersion))
+	}
+	if !flags.APIServer.HasExtraArg("admission-control", "enable-admission-plugins") {
+		admissionArg, admissionPlugins := admissionControl(flags.Kubernetes.Version)
+		args[admissionArg] = admissionPlugins
+	}
+	defaultMountPaths := []string{certDir, "/etc/ssl/certs"}
+	if flags.Audit.Enabled {
+		result.Audit = createAuditConfig(flags, args)
+		result.AuditConfigDir = auditConfigDir
+		result.AuditLogDir = flags.Audit.LogDir
+		defaultMountPaths = append(defaultMountPaths, auditConfigDir, flags.Audit.LogDir)
+	}
+	if config := flags.Encryption.CreateEncryptionConfig(flags.Kubernetes.Version, deps.EncryptionKeys); config != "" {
+		result.Encryption = encryptionConfig{
+			Config: config,
+			Hash:   service.EncryptionConfigHash(config),
+		}
+		result.EncryptionConfigDir = encryptionConfigDir
+		args[service.EncryptionProviderConfigArg(flags.Kubernetes.Version)] = filepath.Join(encryptionConfigDir, encryptionConfigName)
+		defaultMountPaths = append(defaultMountPaths, encryptionConfigDir)
 	}
+	extraVolumes, err := flags.APIServer.Volumes(defaultMountPaths...)
+	if err != nil {
+		return config{}, maskAny(err)
+	}
+	result.Args = flags.APIServer.Args(args)
+	result.ExtraVolumes = extraVolumes
+	result.Resources = flags.APIServer.MergeResources(service.Resources{
+		Requests: map[string]string{"cpu": "250m"},
+	})
 
 	return result, nil
 }
 
-func createManifest(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+// admissionControl returns the name of the argument used to enable admission plugins
+// and the default list of plugins for the given kubernetes version.
+func admissionControl(k8sVersion string) (string, string) {
+	plugins := []string{"NamespaceLifecycle", "LimitRanger", "ServiceAccount", "DefaultStorageClass", "DefaultTolerationSeconds", "NodeRestriction", "ResourceQuota"}
+	if util.CompareVersions(k8sVersion, minNoInitializersVersion) < 0 {
+		plugins = append([]string{"Initializers"}, plugins...)
+	}
+	if util.CompareVersions(k8sVersion, minEnableAdmissionPluginsVersion) < 0 {
+		return "admission-control", strings.Join(plugins, ",")
+	}
+	return "enable-admission-plugins", strings.Join(plugins, ",")
+}
+
+func createManifest(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating manifest %s", manifestPath)
-	if err := client.Render(deps.Logger, apiserverManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, apiserverManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -21,6 +21,12 @@ kind: Pod
 metadata:
   annotations:
     scheduler.alpha.kubernetes.io/critical-pod: ""
+{{- if .Audit.Hash }}
+    helix.pulcy.com/audit-config-hash: "{{ .Audit.Hash }}"
+{{- end }}
+{{- if .Encryption.Hash }}
+    helix.pulcy.com/encryption-config-hash: "{{ .Encryption.Hash }}"
+{{- end }}
   labels:
     component: kube-apiserver
     tier: control-plane
@@ -31,35 +37,9 @@ spec:
   - command:
     - /hyperkube
     - kube-apiserver
-    - --admission-control=Initializers,NamespaceLifecycle,LimitRanger,ServiceAccount,DefaultStorageClass,DefaultTolerationSeconds,NodeRestriction,ResourceQuota
-    - --advertise-address=$(PUBLIC_IP)
-    - --allow-privileged=true
-    - --authorization-mode=Node,RBAC
-    - --client-ca-file={{ .ClientCAFile }}
-    - --enable-bootstrap-token-auth=true
-    - --endpoint-reconciler-type=lease
-    - --etcd-cafile={{ .EtcdCAFile }}
-    - --etcd-certfile={{ .EtcdCertFile }}
-    - --etcd-keyfile={{ .EtcdKeyFile }}
-    - --etcd-servers={{ .EtcdEndpoints }}
-    - --feature-gates={{ .FeatureGates }}
-    - --kubelet-certificate-authority={{ .KubeletCAFile }}
-    - --kubelet-client-certificate={{ .KubeletCertFile }}
-    - --kubelet-client-key={{ .KubeletKeyFile }}
-    - --kubelet-https=true
-    - --kubelet-preferred-address-types=InternalIP,ExternalIP,Hostname
-    - --proxy-client-cert-file={{.ProxyClientCertFile}}
-    - --proxy-client-key-file={{.ProxyClientKeyFile}}
-    - --requestheader-allowed-names=
-    - --requestheader-client-ca-file={{.ProxyClientCAFile}}
-    - --requestheader-extra-headers-prefix=X-Remote-Extra-
-    - --requestheader-group-headers=X-Remote-Group
-    - --requestheader-username-headers=X-Remote-User
-    - --secure-port=6443
-    - --service-account-key-file={{ .ServiceAccountCertFile }}
-    - --service-cluster-ip-range={{ .ServiceClusterIPRange }}
-    - --tls-cert-file={{ .APIServerCertFile }}
-    - --tls-private-key-file={{ .APIServerKeyFile }}
+{{- range .Args }}
+    - {{ json . }}
+{{- end }}
     image: {{ .Image }}
     env:
     - name: PUBLIC_IP
@@ -75,14 +55,24 @@ spec:
       httpGet:
         host: 127.0.0.1
         path: /healthz
-        port: 6443
+        port: {{ .SecurePort }}
         scheme: HTTPS
       initialDelaySeconds: 60
       timeoutSeconds: 30
     name: kube-apiserver
     resources:
+{{- with .Resources.Requests }}
       requests:
-        cpu: 250m
+{{- range $name, $quantity := . }}
+        {{ $name }}: {{ json $quantity }}
+{{- end }}
+{{- end }}
+{{- with .Resources.Limits }}
+      limits:
+{{- range $name, $quantity := . }}
+        {{ $name }}: {{ json $quantity }}
+{{- end }}
+{{- end }}
     volumeMounts:
     - mountPath: {{ .PkiDir }}
       name: k8s-certs
@@ -90,6 +80,24 @@ spec:
     - mountPath: /etc/ssl/certs
       name: ca-certs
       readOnly: true
+{{- if .Audit.Hash }}
+    - mountPath: {{ .AuditConfigDir }}
+      name: audit-config
+      readOnly: true
+    - mountPath: {{ .AuditLogDir }}
+      name: audit-log
+      readOnly: false
+{{- end }}
+{{- if .Encryption.Hash }}
+    - mountPath: {{ .EncryptionConfigDir }}
+      name: encryption-config
+      readOnly: true
+{{- end }}
+{{- range .ExtraVolumes }}
+    - mountPath: {{ json .MountPath }}
+      name: extra-{{ .Name }}
+      readOnly: {{ .ReadOnly }}
+{{- end }}
   hostNetwork: true
   volumes:
   - hostPath:
@@ -100,5 +108,27 @@ spec:
       path: /etc/ssl/certs
       type: DirectoryOrCreate
     name: ca-certs
+{{- if .Audit.Hash }}
+  - hostPath:
+      path: {{ .AuditConfigDir }}
+      type: DirectoryOrCreate
+    name: audit-config
+  - hostPath:
+      path: {{ .AuditLogDir }}
+      type: DirectoryOrCreate
+    name: audit-log
+{{- end }}
+{{- if .Encryption.Hash }}
+  - hostPath:
+      path: {{ .EncryptionConfigDir }}
+      type: DirectoryOrCreate
+    name: encryption-config
+{{- end }}
+{{- range .ExtraVolumes }}
+  - hostPath:
+      path: {{ json .HostPath }}
+      type: {{ .PathType }}
+    name: extra-{{ .Name }}
+{{- end }}
 `
 )
@@ -15,6 +15,7 @@
 package ca
 
 import (
+	"context"
 	"os"
 
 	"github.com/pkg/errors"
@@ -47,36 +48,36 @@ func (t *caService) Name() string {
 	return "ca"
 }
 
-func (t *caService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *caService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.Component.Name = "admin"
 	return nil
 }
 
 // InitMachine configures the machine to upload certificates.
-func (t *caService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *caService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Upload ca.crt
-	if err := client.UpdateFile(log, t.Component.CACertPath(), []byte(deps.KubernetesCA.Cert()), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, t.Component.CACertPath(), []byte(deps.KubernetesCA.Cert()), certFileMode); err != nil {
 		return maskAny(err)
 	}
 	// If part of control, plane do a bit more.
 	if node.IsControlPlane {
 		// Upload ca.key
-		if err := client.UpdateFile(log, t.Component.CAKeyPath(), []byte(deps.KubernetesCA.Key()), keyFileMode); err != nil {
+		if err := client.UpdateFile(ctx, log, t.Component.CAKeyPath(), []byte(deps.KubernetesCA.Key()), keyFileMode); err != nil {
 			return maskAny(err)
 		}
 
 		// Upload sa.pub + sa.key
-		if err := client.UpdateFile(log, t.Component.SACertPath(), []byte(deps.ServiceAccount.Cert), certFileMode); err != nil {
+		if err := client.UpdateFile(ctx, log, t.Component.SACertPath(), []byte(deps.ServiceAccount.Cert), certFileMode); err != nil {
 			return maskAny(err)
 		}
-		if err := client.UpdateFile(log, t.Component.SAKeyPath(), []byte(deps.ServiceAccount.Key), keyFileMode); err != nil {
+		if err := client.UpdateFile(ctx, log, t.Component.SAKeyPath(), []byte(deps.ServiceAccount.Key), keyFileMode); err != nil {
 			return maskAny(err)
 		}
 
 		// Create admin.conf
-		if err := t.Component.CreateKubeConfig("kubernetes-admin", "system:masters", client, sctx, deps, flags); err != nil {
+		if err := t.Component.CreateKubeConfig(ctx, "kubernetes-admin", "system:masters", client, sctx, deps, flags); err != nil {
 			return maskAny(err)
 		}
 	}
@@ -85,16 +86,16 @@ func (t *caService) InitMachine(node service.Node, client util.SSHClient, sctx *
 }
 
 // ResetMachine removes CA certificates from the machine.
-func (t *caService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *caService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Remove admin.conf
-	if err := t.Component.RemoveKubeConfig(client, deps, flags); err != nil {
+	if err := t.Component.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove cert dir
-	if err := client.RemoveDirectory(log, t.Component.CertDir()); err != nil {
+	if err := client.RemoveDirectory(ctx, log, t.Component.CertDir()); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -0,0 +1,619 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ericchiang/k8s"
+	apiextensionsv1beta1 "github.com/ericchiang/k8s/apis/apiextensions/v1beta1"
+	appsv1 "github.com/ericchiang/k8s/apis/apps/v1"
+	corev1 "github.com/ericchiang/k8s/apis/core/v1"
+	metav1 "github.com/ericchiang/k8s/apis/meta/v1"
+	rbacv1 "github.com/ericchiang/k8s/apis/rbac/v1"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	cniConfName     = "10-calico.conflist"
+	etcdSecretsName = "calico-etcd-secrets"
+	etcdSecretsDir  = "/calico-secrets"
+)
+
+var (
+	// Custom resources used by calico when using the kubernetes datastore
+	customResources = []struct {
+		Kind       string
+		Plural     string
+		Namespaced bool
+	}{
+		{"BGPConfiguration", "bgpconfigurations", false},
+		{"BGPPeer", "bgppeers", false},
+		{"ClusterInformation", "clusterinformations", false},
+		{"FelixConfiguration", "felixconfigurations", false},
+		{"GlobalNetworkPolicy", "globalnetworkpolicies", false},
+		{"GlobalNetworkSet", "globalnetworksets", false},
+		{"HostEndpoint", "hostendpoints", false},
+		{"IPPool", "ippools", false},
+		{"NetworkPolicy", "networkpolicies", true},
+	}
+	// Files & directories created by calico on the nodes
+	nodePaths = []string{
+		"/etc/cni/net.d/" + cniConfName,
+		"/etc/cni/net.d/calico-kubeconfig",
+		"/etc/cni/net.d/calico-tls",
+		"/var/lib/calico",
+		"/var/run/calico",
+	}
+)
+
+func NewProvider() service.NetworkProvider {
+	return &calicoProvider{}
+}
+
+type calicoProvider struct {
+}
+
+func (t *calicoProvider) Name() string {
+	return service.NetworkProviderCalico
+}
+
+// Init deploys calico into the cluster.
+func (t *calicoProvider) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger
+	client, err := service.NewKubernetesClient(sctx, deps, flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	etcdDatastore := flags.Calico.IsEtcdDatastore()
+
+	// Create calico-node service account
+	sa := &corev1.ServiceAccount{
+		Metadata: &metav1.ObjectMeta{
+			Name:      k8s.String("calico-node"),
+			Namespace: k8s.String("kube-system"),
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, sa); err != nil {
+		return maskAny(err)
+	}
+
+	// Create calico-node cluster role
+	rules := []*rbacv1.PolicyRule{
+		&rbacv1.PolicyRule{
+			ApiGroups: []string{""},
+			Resources: []string{"namespaces", "serviceaccounts", "pods", "endpoints", "services"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		&rbacv1.PolicyRule{
+			ApiGroups: []string{""},
+			Resources: []string{"pods/status"},
+			Verbs:     []string{"update", "patch"},
+		},
+		&rbacv1.PolicyRule{
+			ApiGroups: []string{""},
+			Resources: []string{"nodes"},
+			Verbs:     []string{"get", "list", "watch", "update", "patch"},
+		},
+		&rbacv1.PolicyRule{
+			ApiGroups: []string{"extensions", "networking.k8s.io"},
+			Resources: []string{"networkpolicies"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+	}
+	if !etcdDatastore {
+		var resources []string
+		for _, cr := range customResources {
+			resources = append(resources, cr.Plural)
+		}
+		rules = append(rules, &rbacv1.PolicyRule{
+			ApiGroups: []string{"crd.projectcalico.org"},
+			Resources: resources,
+			Verbs:     []string{"create", "get", "list", "update", "watch"},
+		})
+	}
+	if err := createClusterRole(ctx, client, "calico-node", rules); err != nil {
+		return maskAny(err)
+	}
+
+	if etcdDatastore {
+		// Create etcd client certificate
+		cert, key, err := deps.EtcdCA.CreateTLSClientAuthCertificate("calico", "calico", nil)
+		if err != nil {
+			return maskAny(err)
+		}
+		secret := &corev1.Secret{
+			Metadata: &metav1.ObjectMeta{
+				Name:      k8s.String(etcdSecretsName),
+				Namespace: k8s.String("kube-system"),
+			},
+			Data: map[string][]byte{
+				"etcd-ca":   []byte(deps.EtcdCA.Cert()),
+				"etcd-cert": []byte(cert),
+				"etcd-key":  []byte(key),
+			},
+		}
+		if err := util.CreateOrUpdate(ctx, client, secret); err != nil {
+			return maskAny(err)
+		}
+	} else {
+		// Create custom resource definitions
+		for _, cr := range customResources {
+			scope := "Cluster"
+			if cr.Namespaced {
+				scope = "Namespaced"
+			}
+			crd := &apiextensionsv1beta1.CustomResourceDefinition{
+				Metadata: &metav1.ObjectMeta{
+					Name: k8s.String(cr.Plural + ".crd.projectcalico.org"),
+				},
+				Spec: &apiextensionsv1beta1.CustomResourceDefinitionSpec{
+					Group:   k8s.String("crd.projectcalico.org"),
+					Version: k8s.String("v1"),
+					Scope:   k8s.String(scope),
+					Names: &apiextensionsv1beta1.CustomResourceDefinitionNames{
+						Kind:   k8s.String(cr.Kind),
+						Plural: k8s.String(cr.Plural),
+					},
+				},
+			}
+			if err := util.CreateOrUpdate(ctx, client, crd); err != nil {
+				return maskAny(err)
+			}
+		}
+	}
+
+	// Render CNI network config
+	cniConfOpts := struct {
+		EtcdDatastore bool
+		MTU           int
+		IPv4          bool
+		IPv6          bool
+		DualStack     bool
+	}{
+		EtcdDatastore: etcdDatastore,
+		MTU:           flags.Calico.MTU,
+		IPv4:          flags.Kubernetes.PodNetworkCIDRFor(service.IPFamilyIPv4) != "",
+		IPv6:          flags.Kubernetes.PodNetworkCIDRFor(service.IPFamilyIPv6) != "",
+		DualStack:     flags.Kubernetes.IsDualStack(),
+	}
+	cniConf, err := util.RenderToString(log, cniConfTemplate, cniConfOpts)
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create calico-node daemonsets
+	etcdEndpoints := flags.Etcd.CreateClientEndpoints(sctx)
+	for _, dsArch := range sctx.DaemonSetArchitectures() {
+		if err := createNodeDaemonSet(ctx, client, dsArch, cniConf, etcdEndpoints, flags); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create kube-controllers (needed to sync kubernetes resources into etcd)
+	if etcdDatastore {
+		if err := createKubeControllers(ctx, client, sctx, etcdEndpoints, flags); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// ResetMachine removes the CNI configuration & network interfaces of calico from the machine.
+func (t *calicoProvider) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	// Remove CNI config & state
+	for _, p := range nodePaths {
+		if err := client.RemoveDirectory(ctx, log, p); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Remove network interfaces (the tunl0 interface is removed together with the ipip module)
+	if _, err := client.Run(ctx, log, "sudo sh -c 'for i in $(ls /sys/class/net | grep ^cali); do ip link delete $i; done'", "", true); err != nil {
+		log.Warn().Err(err).Msg("Failed to remove calico network interfaces")
+	}
+	if _, err := client.Run(ctx, log, "sudo sh -c 'if ip link show tunl0 >/dev/null 2>&1; then ip link set tunl0 down; modprobe -r ipip; fi'", "", true); err != nil {
+		log.Warn().Err(err).Msg("Failed to remove tunl0 network interface")
+	}
+
+	return nil
+}
+
+// createClusterRole creates a cluster role with given name & rules, bound to the service account with the same name.
+func createClusterRole(ctx context.Context, client *k8s.Client, name string, rules []*rbacv1.PolicyRule) error {
+	cr := &rbacv1.ClusterRole{
+		Metadata: &metav1.ObjectMeta{
+			Name: k8s.String(name),
+		},
+		Rules: rules,
+	}
+	if err := util.CreateOrUpdate(ctx, client, cr); err != nil {
+		return maskAny(err)
+	}
+	crb := &rbacv1.ClusterRoleBinding{
+		Metadata: &metav1.ObjectMeta{
+			Name: k8s.String(name),
+		},
+		RoleRef: &rbacv1.RoleRef{
+			ApiGroup: k8s.String("rbac.authorization.k8s.io"),
+			Kind:     k8s.String("ClusterRole"),
+			Name:     k8s.String(name),
+		},
+		Subjects: []*rbacv1.Subject{
+			&rbacv1.Subject{
+				Kind:      k8s.String("ServiceAccount"),
+				Name:      k8s.String(name),
+				Namespace: k8s.String("kube-system"),
+			},
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, crb); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// etcdEnv returns the environment variables used to connect to ETCD.
+func etcdEnv(etcdEndpoints string) []*corev1.EnvVar {
+	return []*corev1.EnvVar{
+		envVar("ETCD_ENDPOINTS", etcdEndpoints),
+		envVar("ETCD_CA_CERT_FILE", etcdSecretsDir+"/etcd-ca"),
+		envVar("ETCD_CERT_FILE", etcdSecretsDir+"/etcd-cert"),
+		envVar("ETCD_KEY_FILE", etcdSecretsDir+"/etcd-key"),
+	}
+}
+
+// envVar creates an environment variable with given name & value.
+func envVar(name, value string) *corev1.EnvVar {
+	return &corev1.EnvVar{
+		Name:  k8s.String(name),
+		Value: k8s.String(value),
+	}
+}
+
+// hostPathVolume creates a volume for the given host path.
+func hostPathVolume(name, path string) *corev1.Volume {
+	return &corev1.Volume{
+		Name: k8s.String(name),
+		VolumeSource: &corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: k8s.String(path),
+			},
+		},
+	}
+}
+
+// etcdSecretsVolume creates a volume containing the ETCD client certificates.
+func etcdSecretsVolume() *corev1.Volume {
+	return &corev1.Volume{
+		Name: k8s.String("etcd-certs"),
+		VolumeSource: &corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  k8s.String(etcdSecretsName),
+				DefaultMode: k8s.Int32(0400),
+			},
+		},
+	}
+}
+
+// createNodeDaemonSet creates the calico-node daemonset for the given architecture.
+func createNodeDaemonSet(ctx context.Context, client *k8s.Client, dsArch service.DaemonSetArchitecture, cniConf, etcdEndpoints string, flags service.ServiceFlags) error {
+	arch := dsArch.Name
+	etcdDatastore := flags.Calico.IsEtcdDatastore()
+
+	// calico-node environment
+	ipip := flags.Calico.IPIPMode
+	if ipip == service.CalicoIPIPNever {
+		ipip = "Off"
+	}
+	nodeEnv := []*corev1.EnvVar{
+		&corev1.EnvVar{
+			Name:      k8s.String("NODENAME"),
+			ValueFrom: util.EnvVarSourceFieldRef("spec.nodeName"),
+		},
+		envVar("CALICO_NETWORKING_BACKEND", "bird"),
+		envVar("CLUSTER_TYPE", "k8s,bgp"),
+		envVar("CALICO_DISABLE_FILE_LOGGING", "true"),
+		envVar("FELIX_DEFAULTENDPOINTTOHOSTACTION", "ACCEPT"),
+		envVar("FELIX_IPINIPMTU", fmt.Sprintf("%d", flags.Calico.MTU)),
+		envVar("FELIX_LOGSEVERITYSCREEN", "info"),
+		envVar("FELIX_HEALTHENABLED", "true"),
+	}
+	if cidr := flags.Kubernetes.PodNetworkCIDRFor(service.IPFamilyIPv4); cidr != "" {
+		nodeEnv = append(nodeEnv,
+			envVar("IP", "autodetect"),
+			envVar("CALICO_IPV4POOL_CIDR", cidr),
+			envVar("CALICO_IPV4POOL_IPIP", ipip),
+		)
+		if flags.Calico.Interface != "" {
+			nodeEnv = append(nodeEnv, envVar("IP_AUTODETECTION_METHOD", "interface="+flags.Calico.Interface))
+		}
+	} else {
+		// IPv6 only, BGP needs a router ID that is not derived from an IPv4 address
+		nodeEnv = append(nodeEnv,
+			envVar("IP", "none"),
+			envVar("CALICO_ROUTER_ID", "hash"),
+		)
+	}
+	if cidr := flags.Kubernetes.PodNetworkCIDRFor(service.IPFamilyIPv6); cidr != "" {
+		nodeEnv = append(nodeEnv,
+			envVar("IP6", "autodetect"),
+			envVar("CALICO_IPV6POOL_CIDR", cidr),
+			envVar("FELIX_IPV6SUPPORT", "true"),
+		)
+		if flags.Calico.Interface != "" {
+			nodeEnv = append(nodeEnv, envVar("IP6_AUTODETECTION_METHOD", "interface="+flags.Calico.Interface))
+		}
+	} else {
+		nodeEnv = append(nodeEnv, envVar("FELIX_IPV6SUPPORT", "false"))
+	}
+	// install-cni environment
+	cniEnv := []*corev1.EnvVar{
+		envVar("CNI_CONF_NAME", cniConfName),
+		envVar("CNI_NETWORK_CONFIG", cniConf),
+		&corev1.EnvVar{
+			Name:      k8s.String("KUBERNETES_NODE_NAME"),
+			ValueFrom: util.EnvVarSourceFieldRef("spec.nodeName"),
+		},
+	}
+	nodeMounts := []*corev1.VolumeMount{
+		&corev1.VolumeMount{
+			MountPath: k8s.String("/lib/modules"),
+			Name:      k8s.String("lib-modules"),
+			ReadOnly:  k8s.Bool(true),
+		},
+		&corev1.VolumeMount{
+			MountPath: k8s.String("/var/run/calico"),
+			Name:      k8s.String("var-run-calico"),
+		},
+		&corev1.VolumeMount{
+			MountPath: k8s.String("/var/lib/calico"),
+			Name:      k8s.String("var-lib-calico"),
+		},
+		&corev1.VolumeMount{
+			MountPath: k8s.String("/run/xtables.lock"),
+			Name:      k8s.String("xtables-lock"),
+		},
+	}
+	cniMounts := []*corev1.VolumeMount{
+		&corev1.VolumeMount{
+			MountPath: k8s.String("/host/opt/cni/bin"),
+			Name:      k8s.String("cni-bin-dir"),
+		},
+		&corev1.VolumeMount{
+			MountPath: k8s.String("/host/etc/cni/net.d"),
+			Name:      k8s.String("cni-net-dir"),
+		},
+	}
+	volumes := []*corev1.Volume{
+		hostPathVolume("lib-modules", "/lib/modules"),
+		hostPathVolume("var-run-calico", "/var/run/calico"),
+		hostPathVolume("var-lib-calico", "/var/lib/calico"),
+		&corev1.Volume{
+			Name: k8s.String("xtables-lock"),
+			VolumeSource: &corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: k8s.String("/run/xtables.lock"),
+					Type: k8s.String("FileOrCreate"),
+				},
+			},
+		},
+		hostPathVolume("cni-bin-dir", "/opt/cni/bin"),
+		hostPathVolume("cni-net-dir", "/etc/cni/net.d"),
+	}
+	if etcdDatastore {
+		nodeEnv = append(nodeEnv, etcdEnv(etcdEndpoints)...)
+		cniEnv = append(cniEnv, envVar("ETCD_ENDPOINTS", etcdEndpoints))
+		certsMount := &corev1.VolumeMount{
+			MountPath: k8s.String(etcdSecretsDir),
+			Name:      k8s.String("etcd-certs"),
+		}
+		nodeMounts = append(nodeMounts, certsMount)
+		cniMounts = append(cniMounts, certsMount)
+		volumes = append(volumes, etcdSecretsVolume())
+	} else {
+		nodeEnv = append(nodeEnv, envVar("DATASTORE_TYPE", "kubernetes"), envVar("WAIT_FOR_DATASTORE", "true"))
+	}
+
+	labels := map[string]string{
+		"k8s-app":                 "calico-node",
+		"beta.kubernetes.io/arch": arch,
+	}
+	ds := &appsv1.DaemonSet{
+		Metadata: &metav1.ObjectMeta{
+			Name:      k8s.String("calico-node-" + arch),
+			Namespace: k8s.String("kube-system"),
+			Labels:    labels,
+		},
+		Spec: &appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			UpdateStrategy: &appsv1.DaemonSetUpdateStrategy{
+				Type: k8s.String("RollingUpdate"),
+			},
+			Template: &corev1.PodTemplateSpec{
+				Metadata: &metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: &corev1.PodSpec{
+					HostNetwork: k8s.Bool(true),
+					NodeSelector: map[string]string{
+						"beta.kubernetes.io/arch": arch,
+					},
+					Tolerations: []*corev1.Toleration{
+						// The network must be available on all nodes, regardless of their taints
+						&corev1.Toleration{
+							Operator: k8s.String("Exists"),
+						},
+					},
+					ServiceAccountName: k8s.String("calico-node"),
+					Containers: []*corev1.Container{
+						&corev1.Container{
+							Name:  k8s.String("calico-node"),
+							Image: k8s.String(flags.Images.CalicoImage(service.ComponentCalicoNode, dsArch.ImageArchitecture)),
+							Env:   nodeEnv,
+							SecurityContext: &corev1.SecurityContext{
+								Privileged: k8s.Bool(true),
+							},
+							LivenessProbe: &corev1.Probe{
+								Handler: &corev1.Handler{
+									HttpGet: &corev1.HTTPGetAction{
+										Host: k8s.String("localhost"),
+										Path: k8s.String("/liveness"),
+										Port: util.IntOrStringI(9099),
+									},
+								},
+								InitialDelaySeconds: k8s.Int32(10),
+								PeriodSeconds:       k8s.Int32(10),
+								FailureThreshold:    k8s.Int32(6),
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: &corev1.Handler{
+									HttpGet: &corev1.HTTPGetAction{
+										Host: k8s.String("localhost"),
+										Path: k8s.String("/readiness"),
+										Port: util.IntOrStringI(9099),
+									},
+								},
+								PeriodSeconds: k8s.Int32(10),
+							},
+							VolumeMounts: nodeMounts,
+						},
+						&corev1.Container{
+							Name:         k8s.String("install-cni"),
+							Image:        k8s.String(flags.Images.CalicoImage(service.ComponentCalicoCNI, dsArch.ImageArchitecture)),
+							Command:      []string{"/install-cni.sh"},
+							Env:          cniEnv,
+							VolumeMounts: cniMounts,
+						},
+					},
+					Volumes: volumes,
+				},
+			},
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, ds); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// createKubeControllers creates the calico-kube-controllers deployment.
+func createKubeControllers(ctx context.Context, client *k8s.Client, sctx *service.ServiceContext, etcdEndpoints string, flags service.ServiceFlags) error {
+	// Create service account & cluster role
+	sa := &corev1.ServiceAccount{
+		Metadata: &metav1.ObjectMeta{
+			Name:      k8s.String("calico-kube-controllers"),
+			Namespace: k8s.String("kube-system"),
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, sa); err != nil {
+		return maskAny(err)
+	}
+	rules := []*rbacv1.PolicyRule{
+		&rbacv1.PolicyRule{
+			ApiGroups: []string{""},
+			Resources: []string{"pods", "namespaces", "serviceaccounts", "nodes"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		&rbacv1.PolicyRule{
+			ApiGroups: []string{"extensions", "networking.k8s.io"},
+			Resources: []string{"networkpolicies"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+	}
+	if err := createClusterRole(ctx, client, "calico-kube-controllers", rules); err != nil {
+		return maskAny(err)
+	}
+
+	// Run on an architecture for which an image is available
+	archs := sctx.DaemonSetArchitectures()
+	if len(archs) == 0 {
+		return maskAny(fmt.Errorf("No nodes to run calico-kube-controllers on"))
+	}
+	dsArch := archs[0]
+	labels := map[string]string{
+		"k8s-app": "calico-kube-controllers",
+	}
+	env := append(etcdEnv(etcdEndpoints), envVar("ENABLED_CONTROLLERS", "policy,namespace,serviceaccount,workloadendpoint,node"))
+	d := &appsv1.Deployment{
+		Metadata: &metav1.ObjectMeta{
+			Name:      k8s.String("calico-kube-controllers"),
+			Namespace: k8s.String("kube-system"),
+			Labels:    labels,
+		},
+		Spec: &appsv1.DeploymentSpec{
+			Replicas: k8s.Int32(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Strategy: &appsv1.DeploymentStrategy{
+				Type: k8s.String("Recreate"),
+			},
+			Template: &corev1.PodTemplateSpec{
+				Metadata: &metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: &corev1.PodSpec{
+					HostNetwork: k8s.Bool(true),
+					NodeSelector: map[string]string{
+						"beta.kubernetes.io/arch": dsArch.Name,
+					},
+					Tolerations: []*corev1.Toleration{
+						&corev1.Toleration{
+							Key:      k8s.String(service.MasterTaint.Key),
+							Operator: k8s.String("Exists"),
+							Effect:   k8s.String(service.MasterTaint.Effect),
+						},
+					},
+					ServiceAccountName: k8s.String("calico-kube-controllers"),
+					Containers: []*corev1.Container{
+						&corev1.Container{
+							Name:  k8s.String("calico-kube-controllers"),
+							Image: k8s.String(flags.Images.CalicoImage(service.ComponentCalicoKubeControllers, dsArch.ImageArchitecture)),
+							Env:   env,
+							VolumeMounts: []*corev1.VolumeMount{
+								&corev1.VolumeMount{
+									MountPath: k8s.String(etcdSecretsDir),
+									Name:      k8s.String("etcd-certs"),
+								},
+							},
+						},
+					},
+					Volumes: []*corev1.Volume{
+						etcdSecretsVolume(),
+					},
+				},
+			},
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, d); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package calico
+
+const (
+	// CNI network config, placeholders (__X__) are replaced by the install-cni container.
+	cniConfTemplate = `{
+  "name": "k8s-pod-network",
+  "cniVersion": "0.3.0",
+  "plugins": [
+    {
+      "type": "calico",
+      "log_level": "info",
+{{- if .EtcdDatastore }}
+      "etcd_endpoints": "__ETCD_ENDPOINTS__",
+      "etcd_key_file": "__ETCD_KEY_FILE__",
+      "etcd_cert_file": "__ETCD_CERT_FILE__",
+      "etcd_ca_cert_file": "__ETCD_CA_CERT_FILE__",
+      "ipam": {
+        "type": "calico-ipam",
+        "assign_ipv4": "{{ .IPv4 }}",
+        "assign_ipv6": "{{ .IPv6 }}"
+      },
+{{- else }}
+      "datastore_type": "kubernetes",
+      "ipam": {
+{{- if .DualStack }}
+        "type": "host-local",
+        "ranges": [
+          [{ "subnet": "usePodCidr" }],
+          [{ "subnet": "usePodCidrIPv6" }]
+        ]
+{{- else }}
+        "type": "host-local",
+        "subnet": "usePodCidr"
+{{- end }}
+      },
+{{- end }}
+      "nodename": "__KUBERNETES_NODE_NAME__",
+      "mtu": {{ .MTU }},
+      "policy": {
+        "type": "k8s"
+      },
+      "kubernetes": {
+        "kubeconfig": "__KUBECONFIG_FILEPATH__"
+      }
+    },
+    {
+      "type": "portmap",
+      "snat": true,
+      "capabilities": {
+        "portMappings": true
+      }
+    }
+  ]
+}`
+)
@@ -15,7 +15,7 @@
 package cni
 
 import (
-	"fmt"
+	"context"
 	"os"
 
 	"github.com/pkg/errors"
@@ -32,8 +32,7 @@ const (
 	ServiceName = "cni-installer"
 	servicePath = "/etc/systemd/system/" + ServiceName + ".service"
 
-	pluginsTGZPath     = "/opt/cni-plugins-v0.7.0.tgz"
-	pluginsURLTemplate = "https://github.com/containernetworking/plugins/releases/download/v0.7.0/cni-plugins-%s-v0.7.0.tgz"
+	pluginsTGZPath = "/opt/cni-plugins-v0.7.0.tgz"
 
 	serviceFileMode = os.FileMode(0644)
 )
@@ -49,13 +48,20 @@ func (t *cniService) Name() string {
 	return ServiceName
 }
 
-func (t *cniService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *cniService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	return nil
 }
 
 // InitMachine configures the machine to run download hyperkube.
-func (t *cniService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *cniService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	// Setup CNI on this host?
+	if !node.IsKubernetesNode() {
+		log.Info().Msg("No CNI on this machine")
+		return nil
+	}
+
 	cfg, err := t.createConfig(node, client, deps, flags)
 	if err != nil {
 		return maskAny(err)
@@ -63,18 +69,18 @@ func (t *cniService) InitMachine(node service.Node, client util.SSHClient, sctx
 
 	// Create service
 	log.Info().Msg("Creating CNI Download Service")
-	if err := createService(client, deps, cfg); err != nil {
+	if err := createService(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
 	// Restart service
-	if _, err := client.Run(log, "sudo systemctl daemon-reload", "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl daemon-reload", "", false); err != nil {
 		return maskAny(err)
 	}
-	if _, err := client.Run(log, "sudo systemctl enable "+ServiceName, "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl enable "+ServiceName, "", false); err != nil {
 		return maskAny(err)
 	}
-	if _, err := client.Run(log, "sudo systemctl restart "+ServiceName, "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl restart "+ServiceName, "", false); err != nil {
 		return maskAny(err)
 	}
 
@@ -82,7 +88,7 @@ func (t *cniService) InitMachine(node service.Node, client util.SSHClient, sctx
 }
 
 // ResetMachine removes hyperkube from the machine.
-func (t *cniService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *cniService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 	cfg, err := t.createConfig(node, client, deps, flags)
 	if err != nil {
@@ -90,20 +96,20 @@ func (t *cniService) ResetMachine(node service.Node, client util.SSHClient, sctx
 	}
 
 	// Stop service
-	if _, err := client.Run(log, "sudo systemctl stop "+ServiceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl stop "+ServiceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to stop cni service")
 	}
-	if _, err := client.Run(log, "sudo systemctl disable "+ServiceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl disable "+ServiceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to disable cni service")
 	}
 
 	// Remove service
-	if err := client.RemoveFile(log, servicePath); err != nil {
+	if err := client.RemoveFile(ctx, log, servicePath); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove binaries
-	if err := client.RemoveDirectory(log, cfg.CniBinDir); err != nil {
+	if err := client.RemoveDirectory(ctx, log, cfg.CniBinDir); err != nil {
 		return maskAny(err)
 	}
 
@@ -119,16 +125,16 @@ type config struct {
 func (t *cniService) createConfig(node service.Node, client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
 	result := config{
 		PluginsTgzPath: pluginsTGZPath,
-		PluginsURL:     fmt.Sprintf(pluginsURLTemplate, node.Architecture),
+		PluginsURL:     flags.Images.CNIPluginsURL(node.Architecture),
 		CniBinDir:      "/opt/cni/bin",
 	}
 
 	return result, nil
 }
 
-func createService(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+func createService(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating service %s", servicePath)
-	if err := client.Render(deps.Logger, cniDownloadServiceTemplate, servicePath, opts, serviceFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, cniDownloadServiceTemplate, servicePath, opts, serviceFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -17,8 +17,8 @@ package cni
 const (
 	cniDownloadServiceTemplate = `[Unit]
 Description=CNI Installer
-Requires=docker.service network-online.target
-After=docker.service network-online.target
+Requires=network-online.target
+After=network-online.target
 
 [Service]
 Type=oneshot
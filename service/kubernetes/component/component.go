@@ -15,8 +15,8 @@
 package component
 
 import (
+	"context"
 	"encoding/base64"
-	"fmt"
 	"os"
 	"path/filepath"
 
@@ -86,7 +86,7 @@ func (c Component) KubeConfigPath() string {
 
 // CreateKubeConfig renders and uploads a kubeconfig file for this
 // component on the machine indicated by the given client.
-func (c Component) CreateKubeConfig(commonName, orgName string, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (c Component) CreateKubeConfig(ctx context.Context, commonName, orgName string, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	cert, key, err := deps.KubernetesCA.CreateTLSClientAuthCertificate(commonName, orgName, client)
 	if err != nil {
 		return maskAny(err)
@@ -99,14 +99,37 @@ func (c Component) CreateKubeConfig(commonName, orgName string, client util.SSHC
 		ClientCertData string
 		ClientKeyData  string
 	}{
-		Server:         fmt.Sprintf("https://%s:6443", sctx.GetAPIServer()),
+		Server:         sctx.GetAPIServerURL(),
 		ContextName:    c.Name,
 		UserName:       c.Name,
 		CAData:         base64.StdEncoding.EncodeToString([]byte(deps.KubernetesCA.Cert())),
 		ClientCertData: base64.StdEncoding.EncodeToString([]byte(cert)),
 		ClientKeyData:  base64.StdEncoding.EncodeToString([]byte(key)),
 	}
-	if err := client.Render(deps.Logger, kubeConfigTemplate, c.KubeConfigPath(), opts, configFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, kubeConfigTemplate, c.KubeConfigPath(), opts, configFileMode); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// CreateBootstrapKubeConfig renders and uploads a kubeconfig file for this
+// component, that authenticates using the given bootstrap token only,
+// on the machine indicated by the given client.
+func (c Component) CreateBootstrapKubeConfig(ctx context.Context, token util.BootstrapToken, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	opts := struct {
+		Server      string
+		ContextName string
+		UserName    string
+		CAData      string
+		Token       string
+	}{
+		Server:      sctx.GetAPIServerURL(),
+		ContextName: c.Name,
+		UserName:    "tls-bootstrap-token-user",
+		CAData:      base64.StdEncoding.EncodeToString([]byte(deps.KubernetesCA.Cert())),
+		Token:       token.String(),
+	}
+	if err := client.Render(ctx, deps.Logger, bootstrapKubeConfigTemplate, c.KubeConfigPath(), opts, configFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -114,15 +137,15 @@ func (c Component) CreateKubeConfig(commonName, orgName string, client util.SSHC
 
 // RemoveKubeConfig removes the kubeconfig file for this
 // component on the machine indicated by the given client.
-func (c Component) RemoveKubeConfig(client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) error {
-	if err := client.RemoveFile(deps.Logger, c.KubeConfigPath()); err != nil {
+func (c Component) RemoveKubeConfig(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	if err := client.RemoveFile(ctx, deps.Logger, c.KubeConfigPath()); err != nil {
 		return maskAny(err)
 	}
 	return nil
 }
 
 // UploadCertificates creates a server certificate for the component and uploads it.
-func (c Component) UploadCertificates(commonName, orgName string, client util.SSHClient, deps service.ServiceDependencies, additionalHosts ...string) error {
+func (c Component) UploadCertificates(ctx context.Context, commonName, orgName string, client util.SSHClient, deps service.ServiceDependencies, additionalHosts ...string) error {
 	log := deps.Logger
 	log.Info().Msgf("Creating %s TLS Certificates", c.Name)
 	cert, key, err := deps.KubernetesCA.CreateTLSServerCertificate(commonName, orgName, client, additionalHosts...)
@@ -131,10 +154,10 @@ func (c Component) UploadCertificates(commonName, orgName string, client util.SS
 	}
 
 	log.Info().Msgf("Uploading %s TLS Certificates", c.Name)
-	if err := client.UpdateFile(log, c.CertPath(), []byte(cert), certFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, c.CertPath(), []byte(cert), certFileMode); err != nil {
 		return maskAny(err)
 	}
-	if err := client.UpdateFile(log, c.KeyPath(), []byte(key), keyFileMode); err != nil {
+	if err := client.UpdateFile(ctx, log, c.KeyPath(), []byte(key), keyFileMode); err != nil {
 		return maskAny(err)
 	}
 
@@ -142,11 +165,11 @@ func (c Component) UploadCertificates(commonName, orgName string, client util.SS
 }
 
 // RemoveCertificates removes certificates for the component.
-func (c Component) RemoveCertificates(client util.SSHClient, deps service.ServiceDependencies) error {
-	if err := client.RemoveFile(deps.Logger, c.CertPath()); err != nil {
+func (c Component) RemoveCertificates(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies) error {
+	if err := client.RemoveFile(ctx, deps.Logger, c.CertPath()); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(deps.Logger, c.KeyPath()); err != nil {
+	if err := client.RemoveFile(ctx, deps.Logger, c.KeyPath()); err != nil {
 		return maskAny(err)
 	}
 	return nil
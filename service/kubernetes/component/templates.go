@@ -34,4 +34,23 @@ users:
     client-certificate-data: {{.ClientCertData}}
     client-key-data: {{.ClientKeyData}}
 `
+
+	bootstrapKubeConfigTemplate = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: {{.CAData}}
+    server: {{.Server}}
+  name: kubernetes
+contexts:
+- context:
+    cluster: kubernetes
+    user: {{.UserName}}
+  name: {{.ContextName}}
+current-context: {{.ContextName}}
+users:
+- name: {{.UserName}}
+  user:
+    token: {{.Token}}
+`
 )
@@ -15,7 +15,9 @@
 package controllermanager
 
 import (
+	"context"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -49,13 +51,18 @@ func (t *controllermanagerService) Name() string {
 	return "kube-controller-manager"
 }
 
-func (t *controllermanagerService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+// IsDisruptive returns true.
+func (t *controllermanagerService) IsDisruptive() bool {
+	return true
+}
+
+func (t *controllermanagerService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.Component.Name = "controller-manager"
 	return nil
 }
 
 // InitMachine configures the machine to run kube-controller-manager.
-func (t *controllermanagerService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *controllermanagerService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Setup scheduler on this host?
@@ -70,13 +77,13 @@ func (t *controllermanagerService) InitMachine(node service.Node, client util.SS
 	}
 
 	// Create & Upload kubeconfig
-	if err := t.Component.CreateKubeConfig("system:kube-controller-manager", "Kubernetes", client, sctx, deps, flags); err != nil {
+	if err := t.Component.CreateKubeConfig(ctx, "system:kube-controller-manager", "Kubernetes", client, sctx, deps, flags); err != nil {
 		return maskAny(err)
 	}
 
 	// Create manifest
 	log.Info().Msg("Creating kube-controller-manager manifest")
-	if err := createManifest(client, deps, cfg); err != nil {
+	if err := createManifest(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
@@ -84,16 +91,16 @@ func (t *controllermanagerService) InitMachine(node service.Node, client util.SS
 }
 
 // ResetMachine removes kube-controller-manager from the machine.
-func (t *controllermanagerService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *controllermanagerService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Create manifest
-	if err := client.RemoveFile(log, manifestPath); err != nil {
+	if err := client.RemoveFile(ctx, log, manifestPath); err != nil {
 		return maskAny(err)
 	}
 
 	// Create & Upload kubeconfig
-	if err := t.Component.RemoveKubeConfig(client, deps, flags); err != nil {
+	if err := t.Component.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
 		return maskAny(err)
 	}
 
@@ -101,36 +108,59 @@ func (t *controllermanagerService) ResetMachine(node service.Node, client util.S
 }
 
 type config struct {
-	Image                  string // HyperKube docker images
-	PodName                string
-	PkiDir                 string
-	FeatureGates           string // Feature gates to use
-	KubeConfigPath         string // Path to a kubeconfig file, specifying how to connect to the API server.
-	ClusterSigningCertFile string
-	ClusterSigningKeyFile  string
-	RootCAFile             string
-	ServiceAccountKeyFile  string
+	Image          string                  // HyperKube docker images
+	PodName        string                  // Name of the static pod
+	PkiDir         string                  // Directory containing certificates
+	KubeConfigPath string                  // Path to a kubeconfig file, specifying how to connect to the API server.
+	Args           []string                // Command line arguments (defaults merged with extra arguments)
+	ExtraVolumes   []service.HostPathMount // Additional host paths to mount
+	Resources      service.Resources       // Resource requests & limits
 }
 
 func (t *controllermanagerService) createConfig(node service.Node, client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
+	args := map[string]string{
+		"address":                          "127.0.0.1",
+		"allocate-node-cidrs":              "true",
+		"cluster-cidr":                     flags.Kubernetes.PodNetworkCIDR,
+		"cluster-signing-cert-file":        t.CACertPath(),
+		"cluster-signing-key-file":         t.CAKeyPath(),
+		"controllers":                      "*,bootstrapsigner,tokencleaner",
+		"feature-gates":                    strings.Join(flags.Kubernetes.FeatureGates, ","),
+		"kubeconfig":                       t.KubeConfigPath(),
+		"leader-elect":                     "true",
+		"root-ca-file":                     t.CACertPath(),
+		"service-account-private-key-file": t.SAKeyPath(),
+		"service-cluster-ip-range":         flags.Kubernetes.ServiceClusterIPRange,
+		"use-service-account-credentials":  "true",
+	}
+	if flags.Kubernetes.IsDualStack() {
+		args["node-cidr-mask-size-ipv4"] = strconv.Itoa(flags.Kubernetes.NodeCIDRMaskSize)
+		args["node-cidr-mask-size-ipv6"] = strconv.Itoa(flags.Kubernetes.NodeCIDRMaskSizeIPv6)
+	} else {
+		args["node-cidr-mask-size"] = strconv.Itoa(flags.Kubernetes.NodeCIDRMaskSizeFor(flags.Kubernetes.PodNetworkCIDRs()[0]))
+	}
+	extraVolumes, err := flags.ControllerManager.Volumes(t.Component.CertDir(), "/etc/ssl/certs", t.KubeConfigPath())
+	if err != nil {
+		return config{}, maskAny(err)
+	}
 	result := config{
-		Image:                  flags.Images.HyperKubeImage(node.Architecture),
-		PodName:                "kube-controller-manager-" + node.Name,
-		PkiDir:                 t.Component.CertDir(),
-		FeatureGates:           strings.Join(flags.Kubernetes.FeatureGates, ","),
-		KubeConfigPath:         t.KubeConfigPath(),
-		ClusterSigningCertFile: t.CACertPath(),
-		ClusterSigningKeyFile:  t.CAKeyPath(),
-		RootCAFile:             t.CACertPath(),
-		ServiceAccountKeyFile:  t.SAKeyPath(),
+		Image:          flags.Images.HyperKubeImage(node.Architecture),
+		PodName:        "kube-controller-manager-" + node.Name,
+		PkiDir:         t.Component.CertDir(),
+		KubeConfigPath: t.KubeConfigPath(),
+		Args:           flags.ControllerManager.Args(args),
+		ExtraVolumes:   extraVolumes,
+		Resources: flags.ControllerManager.MergeResources(service.Resources{
+			Requests: map[string]string{"cpu": "200m"},
+		}),
 	}
 
 	return result, nil
 }
 
-func createManifest(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+func createManifest(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating manifest %s", manifestPath)
-	if err := client.Render(deps.Logger, controllermanagerManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, controllermanagerManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
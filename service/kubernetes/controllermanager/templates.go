@@ -31,19 +31,9 @@ spec:
   - command:
     - /hyperkube
     - kube-controller-manager
-    - --address=127.0.0.1
-    - --allocate-node-cidrs=true
-    - --cluster-cidr=10.244.0.0/16
-    - --cluster-signing-cert-file={{ .ClusterSigningCertFile }}
-    - --cluster-signing-key-file={{ .ClusterSigningKeyFile }}
-    - --controllers=*,bootstrapsigner,tokencleaner
-    - --feature-gates={{ .FeatureGates }}
-    - --kubeconfig={{ .KubeConfigPath }}
-    - --leader-elect=true
-    - --node-cidr-mask-size=24
-    - --root-ca-file={{ .RootCAFile }}
-    - --service-account-private-key-file={{ .ServiceAccountKeyFile }}
-    - --use-service-account-credentials=true
+{{- range .Args }}
+    - {{ json . }}
+{{- end }}
     image: {{ .Image }}
     livenessProbe:
       failureThreshold: 8
@@ -56,8 +46,18 @@ spec:
       timeoutSeconds: 15
     name: kube-controller-manager
     resources:
+{{- with .Resources.Requests }}
       requests:
-        cpu: 200m
+{{- range $name, $quantity := . }}
+        {{ $name }}: {{ json $quantity }}
+{{- end }}
+{{- end }}
+{{- with .Resources.Limits }}
+      limits:
+{{- range $name, $quantity := . }}
+        {{ $name }}: {{ json $quantity }}
+{{- end }}
+{{- end }}
     volumeMounts:
     - mountPath: {{ .PkiDir }}
       name: k8s-certs
@@ -68,6 +68,11 @@ spec:
     - mountPath: {{ .KubeConfigPath }}
       name: kubeconfig
       readOnly: true
+{{- range .ExtraVolumes }}
+    - mountPath: {{ json .MountPath }}
+      name: extra-{{ .Name }}
+      readOnly: {{ .ReadOnly }}
+{{- end }}
   hostNetwork: true
   volumes:
   - hostPath:
@@ -82,5 +87,11 @@ spec:
       path: {{ .KubeConfigPath }}
       type: FileOrCreate
     name: kubeconfig
+{{- range .ExtraVolumes }}
+  - hostPath:
+      path: {{ json .HostPath }}
+      type: {{ .PathType }}
+    name: extra-{{ .Name }}
+{{- end }}
 `
 )
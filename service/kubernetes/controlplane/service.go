@@ -45,12 +45,12 @@ func (t *cpService) Name() string {
 	return "control-plane"
 }
 
-func (t *cpService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *cpService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	return nil
 }
 
 // Init waits for the control plane to become responsive.
-func (t *cpService) Init(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *cpService) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger
 
 	client, err := service.NewKubernetesClient(sctx, deps, flags)
@@ -58,16 +58,17 @@ func (t *cpService) Init(sctx *service.ServiceContext, deps service.ServiceDepen
 		return maskAny(err)
 	}
 	log.Info().Msg("Waiting for control-plane to respond")
-	start := time.Now()
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+		defer cancel()
+	}
 	for {
-		if time.Since(start) > waitTimeout {
-			return maskAny(fmt.Errorf("Control-plane did not wake up in time"))
-		}
 		op := func() error {
 			var nodes corev1.NodeList
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+			lctx, cancel := context.WithTimeout(ctx, time.Second*15)
 			defer cancel()
-			if err := client.List(ctx, k8s.AllNamespaces, &nodes); err != nil {
+			if err := client.List(lctx, k8s.AllNamespaces, &nodes); err != nil {
 				return maskAny(err)
 			}
 			// Got a good response
@@ -76,12 +77,16 @@ func (t *cpService) Init(sctx *service.ServiceContext, deps service.ServiceDepen
 			}
 			return nil
 		}
-		if err := op(); err != nil {
-			time.Sleep(time.Second)
-		} else {
+		if err := op(); err == nil {
 			// Got good response
 			break
 		}
+		select {
+		case <-time.After(time.Second):
+			// Retry
+		case <-ctx.Done():
+			return maskAny(fmt.Errorf("Control-plane did not wake up in time: %v", ctx.Err()))
+		}
 	}
 	log.Info().Msg("Control-plane is responding")
 
@@ -16,6 +16,7 @@ package coredns
 
 import (
 	"context"
+	"strings"
 
 	"github.com/ericchiang/k8s"
 	appsv1 "github.com/ericchiang/k8s/apis/apps/v1"
@@ -44,12 +45,11 @@ func (t *dnsService) Name() string {
 	return "coredns"
 }
 
-func (t *dnsService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *dnsService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	return nil
 }
 
-func (t *dnsService) Init(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
-	ctx := context.Background()
+func (t *dnsService) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger
 	client, err := service.NewKubernetesClient(sctx, deps, flags)
 	if err != nil {
@@ -121,7 +121,7 @@ func (t *dnsService) Init(sctx *service.ServiceContext, deps service.ServiceDepe
 		ServiceClusterIPRange string
 	}{
 		ClusterDomain:         flags.Kubernetes.ClusterDomain,
-		ServiceClusterIPRange: flags.Kubernetes.ServiceClusterIPRange,
+		ServiceClusterIPRange: strings.Join(flags.Kubernetes.ServiceClusterIPRanges(), " "),
 	}
 	corefile, err := util.RenderToString(log, corefileTemplate, corefileOpts)
 	if err != nil {
@@ -172,6 +172,13 @@ func (t *dnsService) Init(sctx *service.ServiceContext, deps service.ServiceDepe
 					},
 				},
 				Spec: &corev1.PodSpec{
+					Tolerations: []*corev1.Toleration{
+						&corev1.Toleration{
+							Key:      k8s.String(service.MasterTaint.Key),
+							Operator: k8s.String("Exists"),
+							Effect:   k8s.String(service.MasterTaint.Effect),
+						},
+					},
 					Containers: []*corev1.Container{
 						&corev1.Container{
 							Name:  k8s.String("coredns"),
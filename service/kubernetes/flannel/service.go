@@ -16,6 +16,8 @@ package flannel
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 
 	"github.com/ericchiang/k8s"
 	appsv1 "github.com/ericchiang/k8s/apis/apps/v1"
@@ -33,23 +35,28 @@ var (
 	maskAny = errors.WithStack
 )
 
-func NewService() service.Service {
-	return &flannelService{}
-}
+const (
+	cniConfPath = "/etc/cni/net.d/10-flannel.conf"
+)
+
+var (
+	// Network interfaces created by flannel
+	interfaces = []string{"flannel.1", "flannel-wg", "cni0"}
+)
 
-type flannelService struct {
+func NewProvider() service.NetworkProvider {
+	return &flannelProvider{}
 }
 
-func (t *flannelService) Name() string {
-	return "flannel"
+type flannelProvider struct {
 }
 
-func (t *flannelService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
-	return nil
+func (t *flannelProvider) Name() string {
+	return service.NetworkProviderFlannel
 }
 
-func (t *flannelService) Init(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
-	ctx := context.Background()
+// Init deploys flannel into the cluster.
+func (t *flannelProvider) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger
 	client, err := service.NewKubernetesClient(sctx, deps, flags)
 	if err != nil {
@@ -123,9 +130,8 @@ func (t *flannelService) Init(sctx *service.ServiceContext, deps service.Service
 		return maskAny(err)
 	}
 
-	// Render net-conf.json
-	netConfOpts := struct{}{}
-	netConf, err := util.RenderToString(log, netConfTemplate, netConfOpts)
+	// Create net-conf.json
+	netConf, err := createNetConf(flags)
 	if err != nil {
 		return maskAny(err)
 	}
@@ -149,8 +155,19 @@ func (t *flannelService) Init(sctx *service.ServiceContext, deps service.Service
 		return maskAny(err)
 	}
 
+	// Prepare flanneld arguments
+	command := []string{
+		"/opt/bin/flanneld",
+		"--ip-masq",
+		"--kube-subnet-mgr",
+	}
+	if flags.Flannel.Interface != "" {
+		command = append(command, "--iface="+flags.Flannel.Interface)
+	}
+
 	// Create flannel daemonset
-	for _, arch := range sctx.AllArchitectures() {
+	for _, dsArch := range sctx.DaemonSetArchitectures() {
+		arch := dsArch.Name
 		ds := &appsv1.DaemonSet{
 			Metadata: &metav1.ObjectMeta{
 				Name:      k8s.String("kube-flannel-ds-" + arch),
@@ -193,12 +210,12 @@ func (t *flannelService) Init(sctx *service.ServiceContext, deps service.Service
 						InitContainers: []*corev1.Container{
 							&corev1.Container{
 								Name:    k8s.String("install-cni"),
-								Image:   k8s.String(flags.Images.FlannelImage(arch)),
+								Image:   k8s.String(flags.Images.FlannelImage(dsArch.ImageArchitecture)),
 								Command: []string{"cp"},
 								Args: []string{
 									"-f",
 									"/etc/kube-flannel/cni-conf.json",
-									"/etc/cni/net.d/10-flannel.conf",
+									cniConfPath,
 								},
 								VolumeMounts: []*corev1.VolumeMount{
 									&corev1.VolumeMount{
@@ -215,12 +232,8 @@ func (t *flannelService) Init(sctx *service.ServiceContext, deps service.Service
 						Containers: []*corev1.Container{
 							&corev1.Container{
 								Name:  k8s.String("kube-flannel"),
-								Image: k8s.String(flags.Images.FlannelImage(arch)),
-								Command: []string{
-									"/opt/bin/flanneld",
-									"--ip-masq",
-									"--kube-subnet-mgr",
-								},
+								Image: k8s.String(flags.Images.FlannelImage(dsArch.ImageArchitecture)),
+								Command: command,
 								Env: []*corev1.EnvVar{
 									&corev1.EnvVar{
 										Name:      k8s.String("POD_NAME"),
@@ -285,3 +298,69 @@ func (t *flannelService) Init(sctx *service.ServiceContext, deps service.Service
 
 	return nil
 }
+
+// ResetMachine removes the CNI configuration & network interfaces of flannel from the machine.
+func (t *flannelProvider) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	// Remove CNI config
+	if err := client.RemoveFile(ctx, log, cniConfPath); err != nil {
+		return maskAny(err)
+	}
+
+	// Remove state
+	if err := client.RemoveDirectory(ctx, log, "/run/flannel"); err != nil {
+		return maskAny(err)
+	}
+
+	// Remove network interfaces
+	for _, name := range interfaces {
+		if _, err := client.Run(ctx, log, fmt.Sprintf("sudo sh -c 'if ip link show %s >/dev/null 2>&1; then ip link delete %s; fi'", name, name), "", true); err != nil {
+			log.Warn().Err(err).Msgf("Failed to remove network interface %s", name)
+		}
+	}
+
+	return nil
+}
+
+// netConf is the network configuration of flannel (net-conf.json).
+type netConf struct {
+	Network   string
+	SubnetLen int
+	Backend   netConfBackend
+}
+
+// netConfBackend is the backend configuration of flannel.
+type netConfBackend struct {
+	Type          string
+	VNI           int    `json:",omitempty"`
+	Port          int    `json:",omitempty"`
+	DirectRouting bool   `json:",omitempty"`
+	ListenPort    int    `json:",omitempty"`
+	PSK           string `json:",omitempty"`
+}
+
+// createNetConf returns the content of net-conf.json for the given flags.
+func createNetConf(flags service.ServiceFlags) (string, error) {
+	conf := netConf{
+		Network:   flags.Kubernetes.PodNetworkCIDR,
+		SubnetLen: flags.Kubernetes.NodeCIDRMaskSize,
+		Backend:   netConfBackend{Type: flags.Flannel.Backend},
+	}
+	switch flags.Flannel.Backend {
+	case service.FlannelBackendVXLAN:
+		conf.Backend.VNI = flags.Flannel.VNI
+		conf.Backend.Port = flags.Flannel.Port
+		conf.Backend.DirectRouting = flags.Flannel.DirectRouting
+	case service.FlannelBackendIPSec:
+		conf.Backend.PSK = flags.Flannel.PSK
+	case service.FlannelBackendWireguard:
+		conf.Backend.ListenPort = flags.Flannel.Port
+		conf.Backend.PSK = flags.Flannel.PSK
+	}
+	raw, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return "", maskAny(err)
+	}
+	return string(raw), nil
+}
@@ -22,12 +22,5 @@ const (
     "delegate": {
       "isDefaultGateway": true
     }
-  }`
-	netConfTemplate = `
-  {
-    "Network": "10.244.0.0/16",
-    "Backend": {
-      "Type": "vxlan"
-    }
   }`
 )
@@ -15,6 +15,7 @@
 package hyperkube
 
 import (
+	"context"
 	"os"
 
 	"github.com/pkg/errors"
@@ -45,12 +46,12 @@ func (t *hyperkubeService) Name() string {
 	return ServiceName
 }
 
-func (t *hyperkubeService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *hyperkubeService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	return nil
 }
 
 // InitMachine configures the machine to run download hyperkube.
-func (t *hyperkubeService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *hyperkubeService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 	cfg, err := t.createConfig(node, client, deps, flags)
 	if err != nil {
@@ -59,18 +60,18 @@ func (t *hyperkubeService) InitMachine(node service.Node, client util.SSHClient,
 
 	// Create service
 	log.Info().Msg("Creating Hyperkube Service")
-	if err := createService(client, deps, cfg); err != nil {
+	if err := createService(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
 	// Restart service
-	if _, err := client.Run(log, "sudo systemctl daemon-reload", "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl daemon-reload", "", false); err != nil {
 		return maskAny(err)
 	}
-	if _, err := client.Run(log, "sudo systemctl enable "+ServiceName, "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl enable "+ServiceName, "", false); err != nil {
 		return maskAny(err)
 	}
-	if _, err := client.Run(log, "sudo systemctl restart "+ServiceName, "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl restart "+ServiceName, "", false); err != nil {
 		return maskAny(err)
 	}
 
@@ -78,7 +79,7 @@ func (t *hyperkubeService) InitMachine(node service.Node, client util.SSHClient,
 }
 
 // ResetMachine removes hyperkube from the machine.
-func (t *hyperkubeService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *hyperkubeService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 	cfg, err := t.createConfig(node, client, deps, flags)
 	if err != nil {
@@ -86,23 +87,23 @@ func (t *hyperkubeService) ResetMachine(node service.Node, client util.SSHClient
 	}
 
 	// Stop service
-	if _, err := client.Run(log, "sudo systemctl stop "+ServiceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl stop "+ServiceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to stop hyperkube server")
 	}
-	if _, err := client.Run(log, "sudo systemctl disable "+ServiceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl disable "+ServiceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to disable hyperkube server")
 	}
 
 	// Remove service
-	if err := client.RemoveFile(log, servicePath); err != nil {
+	if err := client.RemoveFile(ctx, log, servicePath); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove binaries
-	if err := client.RemoveFile(log, cfg.KubeCtlPath); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.KubeCtlPath); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, cfg.HyperKubePath); err != nil {
+	if err := client.RemoveFile(ctx, log, cfg.HyperKubePath); err != nil {
 		return maskAny(err)
 	}
 
@@ -114,6 +115,8 @@ type config struct {
 	KubernetesVersion string // Version number of kubernetes
 	HyperKubePath     string
 	KubeCtlPath       string
+	RuntimeUnit       string // Name of the systemd unit of the container runtime
+	Runtime           string // Name of the container runtime (docker|containerd)
 }
 
 func (t *hyperkubeService) createConfig(node service.Node, client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
@@ -122,14 +125,16 @@ func (t *hyperkubeService) createConfig(node service.Node, client util.SSHClient
 		KubernetesVersion: flags.Kubernetes.Version,
 		HyperKubePath:     "/usr/local/bin/hyperkube-" + flags.Kubernetes.Version,
 		KubeCtlPath:       "/usr/local/bin/kubectl",
+		RuntimeUnit:       flags.ContainerRuntime.SystemdUnit(),
+		Runtime:           flags.ContainerRuntime.Name,
 	}
 
 	return result, nil
 }
 
-func createService(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+func createService(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating service %s", servicePath)
-	if err := client.Render(deps.Logger, hyperkubeServiceTemplate, servicePath, opts, serviceFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, hyperkubeServiceTemplate, servicePath, opts, serviceFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
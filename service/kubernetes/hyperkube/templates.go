@@ -17,13 +17,17 @@ package hyperkube
 const (
 	hyperkubeServiceTemplate = `[Unit]
 Description=Kubernetes Hyperkube Installer
-Requires=docker.service network-online.target
-After=docker.service network-online.target
+Requires={{ .RuntimeUnit }} network-online.target
+After={{ .RuntimeUnit }} network-online.target
 
 [Service]
 Type=oneshot
 ExecStartPre=/bin/mkdir -p /usr/local/bin
-ExecStartPre=/bin/sh -c "test -f {{ .HyperKubePath }} || /usr/bin/docker run --rm -v /usr/local/bin:/usr/local/bin {{.Image}} cp /hyperkube {{ .HyperKubePath }}"
+{{- if eq .Runtime "containerd" }}
+ExecStartPre=/bin/sh -c "test -f {{ .HyperKubePath }} || (/usr/bin/ctr -n k8s.io containers rm helix-extract-hyperkube >/dev/null 2>&1; /usr/bin/ctr -n k8s.io images pull {{ .Image }} && /usr/bin/ctr -n k8s.io run --rm --mount type=bind,src=/usr/local/bin,dst=/helix-out,options=rbind:rw {{ .Image }} helix-extract-hyperkube cp /hyperkube /helix-out/hyperkube-{{ .KubernetesVersion }})"
+{{- else }}
+ExecStartPre=/bin/sh -c "test -f {{ .HyperKubePath }} || /usr/bin/docker run --rm -v /usr/local/bin:/usr/local/bin {{ .Image }} cp /hyperkube {{ .HyperKubePath }}"
+{{- end }}
 ExecStart=/bin/sh -c "test -e {{ .KubeCtlPath }} || ln -sf {{ .HyperKubePath }} {{ .KubeCtlPath }}"
 Restart=no
 RemainAfterExit=yes
@@ -15,9 +15,15 @@
 package keepalived
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 
 	"github.com/pulcy/helix/service"
 	"github.com/pulcy/helix/service/kubernetes/component"
@@ -49,37 +55,42 @@ func (t *keepalivedService) Name() string {
 	return "keepalived"
 }
 
-func (t *keepalivedService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+// IsDisruptive returns true.
+func (t *keepalivedService) IsDisruptive() bool {
+	return true
+}
+
+func (t *keepalivedService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.Component.Name = "keepalived"
 	return nil
 }
 
 // InitMachine configures the machine to run apiserver.
-func (t *keepalivedService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *keepalivedService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
-	// Setup controlplane on this host?
-	if !node.IsControlPlane || flags.ControlPlane.APIServerVirtualIP == "" {
+	// Setup keepalived on this host?
+	if sctx.GetVirtualIPNodeIndex(node) < 0 {
 		log.Info().Msg("No keepalived on this machine")
 		return nil
 	}
 
-	cfg, err := t.createConfig(node, client, sctx, deps, flags)
+	cfg, err := t.createConfig(ctx, node, client, sctx, deps, flags)
 	if err != nil {
 		return maskAny(err)
 	}
 
 	// Create & Upload keepalived.conf
 	log.Info().Msgf("Uploading %s Config", t.Name())
-	if err := createConfigFile(client, deps, cfg); err != nil {
+	if err := createConfigFile(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
-	if err := createAPIServerCheck(client, deps, cfg); err != nil {
+	if err := createAPIServerCheck(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
 	// Restart keepalived
-	if _, err := client.Run(log, "sudo systemctl restart "+serviceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl restart "+serviceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to restart keepalived server")
 	}
 
@@ -87,25 +98,25 @@ func (t *keepalivedService) InitMachine(node service.Node, client util.SSHClient
 }
 
 // ResetMachine removes keepalived from the machine.
-func (t *keepalivedService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *keepalivedService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
-	// Setup controlplane on this host?
-	if !node.IsControlPlane || flags.ControlPlane.APIServerVirtualIP == "" {
+	// Setup keepalived on this host?
+	if sctx.GetVirtualIPNodeIndex(node) < 0 {
 		log.Info().Msg("No keepalived on this machine")
 		return nil
 	}
 
 	// Remove config & check-script file
-	if err := client.RemoveFile(log, confPath); err != nil {
+	if err := client.RemoveFile(ctx, log, confPath); err != nil {
 		return maskAny(err)
 	}
-	if err := client.RemoveFile(log, apiServerCheckScriptPath); err != nil {
+	if err := client.RemoveFile(ctx, log, apiServerCheckScriptPath); err != nil {
 		return maskAny(err)
 	}
 
 	// Restart keepalived
-	if _, err := client.Run(log, "sudo systemctl restart "+serviceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl restart "+serviceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to restart keepalived server")
 	}
 
@@ -113,41 +124,107 @@ func (t *keepalivedService) ResetMachine(node service.Node, client util.SSHClien
 }
 
 type config struct {
+	RouterName   string // Name of this node in VRRP
 	VirtualIP    string
+	VirtualURL   string // URL of the apiserver at the virtual IP
+	LocalURL     string // URL of the apiserver (or load-balancer) on this node
 	State        string
-	Interface    string
+	Interface    string // Interface that holds the virtual IP
+	RouterID     int    // VRRP virtual router ID
 	Priority     int
-	AuthPassword string
+	AuthPassword string   // VRRP password (IPv4 only, VRRPv3 has no authentication)
+	UnicastSrcIP string   // Address of this node (unicast only)
+	UnicastPeers []string // Addresses of the other nodes (unicast only)
 }
 
-func (t *keepalivedService) createConfig(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
-	cpIndex := sctx.GetControlPlaneIndex(node)
+func (t *keepalivedService) createConfig(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
+	index := sctx.GetVirtualIPNodeIndex(node)
 	state := "BACKUP"
-	if cpIndex == 0 {
+	if index == 0 {
 		state = "MASTER"
 	}
+	// Check the load-balancer on this node (if any), otherwise the apiserver
+	localPort := service.APIServerPort
+	if sctx.IsLoadBalancerNode(node) {
+		localPort = flags.LoadBalancer.Port
+	}
+	vip := flags.ControlPlane.APIServerVirtualIP
+	ipv6 := strings.Contains(vip, ":")
+	iface := flags.Keepalived.Interface
+	if iface == "" {
+		var err error
+		iface, err = detectInterface(ctx, deps.Logger.With().Str("host", node.Name).Logger(), client, vip, ipv6)
+		if err != nil {
+			if !flags.DryRun {
+				return config{}, maskAny(err)
+			}
+			iface = "<detected-interface>"
+		}
+	}
 	result := config{
-		VirtualIP:    flags.ControlPlane.APIServerVirtualIP,
-		State:        state,
-		Interface:    "eth0",
-		Priority:     100 - cpIndex,
-		AuthPassword: "foo",
+		RouterName: node.Name,
+		VirtualIP:  vip,
+		VirtualURL: "https://" + net.JoinHostPort(vip, strconv.Itoa(sctx.GetAPIServerPort())) + "/",
+		LocalURL:   "https://" + net.JoinHostPort("localhost", strconv.Itoa(localPort)) + "/",
+		State:      state,
+		Interface:  iface,
+		RouterID:   flags.Keepalived.RouterID,
+		Priority:   100 - index,
+	}
+	if !ipv6 {
+		result.AuthPassword = deps.KeepalivedPassword
+	}
+	if flags.Keepalived.Unicast {
+		result.UnicastSrcIP = node.GetInternalAddress()
+		for _, n := range sctx.VirtualIPNodes() {
+			if n.Name != node.Name {
+				result.UnicastPeers = append(result.UnicastPeers, n.GetInternalAddress())
+			}
+		}
 	}
 
 	return result, nil
 }
 
-func createConfigFile(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+// detectInterface returns the name of the network interface used to reach the given virtual IP.
+func detectInterface(ctx context.Context, log zerolog.Logger, client util.SSHClient, vip string, ipv6 bool) (string, error) {
+	family := "-4"
+	if ipv6 {
+		family = "-6"
+	}
+	// Is the virtual IP already held by this node?
+	// Output looks like: "2: enp1s0    inet 192.168.1.10/32 scope global enp1s0"
+	if out, err := client.Run(ctx, log, fmt.Sprintf("ip %s -o addr show to %s", family, vip), "", true); err == nil {
+		if fields := strings.Fields(out); len(fields) > 1 {
+			return strings.TrimSuffix(fields[1], ":"), nil
+		}
+	}
+	// Use the interface of the route to the virtual IP
+	// Output looks like: "192.168.1.10 dev enp1s0 src 192.168.1.11 uid 0 \    cache"
+	out, err := client.Run(ctx, log, fmt.Sprintf("ip %s -o route get %s", family, vip), "", true)
+	if err != nil {
+		return "", maskAny(fmt.Errorf("Cannot find route to virtual IP %s: %v", vip, err))
+	}
+	fields := strings.Fields(out)
+	for i, f := range fields {
+		if f == "dev" && i+1 < len(fields) {
+			return fields[i+1], nil
+		}
+	}
+	return "", maskAny(fmt.Errorf("Cannot detect interface of route to virtual IP %s, set keepalived.interface", vip))
+}
+
+func createConfigFile(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating config %s", confPath)
-	if err := client.Render(deps.Logger, keepalivedConfTemplate, confPath, opts, confFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, keepalivedConfTemplate, confPath, opts, confFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
 }
 
-func createAPIServerCheck(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+func createAPIServerCheck(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating check script %s", apiServerCheckScriptPath)
-	if err := client.Render(deps.Logger, checkAPIServerTemplate, apiServerCheckScriptPath, opts, scriptFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, checkAPIServerTemplate, apiServerCheckScriptPath, opts, scriptFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -18,7 +18,7 @@ const (
 	keepalivedConfTemplate = `
 ! Configuration File for keepalived
 global_defs {
-  router_id LVS_DEVEL
+  router_id {{.RouterName}}
 }
 
 vrrp_script check_apiserver {
@@ -32,12 +32,22 @@ vrrp_script check_apiserver {
 vrrp_instance VI_1 {
   state {{.State}}
   interface {{.Interface}}
-  virtual_router_id 51
+  virtual_router_id {{.RouterID}}
   priority {{.Priority}}
+{{- if .AuthPassword }}
   authentication {
       auth_type PASS
       auth_pass {{.AuthPassword}}
   }
+{{- end }}
+{{- if .UnicastSrcIP }}
+  unicast_src_ip {{.UnicastSrcIP}}
+  unicast_peer {
+{{- range .UnicastPeers }}
+    {{.}}
+{{- end }}
+  }
+{{- end }}
   virtual_ipaddress {
     {{.VirtualIP}}
   }
@@ -54,9 +64,9 @@ errorExit() {
   exit 1
 }
 
-curl --silent --max-time 2 --insecure https://localhost:6443/ -o /dev/null || errorExit "Error GET https://localhost:6443/"
+curl --silent --max-time 2 --insecure {{.LocalURL}} -o /dev/null || errorExit "Error GET {{.LocalURL}}"
 if ip addr | grep -q {{.VirtualIP}}; then
-  curl --silent --max-time 2 --insecure https://{{.VirtualIP}}:6443/ -o /dev/null || errorExit "Error GET https://{{.VirtualIP}}:6443/"
+  curl --silent --max-time 2 --insecure {{.VirtualURL}} -o /dev/null || errorExit "Error GET {{.VirtualURL}}"
 fi
 `
 )
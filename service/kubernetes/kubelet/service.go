@@ -15,6 +15,8 @@
 package kubelet
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"strings"
 
@@ -32,8 +34,19 @@ var (
 const (
 	serviceName = "kubelet"
 	servicePath = "/etc/systemd/system/" + serviceName + ".service"
+	configPath  = "/var/lib/kubelet/config.yaml"
 
 	serviceFileMode = os.FileMode(0644)
+	configFileMode  = os.FileMode(0644)
+
+	// Minimum kubernetes version that supports cgroup v2
+	minCgroupV2Version = "v1.19.0"
+	// Minimum kubernetes version that does not allow the kubelet to set node-role labels
+	minRestrictedLabelsVersion = "v1.16.0"
+	nodeRoleLabelPrefix        = "node-role.kubernetes.io/"
+	// Minimum kubernetes version that enables rotation of kubelet serving certificates by default
+	minServerCertRotationDefaultVersion = "v1.12.0"
+	serverCertRotationFeatureGate       = "RotateKubeletServerCertificate"
 )
 
 func NewService() service.Service {
@@ -43,58 +56,154 @@ func NewService() service.Service {
 type kubeletService struct {
 	component.Component
 	bootstrap component.Component
+	willInit  bool
 }
 
 func (t *kubeletService) Name() string {
 	return "kubelet"
 }
 
-func (t *kubeletService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+// IsDisruptive returns true.
+func (t *kubeletService) IsDisruptive() bool {
+	return true
+}
+
+func (t *kubeletService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.Component.Name = t.Name()
 	t.bootstrap.Name = "bootstrap-kubelet"
+	t.willInit = willInit
 	return nil
 }
 
-// InitMachine configures the machine to run kubelet.
-func (t *kubeletService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+// InitNode detects the cgroup driver of the container runtime and the cgroup version of the node.
+func (t *kubeletService) InitNode(ctx context.Context, node *service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
-	cfg, err := t.createConfig(node, client, deps, flags)
-	if err != nil {
-		return maskAny(err)
+
+	if !t.willInit || flags.DryRun {
+		// No need to detect anything
+		return nil
 	}
 
-	// Create & Upload certificates
-	if err := t.Component.UploadCertificates("system:node:"+node.Name, "system:nodes", client, deps); err != nil {
-		return maskAny(err)
+	// Detect cgroup version
+	if node.CgroupVersion == 0 {
+		fsType, err := client.Run(ctx, log, "stat -fc %T /sys/fs/cgroup", "", true)
+		if err != nil {
+			return maskAny(err)
+		}
+		if strings.TrimSpace(fsType) == "cgroup2fs" {
+			node.CgroupVersion = 2
+		} else {
+			node.CgroupVersion = 1
+		}
+	}
+
+	// Detect cgroup driver
+	if node.CgroupDriver == "" {
+		var driver string
+		if flags.ContainerRuntime.IsContainerd() {
+			dump, err := client.Run(ctx, log, "sudo containerd config dump", "", true)
+			if err != nil {
+				return maskAny(err)
+			}
+			driver = containerdCgroupDriver(dump)
+		} else {
+			result, err := client.Run(ctx, log, "sudo docker info --format '{{.CgroupDriver}}'", "", true)
+			if err != nil {
+				return maskAny(err)
+			}
+			driver = strings.TrimSpace(result)
+		}
+		switch driver {
+		case service.CgroupDriverCgroupfs, service.CgroupDriverSystemd:
+			node.CgroupDriver = driver
+		default:
+			return maskAny(fmt.Errorf("Unsupported cgroup driver '%s'", driver))
+		}
 	}
+	log.Info().Msgf("Found '%s' cgroup driver with cgroup v%d on node", node.CgroupDriver, node.CgroupVersion)
 
-	// Create & Upload bootstrap kubeconfig
-	cn := "system:node:" + strings.ToLower(node.Name)
-	if err := t.bootstrap.CreateKubeConfig(cn, "system:nodes", client, sctx, deps, flags); err != nil {
+	// Check for mismatches
+	if expected := flags.Kubernetes.CgroupDriver; expected != "" && expected != node.CgroupDriver {
+		return maskAny(fmt.Errorf("%s uses cgroup driver '%s', expected '%s'", flags.ContainerRuntime.Name, node.CgroupDriver, expected))
+	}
+	if node.CgroupVersion == 2 && util.CompareVersions(flags.Kubernetes.Version, minCgroupV2Version) < 0 {
+		return maskAny(fmt.Errorf("Node uses cgroup v2, which requires kubernetes %s or higher", minCgroupV2Version))
+	}
+
+	return nil
+}
+
+// InitMachine configures the machine to run kubelet.
+func (t *kubeletService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+	cfg, err := t.createConfig(node, client, deps, flags)
+	if err != nil {
 		return maskAny(err)
 	}
 
-	// Create & Upload kubeconfig (if control plan)
-	if node.IsControlPlane || true {
-		if err := t.CreateKubeConfig(cn, "system:nodes", client, sctx, deps, flags); err != nil {
+	if node.IsControlPlane {
+		// Control-plane kubelets run the static pods of the apiserver,
+		// so they cannot request certificates from it.
+		if err := t.Component.UploadCertificates(ctx, "system:node:"+node.Name, "system:nodes", client, deps, node.GetInternalAddress()); err != nil {
+			return maskAny(err)
+		}
+		cn := "system:node:" + strings.ToLower(node.Name)
+		if err := t.CreateKubeConfig(ctx, cn, "system:nodes", client, sctx, deps, flags); err != nil {
+			return maskAny(err)
+		}
+		if err := t.bootstrap.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
+			return maskAny(err)
+		}
+	} else if cfg.Standalone {
+		// Standalone kubelets only run static pods (etcd, load-balancer),
+		// so they do not need a connection to the apiserver.
+		if err := t.Component.UploadCertificates(ctx, "system:node:"+node.Name, "system:nodes", client, deps, node.GetInternalAddress()); err != nil {
 			return maskAny(err)
 		}
+		if err := t.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
+			return maskAny(err)
+		}
+		if err := t.bootstrap.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
+			return maskAny(err)
+		}
+	} else {
+		// Create & Upload bootstrap kubeconfig, used to request a client certificate
+		if err := t.bootstrap.CreateBootstrapKubeConfig(ctx, deps.BootstrapToken, client, sctx, deps, flags); err != nil {
+			return maskAny(err)
+		}
+		// Remove serving certificate created by helix itself,
+		// such that the kubelet requests its own certificate.
+		if err := t.Component.RemoveCertificates(ctx, client, deps); err != nil {
+			return maskAny(err)
+		}
+		// Remove kubeconfig containing a client certificate created by helix itself,
+		// such that the kubelet requests its own certificate.
+		kubeConfigPath := t.KubeConfigPath()
+		if _, err := client.Run(ctx, log, fmt.Sprintf("sudo sh -c 'if grep -qs client-certificate-data %s; then rm -f %s; fi'", kubeConfigPath, kubeConfigPath), "", true); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Create config file
+	log.Info().Msg("Creating Kubelet Configuration")
+	if err := createConfigFile(ctx, client, deps, cfg); err != nil {
+		return maskAny(err)
 	}
 
 	// Create service
 	log.Info().Msg("Creating Kubelet Service")
-	if err := createService(client, deps, cfg); err != nil {
+	if err := createService(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
 	// Restart service
-	if _, err := client.Run(log, "sudo systemctl daemon-reload", "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl daemon-reload", "", false); err != nil {
 		return maskAny(err)
 	}
-	if _, err := client.Run(log, "sudo systemctl enable "+serviceName, "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl enable "+serviceName, "", false); err != nil {
 		return maskAny(err)
 	}
-	if _, err := client.Run(log, "sudo systemctl restart "+serviceName, "", false); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl restart "+serviceName, "", false); err != nil {
 		return maskAny(err)
 	}
 
@@ -102,81 +211,160 @@ func (t *kubeletService) InitMachine(node service.Node, client util.SSHClient, s
 }
 
 // ResetMachine removes kubelet from the machine.
-func (t *kubeletService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *kubeletService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Stop service
-	if _, err := client.Run(log, "sudo systemctl stop "+serviceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl stop "+serviceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to stop kubelet service")
 	}
-	if _, err := client.Run(log, "sudo systemctl disable "+serviceName, "", true); err != nil {
+	if _, err := client.Run(ctx, log, "sudo systemctl disable "+serviceName, "", true); err != nil {
 		log.Warn().Err(err).Msg("Failed to disable kubelet service")
 	}
 
 	// Remove service
-	if err := client.RemoveFile(log, servicePath); err != nil {
+	if err := client.RemoveFile(ctx, log, servicePath); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove certificates
-	if err := t.Component.RemoveCertificates(client, deps); err != nil {
+	if err := t.Component.RemoveCertificates(ctx, client, deps); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove kubeconfig
-	if err := t.RemoveKubeConfig(client, deps, flags); err != nil {
+	if err := t.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove bootstrap kubeconfig
-	if err := t.bootstrap.RemoveKubeConfig(client, deps, flags); err != nil {
+	if err := t.bootstrap.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
 		return maskAny(err)
 	}
 
 	// Remove data dir
-	if err := client.RemoveDirectory(log, "/var/lib/kubelet"); err != nil {
+	if err := client.RemoveDirectory(ctx, log, "/var/lib/kubelet"); err != nil {
 		return maskAny(err)
 	}
 
 	return nil
 }
 
+// containerdCgroupDriver returns the cgroup driver configured in the given containerd configuration dump.
+// The systemd driver is enabled by the legacy `systemd_cgroup` option of the CRI plugin
+// or by the `SystemdCgroup` option of the runc runtime.
+func containerdCgroupDriver(dump string) string {
+	for _, line := range strings.Split(dump, "\n") {
+		switch strings.Join(strings.Fields(line), "") {
+		case "systemd_cgroup=true", "SystemdCgroup=true":
+			return service.CgroupDriverSystemd
+		}
+	}
+	return service.CgroupDriverCgroupfs
+}
+
 type config struct {
-	KubernetesVersion       string // Version number of kubernetes
-	ClusterDNS              string // Comma-separated list of DNS server IP address.
-	ClusterDomain           string // Domain for this cluster.
-	FeatureGates            string // Feature gates to use
-	BootstrapKubeConfigPath string // Path to a bootstrap-kubeconfig file, specifying how to connect to the API server.
-	KubeConfigPath          string // Path to a bootstrap-kubeconfig file, specifying how to connect to the API server.
-	NodeLabels              string // Labels to add when registering the node in the cluster.
-	CertPath                string // File containing x509 Certificate used for serving HTTPS (with intermediate certs, if any, concatenated after server cert).
-	KeyPath                 string // File containing x509 private key matching CertPath
-	ClientCAPath            string // Path of --client-ca-file
+	KubernetesVersion       string          // Version number of kubernetes
+	ConfigPath              string          // Path of the KubeletConfiguration file
+	ClusterDNS              []string        // IP addresses of DNS servers
+	ClusterDomain           string          // Domain for this cluster.
+	FeatureGates            map[string]bool // Feature gates to use
+	BootstrapKubeConfigPath string          // Path to a bootstrap-kubeconfig file, used to request a client certificate (empty on control-plane nodes).
+	KubeConfigPath          string          // Path to a kubeconfig file, specifying how to connect to the API server (empty for standalone kubelets).
+	NodeLabels              string          // Labels to add when registering the node in the cluster.
+	RegisterTaints          string          // Taints to add when registering the node in the cluster.
+	HostnameOverride        string          // Name of the node (empty to use the hostname)
+	CertPath                string          // File containing x509 Certificate used for serving HTTPS (with intermediate certs, if any, concatenated after server cert), empty on worker nodes.
+	KeyPath                 string          // File containing x509 private key matching CertPath, empty on worker nodes.
+	ServerTLSBootstrap      bool            // If set, the kubelet requests its serving certificate from the apiserver (worker nodes).
+	Standalone              bool            // If set, the kubelet only runs static pods and does not register the node (etcd & load-balancer only nodes).
+	ClientCAPath            string          // Path of the CA used to authenticate clients
+	CgroupDriver            string          // Cgroup driver used by the container runtime
+	NodeIP                  string          // IP address of the node (empty to let kubelet choose)
+	RuntimeUnit             string          // Name of the systemd unit of the container runtime
+	RuntimeEndpoint         string          // CRI endpoint of a remote container runtime (empty for docker)
+	Kubelet                 service.Kubelet // Kubelet settings of the node
 }
 
 func (t *kubeletService) createConfig(node service.Node, client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
+	kubeletFlags, err := flags.KubeletFor(node)
+	if err != nil {
+		return config{}, maskAny(err)
+	}
+	featureGates, err := flags.Kubernetes.FeatureGateMap()
+	if err != nil {
+		return config{}, maskAny(err)
+	}
 	result := config{
 		KubernetesVersion:       flags.Kubernetes.Version,
-		ClusterDNS:              flags.Kubernetes.ClusterDNS,
+		ConfigPath:              configPath,
+		ClusterDNS:              strings.Split(flags.Kubernetes.ClusterDNS, ","),
 		ClusterDomain:           flags.Kubernetes.ClusterDomain,
-		FeatureGates:            strings.Join(flags.Kubernetes.FeatureGates, ","),
-		BootstrapKubeConfigPath: t.bootstrap.KubeConfigPath(),
-		KubeConfigPath:          "",
+		FeatureGates:            featureGates,
+		BootstrapKubeConfigPath: "",
+		KubeConfigPath:          t.KubeConfigPath(),
 		NodeLabels:              "",
-		CertPath:                t.CertPath(),
-		KeyPath:                 t.KeyPath(),
+		RegisterTaints:          service.FormatTaints(node.KubernetesTaints(flags.ControlPlane)),
+		CertPath:                "",
+		KeyPath:                 "",
 		ClientCAPath:            t.CACertPath(),
+		CgroupDriver:            node.CgroupDriver,
+		NodeIP:                  node.InternalAddress,
+		RuntimeUnit:             flags.ContainerRuntime.SystemdUnit(),
+		RuntimeEndpoint:         flags.ContainerRuntime.RemoteEndpoint(),
+		Kubelet:                 kubeletFlags,
+	}
+	if node.IsControlPlane {
+		result.CertPath = t.CertPath()
+		result.KeyPath = t.KeyPath()
+	} else if !node.IsKubernetesNode() {
+		result.Standalone = true
+		result.KubeConfigPath = ""
+		result.RegisterTaints = ""
+		result.CertPath = t.CertPath()
+		result.KeyPath = t.KeyPath()
+	} else {
+		result.BootstrapKubeConfigPath = t.bootstrap.KubeConfigPath()
+		result.ServerTLSBootstrap = true
+		if _, found := featureGates[serverCertRotationFeatureGate]; !found && util.CompareVersions(flags.Kubernetes.Version, minServerCertRotationDefaultVersion) < 0 {
+			featureGates[serverCertRotationFeatureGate] = true
+		}
+	}
+	labels := node.KubernetesLabels()
+	if util.CompareVersions(flags.Kubernetes.Version, minRestrictedLabelsVersion) >= 0 {
+		// These labels are set through the API
+		for k := range labels {
+			if strings.HasPrefix(k, nodeRoleLabelPrefix) {
+				delete(labels, k)
+			}
+		}
+	}
+	result.NodeLabels = service.FormatLabels(labels)
+	if node.IsInInventory() {
+		result.HostnameOverride = strings.ToLower(node.Name)
 	}
-	if node.IsControlPlane || true {
-		result.KubeConfigPath = t.KubeConfigPath()
+	if result.CgroupDriver == "" {
+		// Not detected (dry-run)
+		result.CgroupDriver = flags.Kubernetes.CgroupDriver
+		if result.CgroupDriver == "" {
+			result.CgroupDriver = service.CgroupDriverCgroupfs
+		}
 	}
 
 	return result, nil
 }
 
-func createService(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+func createConfigFile(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+	deps.Logger.Info().Msgf("Creating config %s", configPath)
+	if err := client.Render(ctx, deps.Logger, kubeletConfigTemplate, configPath, opts, configFileMode); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+func createService(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating service %s", servicePath)
-	if err := client.Render(deps.Logger, kubeletServiceTemplate, servicePath, opts, serviceFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, kubeletServiceTemplate, servicePath, opts, serviceFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -0,0 +1,42 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubelet
+
+import (
+	"testing"
+
+	"github.com/pulcy/helix/service"
+)
+
+func TestContainerdCgroupDriver(t *testing.T) {
+	tests := []struct {
+		name     string
+		dump     string
+		expected string
+	}{
+		{"empty", "", service.CgroupDriverCgroupfs},
+		{"legacy", "[plugins.cri]\n  systemd_cgroup = true\n", service.CgroupDriverSystemd},
+		{"legacy disabled", "[plugins.cri]\n  systemd_cgroup = false\n", service.CgroupDriverCgroupfs},
+		{"runc options", "[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n\t\tSystemdCgroup = true\n", service.CgroupDriverSystemd},
+		{"runc options disabled", "[plugins.\"io.containerd.grpc.v1.cri\".containerd.runtimes.runc.options]\n\t\tSystemdCgroup = false\n", service.CgroupDriverCgroupfs},
+		{"commented out", "# SystemdCgroup = true\n", service.CgroupDriverCgroupfs},
+		{"other key", "  NoSystemdCgroup = true\n", service.CgroupDriverCgroupfs},
+	}
+	for _, test := range tests {
+		if result := containerdCgroupDriver(test.dump); result != test.expected {
+			t.Errorf("%s: expected '%s', got '%s'", test.name, test.expected, result)
+		}
+	}
+}
@@ -17,8 +17,8 @@ package kubelet
 const (
 	kubeletServiceTemplate = `[Unit]
 Description=Kubernetes Kubelet Server
-Requires=docker.service network-online.target
-After=hyperkube.service cni-installer.service docker.service network-online.target
+Requires={{ .RuntimeUnit }} network-online.target
+After=hyperkube.service cni-installer.service {{ .RuntimeUnit }} network-online.target
 
 [Service]
 ExecStartPre=/bin/mkdir -p /opt/log/pods
@@ -30,27 +30,43 @@ ExecStartPre=/bin/mkdir -p /var/lib/kubelet
 #ExecStartPre=/bin/mount --make-shared /var/lib/kubelet
 ExecStart=/usr/local/bin/hyperkube-{{ .KubernetesVersion }} kubelet \
 		--allow-privileged=true \
-		--authorization-mode=AlwaysAllow \
+{{- if .BootstrapKubeConfigPath }}
 		--bootstrap-kubeconfig={{.BootstrapKubeConfigPath}} \
-		--cgroup-driver=cgroupfs \
-		--client-ca-file={{.ClientCAPath}} \
+{{- end }}
 		--cloud-provider= \
-		--cluster-dns={{.ClusterDNS}} \
-		--cluster-domain={{.ClusterDomain}} \
+{{- if not .Standalone }}
 		--cni-bin-dir=/opt/cni/bin \
 		--cni-conf-dir=/etc/cni/net.d \
+{{- end }}
+		--config={{.ConfigPath}} \
+{{- if .RuntimeEndpoint }}
+		--container-runtime=remote \
+		--container-runtime-endpoint={{ .RuntimeEndpoint }} \
+{{- else }}
 		--container-runtime=docker \
-		--feature-gates={{.FeatureGates}} \
-		--hairpin-mode=none \
+{{- end }}
+{{- if .HostnameOverride }}
+		--hostname-override={{.HostnameOverride}} \
+{{- end }}
+{{- if .KubeConfigPath }}
 		--kubeconfig={{.KubeConfigPath}} \
+{{- end }}
+{{- if not .Standalone }}
 		--network-plugin=cni \
+{{- end }}
+{{- if .NodeIP }}
+		--node-ip={{.NodeIP}} \
+{{- end }}
+{{- if .Standalone }}
+		--register-node=false \
+{{- else }}
 		--node-labels={{.NodeLabels}} \
-		--pod-manifest-path=/etc/kubernetes/manifests \
 		--register-node=true \
-		--rotate-certificates=true \
-		--tls-cert-file={{.CertPath}} \
-		--tls-private-key-file={{.KeyPath}} \
-		--v=2	  
+{{- end }}
+{{- if .RegisterTaints }}
+		--register-with-taints={{.RegisterTaints}} \
+{{- end }}
+		--v=2
 Restart=always
 StartLimitInterval=0
 RestartSec=10
@@ -58,4 +74,92 @@ KillMode=process
 
 [Install]
 WantedBy=multi-user.target`
+
+	kubeletConfigTemplate = `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+{{- if .Standalone }}
+    enabled: false
+{{- else }}
+    enabled: true
+    cacheTTL: 2m0s
+{{- end }}
+  x509:
+    clientCAFile: {{ .ClientCAPath }}
+authorization:
+{{- if .Standalone }}
+  mode: AlwaysAllow
+{{- else }}
+  mode: Webhook
+  webhook:
+    cacheAuthorizedTTL: 5m0s
+    cacheUnauthorizedTTL: 30s
+{{- end }}
+readOnlyPort: 0
+cgroupDriver: {{ .CgroupDriver }}
+clusterDNS:
+{{- range .ClusterDNS }}
+- {{ . }}
+{{- end }}
+clusterDomain: {{ .ClusterDomain }}
+{{- if .RuntimeEndpoint }}
+runtimeRequestTimeout: 15m
+{{- end }}
+{{- if .FeatureGates }}
+featureGates:
+{{- range $k, $v := .FeatureGates }}
+  {{ $k }}: {{ $v }}
+{{- end }}
+{{- end }}
+hairpinMode: none
+staticPodPath: /etc/kubernetes/manifests
+rotateCertificates: true
+{{- if .ServerTLSBootstrap }}
+serverTLSBootstrap: true
+{{- else }}
+tlsCertFile: {{ .CertPath }}
+tlsPrivateKeyFile: {{ .KeyPath }}
+{{- end }}
+tlsMinVersion: {{ .Kubelet.TLSMinVersion }}
+{{- if .Kubelet.TLSCipherSuites }}
+tlsCipherSuites:
+{{- range .Kubelet.TLSCipherSuites }}
+- {{ . }}
+{{- end }}
+{{- end }}
+maxPods: {{ .Kubelet.MaxPods }}
+{{- if .Kubelet.EvictionHard }}
+evictionHard:
+{{- range $k, $v := .Kubelet.EvictionHard }}
+  {{ $k }}: "{{ $v }}"
+{{- end }}
+{{- end }}
+{{- if .Kubelet.EvictionSoft }}
+evictionSoft:
+{{- range $k, $v := .Kubelet.EvictionSoft }}
+  {{ $k }}: "{{ $v }}"
+{{- end }}
+evictionSoftGracePeriod:
+{{- range $k, $v := .Kubelet.EvictionSoftGracePeriod }}
+  {{ $k }}: "{{ $v }}"
+{{- end }}
+{{- end }}
+{{- if .Kubelet.SystemReserved }}
+systemReserved:
+{{- range $k, $v := .Kubelet.SystemReserved }}
+  {{ $k }}: "{{ $v }}"
+{{- end }}
+{{- end }}
+{{- if .Kubelet.KubeReserved }}
+kubeReserved:
+{{- range $k, $v := .Kubelet.KubeReserved }}
+  {{ $k }}: "{{ $v }}"
+{{- end }}
+{{- end }}
+imageGCHighThresholdPercent: {{ .Kubelet.ImageGCHighThresholdPercent }}
+imageGCLowThresholdPercent: {{ .Kubelet.ImageGCLowThresholdPercent }}
+`
 )
@@ -0,0 +1,204 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeletauth
+
+import (
+	"context"
+	"time"
+
+	"github.com/ericchiang/k8s"
+	corev1 "github.com/ericchiang/k8s/apis/core/v1"
+	metav1 "github.com/ericchiang/k8s/apis/meta/v1"
+	rbacv1 "github.com/ericchiang/k8s/apis/rbac/v1"
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	// KubeletAPIClientUser is the user (common name) of the client certificate
+	// used by the apiserver to connect to kubelets.
+	KubeletAPIClientUser = "kube-apiserver-kubelet-client"
+
+	kubeletAPIAdminRole = "helix:kubelet-api-admin"
+
+	// Group of all users authenticated using the bootstrap token
+	bootstrappersGroup = "system:bootstrappers:helix"
+	// Duration the bootstrap token remains valid after the last run
+	bootstrapTokenTTL = time.Hour * 24
+)
+
+func NewService() service.Service {
+	return &kubeletAuthService{}
+}
+
+type kubeletAuthService struct {
+}
+
+func (t *kubeletAuthService) Name() string {
+	return "kubelet-auth"
+}
+
+func (t *kubeletAuthService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	return nil
+}
+
+// Init grants the apiserver access to the kubelet API and
+// allows worker kubelets to obtain a client certificate using the bootstrap token.
+func (t *kubeletAuthService) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger
+	if flags.DryRun {
+		log.Info().Msg("Will grant apiserver access to kubelet API")
+		log.Info().Msgf("Will create bootstrap token %s", deps.BootstrapToken.ID)
+		return nil
+	}
+
+	client, err := service.NewKubernetesClient(sctx, deps, flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	if err := t.initKubeletAPIAccess(ctx, client); err != nil {
+		return maskAny(err)
+	}
+	if err := t.initTLSBootstrap(ctx, client, deps); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// initKubeletAPIAccess grants the apiserver access to the kubelet API.
+// Kubelets authorize all requests using the apiserver, so without this
+// `kubectl logs/exec/port-forward` would fail.
+func (t *kubeletAuthService) initKubeletAPIAccess(ctx context.Context, client *k8s.Client) error {
+
+	// Create cluster role with access to the kubelet API
+	cr := &rbacv1.ClusterRole{
+		Metadata: &metav1.ObjectMeta{
+			Name: k8s.String(kubeletAPIAdminRole),
+		},
+		Rules: []*rbacv1.PolicyRule{
+			&rbacv1.PolicyRule{
+				ApiGroups: []string{""},
+				Resources: []string{"nodes"},
+				Verbs:     []string{"get", "list", "watch", "proxy"},
+			},
+			&rbacv1.PolicyRule{
+				ApiGroups: []string{""},
+				Resources: []string{"nodes/log", "nodes/metrics", "nodes/proxy", "nodes/spec", "nodes/stats"},
+				Verbs:     []string{"*"},
+			},
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, cr); err != nil {
+		return maskAny(err)
+	}
+
+	// Bind it to the apiserver-kubelet-client user
+	crb := &rbacv1.ClusterRoleBinding{
+		Metadata: &metav1.ObjectMeta{
+			Name: k8s.String(kubeletAPIAdminRole),
+		},
+		RoleRef: &rbacv1.RoleRef{
+			ApiGroup: k8s.String("rbac.authorization.k8s.io"),
+			Kind:     k8s.String("ClusterRole"),
+			Name:     k8s.String(kubeletAPIAdminRole),
+		},
+		Subjects: []*rbacv1.Subject{
+			&rbacv1.Subject{
+				ApiGroup: k8s.String("rbac.authorization.k8s.io"),
+				Kind:     k8s.String("User"),
+				Name:     k8s.String(KubeletAPIClientUser),
+			},
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, crb); err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// initTLSBootstrap creates the bootstrap token secret and the role bindings
+// needed by kubelets to request (and renew) their client certificate
+// and to have these requests approved automatically.
+func (t *kubeletAuthService) initTLSBootstrap(ctx context.Context, client *k8s.Client, deps service.ServiceDependencies) error {
+	log := deps.Logger
+	token := deps.BootstrapToken
+
+	// Create bootstrap token secret.
+	// The expiration is extended on every run, the token cleaner removes it afterwards.
+	log.Info().Msgf("Creating bootstrap token %s", token.ID)
+	secret := &corev1.Secret{
+		Metadata: &metav1.ObjectMeta{
+			Name:      k8s.String("bootstrap-token-" + token.ID),
+			Namespace: k8s.String("kube-system"),
+		},
+		Type: k8s.String("bootstrap.kubernetes.io/token"),
+		Data: map[string][]byte{
+			"description":                    []byte("Token used by helix to bootstrap worker kubelets"),
+			"token-id":                       []byte(token.ID),
+			"token-secret":                   []byte(token.Secret),
+			"expiration":                     []byte(time.Now().Add(bootstrapTokenTTL).UTC().Format(time.RFC3339)),
+			"usage-bootstrap-authentication": []byte("true"),
+			"usage-bootstrap-signing":        []byte("true"),
+			"auth-extra-groups":              []byte(bootstrappersGroup),
+		},
+	}
+	if err := util.CreateOrUpdate(ctx, client, secret); err != nil {
+		return maskAny(err)
+	}
+
+	bindings := []struct {
+		Name        string
+		ClusterRole string
+		Group       string
+	}{
+		// Allow bootstrapping kubelets to create certificate signing requests
+		{"helix:kubelet-bootstrap", "system:node-bootstrapper", bootstrappersGroup},
+		// Approve certificate signing requests of bootstrapping kubelets
+		{"helix:node-autoapprove-bootstrap", "system:certificates.k8s.io:certificatesigningrequests:nodeclient", bootstrappersGroup},
+		// Approve certificate signing requests of kubelets renewing their client certificate
+		{"helix:node-autoapprove-certificate-rotation", "system:certificates.k8s.io:certificatesigningrequests:selfnodeclient", "system:nodes"},
+	}
+	for _, b := range bindings {
+		crb := &rbacv1.ClusterRoleBinding{
+			Metadata: &metav1.ObjectMeta{
+				Name: k8s.String(b.Name),
+			},
+			RoleRef: &rbacv1.RoleRef{
+				ApiGroup: k8s.String("rbac.authorization.k8s.io"),
+				Kind:     k8s.String("ClusterRole"),
+				Name:     k8s.String(b.ClusterRole), // Automatically created system role.
+			},
+			Subjects: []*rbacv1.Subject{
+				&rbacv1.Subject{
+					ApiGroup: k8s.String("rbac.authorization.k8s.io"),
+					Kind:     k8s.String("Group"),
+					Name:     k8s.String(b.Group),
+				},
+			},
+		}
+		if err := util.CreateOrUpdate(ctx, client, crb); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
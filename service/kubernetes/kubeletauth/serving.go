@@ -0,0 +1,181 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeletauth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ericchiang/k8s"
+	certificatesv1beta1 "github.com/ericchiang/k8s/apis/certificates/v1beta1"
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	// Path of the serving certificate requested by the kubelet
+	kubeletServingCertPath = "/var/lib/kubelet/pki/kubelet-server-current.pem"
+	// Maximum time to wait for a kubelet to obtain its serving certificate
+	servingCertWaitTimeout = time.Minute * 5
+
+	nodeUserPrefix = "system:node:"
+	nodesGroup     = "system:nodes"
+)
+
+var (
+	// Usages allowed in a certificate signing request for a kubelet serving certificate
+	servingCertUsages = []string{"digital signature", "key encipherment", "server auth"}
+)
+
+// InitMachine approves the certificate signing request for the serving certificate
+// of the kubelet on worker nodes and waits until the kubelet has obtained that certificate.
+// Control-plane & standalone kubelets use a serving certificate created by Helix.
+func (t *kubeletAuthService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+	if node.IsControlPlane || !node.IsKubernetesNode() {
+		return nil
+	}
+	if flags.DryRun {
+		log.Info().Msg("Will approve kubelet serving certificate")
+		return nil
+	}
+
+	k8sClient, err := service.NewKubernetesClient(sctx, deps, flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	log.Info().Msg("Waiting for kubelet serving certificate")
+	ctx, cancel := context.WithTimeout(ctx, servingCertWaitTimeout)
+	defer cancel()
+	for {
+		found, err := client.Run(ctx, log, fmt.Sprintf("sudo test -e %s && echo yes || true", kubeletServingCertPath), "", true)
+		if err != nil {
+			return maskAny(err)
+		}
+		if strings.TrimSpace(found) == "yes" {
+			return nil
+		}
+		if err := approveServingCSRs(ctx, log, k8sClient, node); err != nil {
+			log.Warn().Err(err).Msg("Failed to approve kubelet serving certificate")
+		}
+		select {
+		case <-time.After(time.Second * 5):
+			// Retry
+		case <-ctx.Done():
+			return maskAny(fmt.Errorf("Kubelet did not obtain a serving certificate in time: %v", ctx.Err()))
+		}
+	}
+}
+
+// ResetMachine does nothing, certificates are removed together with the kubelet.
+func (t *kubeletAuthService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	return nil
+}
+
+// approveServingCSRs approves all pending certificate signing requests
+// for a kubelet serving certificate of the given node.
+func approveServingCSRs(ctx context.Context, log zerolog.Logger, client *k8s.Client, node service.Node) error {
+	var list certificatesv1beta1.CertificateSigningRequestList
+	if err := client.List(ctx, "", &list); err != nil {
+		return maskAny(err)
+	}
+	for _, csr := range list.GetItems() {
+		if len(csr.GetStatus().GetConditions()) > 0 {
+			// Already approved or denied
+			continue
+		}
+		if err := validateServingCSR(csr, node); err != nil {
+			log.Debug().Err(err).Msgf("Skipping certificate signing request %s", csr.GetMetadata().GetName())
+			continue
+		}
+		log.Info().Msgf("Approving kubelet serving certificate signing request %s", csr.GetMetadata().GetName())
+		if csr.Status == nil {
+			csr.Status = &certificatesv1beta1.CertificateSigningRequestStatus{}
+		}
+		csr.Status.Conditions = append(csr.Status.Conditions, &certificatesv1beta1.CertificateSigningRequestCondition{
+			Type:    k8s.String("Approved"),
+			Reason:  k8s.String("HelixApproved"),
+			Message: k8s.String("Kubelet serving certificate approved by helix"),
+		})
+		if err := client.Update(ctx, csr, k8s.Subresource("approval")); err != nil {
+			return maskAny(err)
+		}
+	}
+	return nil
+}
+
+// validateServingCSR checks that the given certificate signing request was made
+// by the kubelet of the given node, for a serving certificate of that node only.
+func validateServingCSR(csr *certificatesv1beta1.CertificateSigningRequest, node service.Node) error {
+	spec := csr.GetSpec()
+	username := spec.GetUsername()
+	if !strings.HasPrefix(username, nodeUserPrefix) || !containsString(spec.GetGroups(), nodesGroup) {
+		return maskAny(fmt.Errorf("Not requested by a node"))
+	}
+	nodeName := strings.TrimPrefix(username, nodeUserPrefix)
+	if node.IsInInventory() && nodeName != strings.ToLower(node.Name) {
+		return maskAny(fmt.Errorf("Requested by another node"))
+	}
+	for _, u := range spec.GetUsages() {
+		if !containsString(servingCertUsages, u) {
+			return maskAny(fmt.Errorf("Unexpected usage '%s'", u))
+		}
+	}
+	block, _ := pem.Decode(spec.GetRequest())
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return maskAny(fmt.Errorf("No certificate request found"))
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return maskAny(err)
+	}
+	if req.Subject.CommonName != username || !containsString(req.Subject.Organization, nodesGroup) {
+		return maskAny(fmt.Errorf("Unexpected subject '%s'", req.Subject.String()))
+	}
+	if len(req.IPAddresses) == 0 {
+		return maskAny(fmt.Errorf("No IP addresses requested"))
+	}
+	for _, ip := range req.IPAddresses {
+		if !ip.Equal(net.ParseIP(node.Address)) && !ip.Equal(net.ParseIP(node.GetInternalAddress())) {
+			return maskAny(fmt.Errorf("IP address %s does not belong to node", ip))
+		}
+	}
+	for _, name := range req.DNSNames {
+		if name != nodeName {
+			return maskAny(fmt.Errorf("DNS name %s does not belong to node", name))
+		}
+	}
+	if len(req.EmailAddresses) > 0 || len(req.URIs) > 0 {
+		return maskAny(fmt.Errorf("Unexpected email addresses or URIs"))
+	}
+	return nil
+}
+
+// containsString returns true if the given list contains the given value.
+func containsString(list []string, value string) bool {
+	for _, x := range list {
+		if x == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubeletauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/ericchiang/k8s"
+	certificatesv1beta1 "github.com/ericchiang/k8s/apis/certificates/v1beta1"
+
+	"github.com/pulcy/helix/service"
+)
+
+// createTestCSR creates a certificate signing request, as made by the kubelet of a node.
+func createTestCSR(t *testing.T, username string, groups, usages []string, template x509.CertificateRequest) *certificatesv1beta1.CertificateSigningRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate request: %v", err)
+	}
+	return &certificatesv1beta1.CertificateSigningRequest{
+		Spec: &certificatesv1beta1.CertificateSigningRequestSpec{
+			Request:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+			Username: k8s.String(username),
+			Groups:   groups,
+			Usages:   usages,
+		},
+	}
+}
+
+func TestValidateServingCSR(t *testing.T) {
+	node := service.Node{
+		Name:            "worker1",
+		Address:         "192.168.1.10",
+		InternalAddress: "10.0.0.10",
+	}
+	groups := []string{nodesGroup, "system:authenticated"}
+	subject := pkix.Name{CommonName: "system:node:worker1", Organization: []string{nodesGroup}}
+	ips := []net.IP{net.ParseIP("192.168.1.10"), net.ParseIP("10.0.0.10")}
+	uri, _ := url.Parse("spiffe://cluster/worker1")
+
+	tests := []struct {
+		name     string
+		username string
+		groups   []string
+		usages   []string
+		template x509.CertificateRequest
+		fails    bool
+	}{
+		{"valid", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips, DNSNames: []string{"worker1"}}, false},
+		{"valid without DNS names", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips[:1]}, false},
+		{"not a node", "admin", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips}, true},
+		{"missing nodes group", "system:node:worker1", []string{"system:authenticated"}, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips}, true},
+		{"client usage", "system:node:worker1", groups, []string{"digital signature", "key encipherment", "client auth"}, x509.CertificateRequest{Subject: subject, IPAddresses: ips}, true},
+		{"other common name", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker2", Organization: []string{nodesGroup}}, IPAddresses: ips}, true},
+		{"missing organization", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: pkix.Name{CommonName: "system:node:worker1"}, IPAddresses: ips}, true},
+		{"no IP addresses", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, DNSNames: []string{"worker1"}}, true},
+		{"IP address of other node", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: []net.IP{net.ParseIP("192.168.1.11")}}, true},
+		{"DNS name of other node", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips, DNSNames: []string{"worker2"}}, true},
+		{"email address", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips, EmailAddresses: []string{"admin@example.com"}}, true},
+		{"URI", "system:node:worker1", groups, servingCertUsages, x509.CertificateRequest{Subject: subject, IPAddresses: ips, URIs: []*url.URL{uri}}, true},
+	}
+	for _, test := range tests {
+		csr := createTestCSR(t, test.username, test.groups, test.usages, test.template)
+		err := validateServingCSR(csr, node)
+		if test.fails && err == nil {
+			t.Errorf("%s: expected error, got none", test.name)
+		} else if !test.fails && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestValidateServingCSRInvalidRequest(t *testing.T) {
+	csr := &certificatesv1beta1.CertificateSigningRequest{
+		Spec: &certificatesv1beta1.CertificateSigningRequestSpec{
+			Request:  []byte("not a certificate request"),
+			Username: k8s.String("system:node:worker1"),
+			Groups:   []string{nodesGroup},
+			Usages:   servingCertUsages,
+		},
+	}
+	if err := validateServingCSR(csr, service.Node{Name: "worker1", Address: "192.168.1.10"}); err == nil {
+		t.Error("Expected error, got none")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadbalancer
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	manifestPath = "/etc/kubernetes/manifests/haproxy.yaml"
+	configDir    = "/etc/kubernetes/haproxy"
+	configName   = "haproxy.cfg"
+
+	manifestFileMode = os.FileMode(0644)
+	configFileMode   = os.FileMode(0644)
+	configDirMode    = os.FileMode(0755)
+)
+
+// NewService creates a service that runs haproxy in front of all apiservers.
+func NewService() service.Service {
+	return &loadBalancerService{}
+}
+
+type loadBalancerService struct{}
+
+func (t *loadBalancerService) Name() string {
+	return "load-balancer"
+}
+
+// IsDisruptive returns true.
+func (t *loadBalancerService) IsDisruptive() bool {
+	return true
+}
+
+func (t *loadBalancerService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	return nil
+}
+
+// InitMachine configures the machine to run haproxy.
+func (t *loadBalancerService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	// Setup haproxy on this host?
+	if !sctx.IsLoadBalancerNode(node) {
+		log.Info().Msg("No haproxy on this machine")
+		// Remove haproxy in case this node no longer runs the load-balancer
+		if err := t.ResetMachine(ctx, node, client, sctx, deps, flags); err != nil {
+			return maskAny(err)
+		}
+		return nil
+	}
+
+	// Create & upload haproxy.cfg
+	config, err := createConfig(sctx, deps, flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	if err := client.EnsureDirectory(ctx, log, configDir, configDirMode); err != nil {
+		return maskAny(err)
+	}
+	if err := client.UpdateFile(ctx, log, filepath.Join(configDir, configName), []byte(config), configFileMode); err != nil {
+		return maskAny(err)
+	}
+
+	// Create manifest
+	log.Info().Msg("Creating haproxy manifest")
+	opts := struct {
+		Image      string
+		PodName    string
+		Port       int
+		ConfigDir  string
+		ConfigHash string
+	}{
+		Image:      flags.Images.HAProxyImage(node.Architecture),
+		PodName:    "haproxy-" + node.Name,
+		Port:       flags.LoadBalancer.Port,
+		ConfigDir:  configDir,
+		ConfigHash: fmt.Sprintf("%x", sha1.Sum([]byte(config))),
+	}
+	if err := client.Render(ctx, log, haproxyManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// ResetMachine removes haproxy from the machine.
+func (t *loadBalancerService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	if err := client.RemoveFile(ctx, deps.Logger, manifestPath); err != nil {
+		return maskAny(err)
+	}
+	if err := client.RemoveDirectory(ctx, deps.Logger, configDir); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+type server struct {
+	Name    string
+	Address string
+}
+
+// createConfig renders the haproxy configuration, balancing over all control-plane nodes.
+func createConfig(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) (string, error) {
+	ipv6 := flags.Kubernetes.IPFamily() == service.IPFamilyIPv6
+	opts := struct {
+		BindAddress   string
+		IPv6          bool
+		Port          int
+		APIServerPort int
+		Servers       []server
+	}{
+		BindAddress:   "*",
+		IPv6:          ipv6,
+		Port:          flags.LoadBalancer.Port,
+		APIServerPort: service.APIServerPort,
+	}
+	if ipv6 {
+		opts.BindAddress = "::"
+	}
+	for _, n := range sctx.Nodes() {
+		if n.IsControlPlane {
+			opts.Servers = append(opts.Servers, server{Name: n.Name, Address: n.GetInternalAddress()})
+		}
+	}
+	result, err := util.RenderToString(deps.Logger, haproxyConfigTemplate, opts)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	return result, nil
+}
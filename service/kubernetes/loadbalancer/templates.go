@@ -0,0 +1,81 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadbalancer
+
+const (
+	// haproxy configuration.
+	// Note that haproxy separates the port of a server address at the last colon,
+	// so IPv6 addresses must not be wrapped in brackets.
+	haproxyConfigTemplate = `global
+  maxconn 4000
+
+defaults
+  mode tcp
+  timeout connect 10s
+  timeout client 24h
+  timeout server 24h
+  timeout check 5s
+
+frontend apiserver
+  bind {{ .BindAddress }}:{{ .Port }}{{ if .IPv6 }} v4v6{{ end }}
+  default_backend apiserver
+
+backend apiserver
+  option httpchk GET /healthz
+  http-check expect status 200
+  balance roundrobin
+  default-server inter 5s downinter 5s rise 2 fall 3
+{{- range .Servers }}
+  server {{ .Name }} {{ .Address }}:{{ $.APIServerPort }} check check-ssl verify none
+{{- end }}
+`
+
+	haproxyManifestTemplate = `
+apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    scheduler.alpha.kubernetes.io/critical-pod: ""
+    helix.pulcy.com/config-hash: "{{ .ConfigHash }}"
+  labels:
+    component: haproxy
+    tier: control-plane
+  name: {{ .PodName }}
+  namespace: kube-system
+spec:
+  containers:
+  - name: haproxy
+    image: {{ .Image }}
+    livenessProbe:
+      failureThreshold: 8
+      tcpSocket:
+        port: {{ .Port }}
+      initialDelaySeconds: 15
+      timeoutSeconds: 15
+    resources:
+      requests:
+        cpu: 25m
+    volumeMounts:
+    - mountPath: /usr/local/etc/haproxy
+      name: config
+      readOnly: true
+  hostNetwork: true
+  volumes:
+  - hostPath:
+      path: {{ .ConfigDir }}
+      type: Directory
+    name: config
+`
+)
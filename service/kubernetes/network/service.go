@@ -0,0 +1,94 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/service/kubernetes/calico"
+	"github.com/pulcy/helix/service/kubernetes/flannel"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+func NewService() service.Service {
+	return &networkService{
+		providers: []service.NetworkProvider{
+			flannel.NewProvider(),
+			calico.NewProvider(),
+		},
+	}
+}
+
+type networkService struct {
+	providers []service.NetworkProvider
+}
+
+func (t *networkService) Name() string {
+	return "network"
+}
+
+func (t *networkService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	if _, err := t.provider(flags); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// Init deploys the configured network provider into the cluster.
+func (t *networkService) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	p, err := t.provider(flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	deps.Logger.Info().Msgf("Deploying %s network", p.Name())
+	if err := p.Init(ctx, sctx, deps, flags); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// InitMachine does nothing, since network providers are deployed using the kubernetes API.
+func (t *networkService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	return nil
+}
+
+// ResetMachine removes the CNI configuration & network interfaces of all providers from the machine,
+// such that nothing is left behind when the provider has been changed.
+func (t *networkService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	for _, p := range t.providers {
+		if err := p.ResetMachine(ctx, node, client, sctx, deps, flags); err != nil {
+			return maskAny(err)
+		}
+	}
+	return nil
+}
+
+// provider returns the configured network provider.
+func (t *networkService) provider(flags service.ServiceFlags) (service.NetworkProvider, error) {
+	for _, p := range t.providers {
+		if p.Name() == flags.Network.Provider {
+			return p, nil
+		}
+	}
+	return nil, maskAny(fmt.Errorf("Unknown network provider '%s'", flags.Network.Provider))
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodelabels
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericchiang/k8s"
+	corev1 "github.com/ericchiang/k8s/apis/core/v1"
+	metav1 "github.com/ericchiang/k8s/apis/meta/v1"
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	managedLabelsAnnotation = "helix.pulcy.com/managed-labels"
+	managedTaintsAnnotation = "helix.pulcy.com/managed-taints"
+
+	// Maximum time to wait for all nodes to register
+	waitTimeout = time.Minute * 10
+)
+
+func NewService() service.Service {
+	return &nodeLabelsService{}
+}
+
+type nodeLabelsService struct {
+}
+
+func (t *nodeLabelsService) Name() string {
+	return "node-labels"
+}
+
+func (t *nodeLabelsService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	return nil
+}
+
+// Init reconciles the labels & taints of all Kubernetes nodes.
+// Labels & taints that were previously set by helix, but are no longer
+// configured, are removed.
+// Nodes that are not yet registered are waited for, since some labels
+// can only be set through the API.
+func (t *nodeLabelsService) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger
+	if flags.DryRun {
+		log.Info().Msg("Will reconcile node labels & taints")
+		return nil
+	}
+
+	client, err := service.NewKubernetesClient(sctx, deps, flags)
+	if err != nil {
+		return maskAny(err)
+	}
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+		defer cancel()
+	}
+	done := make(map[string]bool)
+	for {
+		var list corev1.NodeList
+		if err := client.List(ctx, k8s.AllNamespaces, &list); err != nil {
+			return maskAny(err)
+		}
+		var pending []string
+		for _, n := range sctx.Nodes() {
+			if !n.IsKubernetesNode() || done[n.Name] {
+				continue
+			}
+			kn := findNode(list.GetItems(), n)
+			if kn == nil {
+				pending = append(pending, n.Name)
+				continue
+			}
+			if reconcile(kn, n.KubernetesLabels(), n.KubernetesTaints(flags.ControlPlane)) {
+				log.Info().Str("host", n.Name).Msg("Updating node labels & taints")
+				if err := client.Update(ctx, kn); util.IsK8sConflict(err) {
+					// Node has been changed in the meantime, try again
+					pending = append(pending, n.Name)
+					continue
+				} else if err != nil {
+					return maskAny(err)
+				}
+			}
+			done[n.Name] = true
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		log.Info().Strs("hosts", pending).Msg("Waiting for nodes to register")
+		select {
+		case <-time.After(time.Second * 5):
+			// Retry
+		case <-ctx.Done():
+			return maskAny(fmt.Errorf("Nodes %s did not register in time: %v", strings.Join(pending, ", "), ctx.Err()))
+		}
+	}
+}
+
+// reconcile updates the labels & taints of the given node.
+// Returns true if the node has been changed.
+func reconcile(kn *corev1.Node, labels map[string]string, taints []service.Taint) bool {
+	if kn.Metadata == nil {
+		kn.Metadata = &metav1.ObjectMeta{}
+	}
+	meta := kn.Metadata
+	if meta.Labels == nil {
+		meta.Labels = make(map[string]string)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	changed := false
+
+	// Labels
+	for _, k := range splitList(meta.Annotations[managedLabelsAnnotation]) {
+		if _, found := labels[k]; !found {
+			if _, found := meta.Labels[k]; found {
+				delete(meta.Labels, k)
+				changed = true
+			}
+		}
+	}
+	var labelKeys []string
+	for k, v := range labels {
+		if current, found := meta.Labels[k]; !found || current != v {
+			meta.Labels[k] = v
+			changed = true
+		}
+		labelKeys = append(labelKeys, k)
+	}
+
+	// Taints
+	if kn.Spec == nil {
+		kn.Spec = &corev1.NodeSpec{}
+	}
+	isDesired := func(key, effect string) bool {
+		for _, t := range taints {
+			if t.Key == key && t.Effect == effect {
+				return true
+			}
+		}
+		return false
+	}
+	managed := splitList(meta.Annotations[managedTaintsAnnotation])
+	var current []*corev1.Taint
+	for _, x := range kn.Spec.Taints {
+		id := x.GetKey() + ":" + x.GetEffect()
+		if containsString(managed, id) && !isDesired(x.GetKey(), x.GetEffect()) {
+			changed = true
+			continue
+		}
+		current = append(current, x)
+	}
+	var taintIDs []string
+	for _, t := range taints {
+		found := false
+		for _, x := range current {
+			if x.GetKey() == t.Key && x.GetEffect() == t.Effect {
+				found = true
+				if x.GetValue() != t.Value {
+					x.Value = k8s.String(t.Value)
+					changed = true
+				}
+			}
+		}
+		if !found {
+			current = append(current, &corev1.Taint{
+				Key:    k8s.String(t.Key),
+				Value:  k8s.String(t.Value),
+				Effect: k8s.String(t.Effect),
+			})
+			changed = true
+		}
+		taintIDs = append(taintIDs, t.Key+":"+t.Effect)
+	}
+	kn.Spec.Taints = current
+
+	// Annotations
+	if setListAnnotation(meta.Annotations, managedLabelsAnnotation, labelKeys) {
+		changed = true
+	}
+	if setListAnnotation(meta.Annotations, managedTaintsAnnotation, taintIDs) {
+		changed = true
+	}
+	return changed
+}
+
+// findNode returns the Kubernetes node that matches the given node
+// by name or address, or nil if not found.
+func findNode(items []*corev1.Node, n service.Node) *corev1.Node {
+	for _, kn := range items {
+		if strings.EqualFold(kn.GetMetadata().GetName(), n.Name) {
+			return kn
+		}
+		for _, addr := range kn.GetStatus().GetAddresses() {
+			if addr.GetAddress() == n.Address || addr.GetAddress() == n.GetInternalAddress() {
+				return kn
+			}
+		}
+	}
+	return nil
+}
+
+// setListAnnotation stores the given (sorted) list in the annotation with given key.
+// Returns true if the annotation has been changed.
+func setListAnnotation(annotations map[string]string, key string, list []string) bool {
+	sort.Strings(list)
+	value := strings.Join(list, ",")
+	if current, found := annotations[key]; found && current == value {
+		return false
+	} else if !found && value == "" {
+		return false
+	}
+	if value == "" {
+		delete(annotations, key)
+	} else {
+		annotations[key] = value
+	}
+	return true
+}
+
+// splitList splits a comma separated list.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// containsString returns true if the given list contains the given value.
+func containsString(list []string, value string) bool {
+	for _, x := range list {
+		if x == value {
+			return true
+		}
+	}
+	return false
+}
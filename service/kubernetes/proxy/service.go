@@ -17,6 +17,8 @@ package proxy
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ericchiang/k8s"
 	appsv1 "github.com/ericchiang/k8s/apis/apps/v1"
@@ -25,6 +27,7 @@ import (
 	rbacv1 "github.com/ericchiang/k8s/apis/rbac/v1"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 
 	"github.com/pulcy/helix/service"
 	"github.com/pulcy/helix/util"
@@ -34,6 +37,15 @@ var (
 	maskAny = errors.WithStack
 )
 
+const (
+	configDir      = "/var/lib/kube-proxy"
+	kubeConfigName = "kubeconfig.conf"
+	configName     = "config.conf"
+
+	// Minimum kubernetes version that uses a map for feature gates in the KubeProxyConfiguration
+	minFeatureGatesMapVersion = "v1.11.0"
+)
+
 func NewService() service.Service {
 	return &proxyService{}
 }
@@ -45,12 +57,11 @@ func (t *proxyService) Name() string {
 	return "kube-proxy"
 }
 
-func (t *proxyService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+func (t *proxyService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	return nil
 }
 
-func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
-	ctx := context.Background()
+func (t *proxyService) Init(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger
 	client, err := service.NewKubernetesClient(sctx, deps, flags)
 	if err != nil {
@@ -94,13 +105,19 @@ func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDe
 	kubeConfigOpts := struct {
 		MasterEndpoint string
 	}{
-		MasterEndpoint: fmt.Sprintf("https://%s:6443", sctx.GetAPIServer()),
+		MasterEndpoint: sctx.GetAPIServerURL(),
 	}
 	kubeconfig, err := util.RenderToString(log, kubeConfigTemplate, kubeConfigOpts)
 	if err != nil {
 		return maskAny(err)
 	}
 
+	// Render kube-proxy configuration
+	config, err := createConfig(log, flags)
+	if err != nil {
+		return maskAny(err)
+	}
+
 	// Create kube-proxy config map
 	cm := &corev1.ConfigMap{
 		Metadata: &metav1.ObjectMeta{
@@ -111,7 +128,8 @@ func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDe
 			},
 		},
 		Data: map[string]string{
-			"kubeconfig.conf": kubeconfig,
+			kubeConfigName: kubeconfig,
+			configName:     config,
 		},
 	}
 	if err := util.CreateOrUpdate(ctx, client, cm); err != nil {
@@ -119,7 +137,8 @@ func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDe
 	}
 
 	// Create kube-proxy daemon-set
-	for _, arch := range sctx.AllArchitectures() {
+	for _, dsArch := range sctx.DaemonSetArchitectures() {
+		arch := dsArch.Name
 		ds := &appsv1.DaemonSet{
 			Metadata: &metav1.ObjectMeta{
 				Name:      k8s.String("kube-proxy-" + arch),
@@ -153,13 +172,12 @@ func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDe
 						Containers: []*corev1.Container{
 							&corev1.Container{
 								Name:  k8s.String("kube-proxy"),
-								Image: k8s.String(flags.Images.HyperKubeImage(arch)),
+								Image: k8s.String(flags.Images.HyperKubeImage(dsArch.ImageArchitecture)),
 								Command: []string{
 									"/hyperkube",
 									"kube-proxy",
-									"--kubeconfig=/var/lib/kube-proxy/kubeconfig.conf",
-									"--proxy-mode=iptables",
-								}, // TODO
+									"--config=" + configDir + "/" + configName,
+								},
 								SecurityContext: &corev1.SecurityContext{
 									Privileged: k8s.Bool(true),
 								},
@@ -182,8 +200,11 @@ func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDe
 						},
 						HostNetwork:        k8s.Bool(true),
 						ServiceAccountName: k8s.String("kube-proxy"),
-						Tolerations:        []*corev1.Toleration{
-						// TODO
+						Tolerations: []*corev1.Toleration{
+							// Services must be reachable from all nodes, regardless of their taints
+							&corev1.Toleration{
+								Operator: k8s.String("Exists"),
+							},
 						},
 						Volumes: []*corev1.Volume{
 							&corev1.Volume{
@@ -224,3 +245,46 @@ func (t *proxyService) Init(sctx *service.ServiceContext, deps service.ServiceDe
 	}
 	return nil
 }
+
+// createConfig renders the KubeProxyConfiguration.
+func createConfig(log zerolog.Logger, flags service.ServiceFlags) (string, error) {
+	featureGates, err := flags.Kubernetes.FeatureGateMap()
+	if err != nil {
+		return "", maskAny(err)
+	}
+	if flags.KubeProxy.NeedsIPVSFeatureGate(flags.Kubernetes.Version) {
+		featureGates["SupportIPVSProxyMode"] = true
+	}
+	bindAddress := "0.0.0.0"
+	if flags.Kubernetes.IPFamily() == service.IPFamilyIPv6 {
+		bindAddress = "::"
+	}
+	opts := struct {
+		BindAddress        string
+		KubeConfigPath     string
+		ClusterCIDR        string
+		FeatureGates       map[string]bool
+		FeatureGatesString string
+		KubeProxy          service.KubeProxy
+	}{
+		BindAddress:    bindAddress,
+		KubeConfigPath: configDir + "/" + kubeConfigName,
+		ClusterCIDR:    flags.Kubernetes.PodNetworkCIDR,
+		FeatureGates:   featureGates,
+		KubeProxy:      flags.KubeProxy,
+	}
+	if util.CompareVersions(flags.Kubernetes.Version, minFeatureGatesMapVersion) < 0 {
+		// Older versions use a string (k1=v1,k2=v2)
+		var gates []string
+		for k, v := range featureGates {
+			gates = append(gates, fmt.Sprintf("%s=%t", k, v))
+		}
+		sort.Strings(gates)
+		opts.FeatureGatesString = strings.Join(gates, ",")
+	}
+	result, err := util.RenderToString(log, kubeProxyConfigTemplate, opts)
+	if err != nil {
+		return "", maskAny(err)
+	}
+	return result, nil
+}
@@ -34,4 +34,36 @@ users:
   user:
     tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token
 `
+
+	kubeProxyConfigTemplate = `apiVersion: kubeproxy.config.k8s.io/v1alpha1
+kind: KubeProxyConfiguration
+bindAddress: {{ .BindAddress }}
+clientConnection:
+  kubeconfig: {{ .KubeConfigPath }}
+clusterCIDR: {{ .ClusterCIDR }}
+conntrack:
+  maxPerCore: {{ .KubeProxy.ConntrackMaxPerCore }}
+  min: {{ .KubeProxy.ConntrackMin }}
+  tcpCloseWaitTimeout: {{ .KubeProxy.ConntrackTCPCloseWaitTimeout }}
+  tcpEstablishedTimeout: {{ .KubeProxy.ConntrackTCPEstablishedTimeout }}
+{{- if .FeatureGatesString }}
+featureGates: "{{ .FeatureGatesString }}"
+{{- else if .FeatureGates }}
+featureGates:
+{{- range $k, $v := .FeatureGates }}
+  {{ $k }}: {{ $v }}
+{{- end }}
+{{- end }}
+mode: {{ .KubeProxy.Mode }}
+{{- if .KubeProxy.IsIPVS }}
+ipvs:
+  scheduler: {{ .KubeProxy.IPVSScheduler }}
+  syncPeriod: 30s
+  minSyncPeriod: 0s
+{{- end }}
+iptables:
+  masqueradeAll: false
+  syncPeriod: 30s
+  minSyncPeriod: 0s
+`
 )
@@ -15,6 +15,7 @@
 package scheduler
 
 import (
+	"context"
 	"os"
 	"strings"
 
@@ -49,13 +50,18 @@ func (t *schedulerService) Name() string {
 	return "kube-scheduler"
 }
 
-func (t *schedulerService) Prepare(sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+// IsDisruptive returns true.
+func (t *schedulerService) IsDisruptive() bool {
+	return true
+}
+
+func (t *schedulerService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
 	t.Component.Name = "scheduler"
 	return nil
 }
 
 // InitMachine configures the machine to run kube-scheduler.
-func (t *schedulerService) InitMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+func (t *schedulerService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
 	log := deps.Logger.With().Str("host", node.Name).Logger()
 
 	// Setup scheduler on this host?
@@ -70,13 +76,13 @@ func (t *schedulerService) InitMachine(node service.Node, client util.SSHClient,
 	}
 
 	// Create & Upload kubeconfig
-	if err := t.Component.CreateKubeConfig("system:kube-scheduler", "Kubernetes", client, sctx, deps, flags); err != nil {
+	if err := t.Component.CreateKubeConfig(ctx, "system:kube-scheduler", "Kubernetes", client, sctx, deps, flags); err != nil {
 		return maskAny(err)
 	}
 
 	// Create manifest
 	log.Info().Msg("Creating kube-apiserver manifest")
-	if err := createManifest(client, deps, cfg); err != nil {
+	if err := createManifest(ctx, client, deps, cfg); err != nil {
 		return maskAny(err)
 	}
 
@@ -84,37 +90,53 @@ func (t *schedulerService) InitMachine(node service.Node, client util.SSHClient,
 }
 
 // ResetMachine removes kube-scheduler from the machine.
-func (t *schedulerService) ResetMachine(node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
-	if err := client.RemoveFile(deps.Logger, manifestPath); err != nil {
+func (t *schedulerService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	if err := client.RemoveFile(ctx, deps.Logger, manifestPath); err != nil {
 		return maskAny(err)
 	}
-	if err := t.Component.RemoveKubeConfig(client, deps, flags); err != nil {
+	if err := t.Component.RemoveKubeConfig(ctx, client, deps, flags); err != nil {
 		return maskAny(err)
 	}
 	return nil
 }
 
 type config struct {
-	Image          string // HyperKube docker images
-	PodName        string
-	FeatureGates   string // Feature gates to use
-	KubeConfigPath string // Path to a kubeconfig file, specifying how to connect to the API server.
+	Image          string                  // HyperKube docker images
+	PodName        string                  // Name of the static pod
+	KubeConfigPath string                  // Path to a kubeconfig file, specifying how to connect to the API server.
+	Args           []string                // Command line arguments (defaults merged with extra arguments)
+	ExtraVolumes   []service.HostPathMount // Additional host paths to mount
+	Resources      service.Resources       // Resource requests & limits
 }
 
 func (t *schedulerService) createConfig(node service.Node, client util.SSHClient, deps service.ServiceDependencies, flags service.ServiceFlags) (config, error) {
+	args := map[string]string{
+		"address":       "127.0.0.1",
+		"feature-gates": strings.Join(flags.Kubernetes.FeatureGates, ","),
+		"kubeconfig":    t.KubeConfigPath(),
+		"leader-elect":  "true",
+	}
+	extraVolumes, err := flags.Scheduler.Volumes(t.KubeConfigPath())
+	if err != nil {
+		return config{}, maskAny(err)
+	}
 	result := config{
 		Image:          flags.Images.HyperKubeImage(node.Architecture),
 		PodName:        "kube-scheduler-" + node.Name,
-		FeatureGates:   strings.Join(flags.Kubernetes.FeatureGates, ","),
 		KubeConfigPath: t.KubeConfigPath(),
+		Args:           flags.Scheduler.Args(args),
+		ExtraVolumes:   extraVolumes,
+		Resources: flags.Scheduler.MergeResources(service.Resources{
+			Requests: map[string]string{"cpu": "100m"},
+		}),
 	}
 
 	return result, nil
 }
 
-func createManifest(client util.SSHClient, deps service.ServiceDependencies, opts config) error {
+func createManifest(ctx context.Context, client util.SSHClient, deps service.ServiceDependencies, opts config) error {
 	deps.Logger.Info().Msgf("Creating manifest %s", manifestPath)
-	if err := client.Render(deps.Logger, schedulerManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
+	if err := client.Render(ctx, deps.Logger, schedulerManifestTemplate, manifestPath, opts, manifestFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -31,10 +31,9 @@ spec:
   - command:
     - /hyperkube
     - kube-scheduler
-    - --address=127.0.0.1
-    - --leader-elect=true
-    - --kubeconfig={{ .KubeConfigPath }}
-    - --feature-gates={{ .FeatureGates }}
+{{- range .Args }}
+    - {{ json . }}
+{{- end }}
     image: {{ .Image }}
     livenessProbe:
       failureThreshold: 8
@@ -47,17 +46,38 @@ spec:
       timeoutSeconds: 15
     name: kube-scheduler
     resources:
+{{- with .Resources.Requests }}
       requests:
-        cpu: 100m
+{{- range $name, $quantity := . }}
+        {{ $name }}: {{ json $quantity }}
+{{- end }}
+{{- end }}
+{{- with .Resources.Limits }}
+      limits:
+{{- range $name, $quantity := . }}
+        {{ $name }}: {{ json $quantity }}
+{{- end }}
+{{- end }}
     volumeMounts:
     - mountPath: {{ .KubeConfigPath }}
       name: kubeconfig
       readOnly: true
+{{- range .ExtraVolumes }}
+    - mountPath: {{ json .MountPath }}
+      name: extra-{{ .Name }}
+      readOnly: {{ .ReadOnly }}
+{{- end }}
   hostNetwork: true
   volumes:
   - hostPath:
       path: {{ .KubeConfigPath }}
       type: FileOrCreate
     name: kubeconfig
+{{- range .ExtraVolumes }}
+  - hostPath:
+      path: {{ json .HostPath }}
+      type: {{ .PathType }}
+    name: extra-{{ .Name }}
+{{- end }}
 `
 )
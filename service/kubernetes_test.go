@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+)
+
+func TestNthIP(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		n        int
+		expected string
+		fails    bool
+	}{
+		{"10.71.0.0/16", 1, "10.71.0.1", false},
+		{"10.71.0.0/16", 10, "10.71.0.10", false},
+		{"10.71.0.0/16", 256, "10.71.1.0", false},
+		{"10.71.5.7/16", 10, "10.71.0.10", false},
+		{"192.168.1.0/30", 3, "192.168.1.3", false},
+		{"192.168.1.0/30", 4, "", true},
+		{"fd00:10:96::/112", 1, "fd00:10:96::1", false},
+		{"fd00:10:96::/112", 10, "fd00:10:96::a", false},
+		{"fd00:10:96::/112", 65535, "fd00:10:96::ffff", false},
+		{"fd00:10:96::/112", 65536, "", true},
+		{"fd00::/64", 0x10000, "fd00::1:0", false},
+		{"invalid", 1, "", true},
+	}
+	for _, test := range tests {
+		ip, err := nthIP(test.cidr, test.n)
+		if test.fails {
+			if err == nil {
+				t.Errorf("nthIP(%s, %d): expected error, got %s", test.cidr, test.n, ip)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("nthIP(%s, %d): unexpected error: %v", test.cidr, test.n, err)
+		} else if ip.String() != test.expected {
+			t.Errorf("nthIP(%s, %d): expected %s, got %s", test.cidr, test.n, test.expected, ip)
+		}
+	}
+}
+
+func TestNodeCIDRMaskSizeFor(t *testing.T) {
+	flags := Kubernetes{NodeCIDRMaskSize: 24, NodeCIDRMaskSizeIPv6: 80}
+	tests := []struct {
+		cidr     string
+		expected int
+	}{
+		{"10.244.0.0/16", 24},
+		{"fd00::/48", 80},
+		{"::ffff:10.244.0.0/112", 24},
+	}
+	for _, test := range tests {
+		if result := flags.NodeCIDRMaskSizeFor(test.cidr); result != test.expected {
+			t.Errorf("NodeCIDRMaskSizeFor(%s): expected %d, got %d", test.cidr, test.expected, result)
+		}
+	}
+}
+
+func TestValidateNetworks(t *testing.T) {
+	tests := []struct {
+		name           string
+		serviceRange   string
+		podNetwork     string
+		maskSize       int
+		maskSizeIPv6   int
+		fails          bool
+		dualStack      bool
+		primaryFamily  string
+		podCIDRForIPv6 string
+	}{
+		{"defaults", "10.71.0.0/16", "10.244.0.0/16", 24, 64, false, false, IPFamilyIPv4, ""},
+		{"IPv6", "fd00:10:96::/112", "fd00:10:244::/56", 24, 64, false, false, IPFamilyIPv6, "fd00:10:244::/56"},
+		{"dual-stack", "10.71.0.0/16,fd00:10:96::/112", "10.244.0.0/16,fd00:10:244::/56", 24, 64, false, true, IPFamilyIPv4, "fd00:10:244::/56"},
+		{"dual-stack IPv6 primary", "fd00:10:96::/112,10.71.0.0/16", "fd00:10:244::/48,10.244.0.0/16", 24, 64, false, true, IPFamilyIPv6, "fd00:10:244::/48"},
+		{"dual-stack pods, single-stack services", "10.71.0.0/16", "10.244.0.0/16, fd00:10:244::/56", 24, 64, false, true, IPFamilyIPv4, "fd00:10:244::/56"},
+		{"dual-stack services, single-stack pods", "10.71.0.0/16,fd00:10:96::/112", "10.244.0.0/16", 24, 64, true, false, "", ""},
+		{"different primary families", "fd00:10:96::/112,10.71.0.0/16", "10.244.0.0/16,fd00:10:244::/56", 24, 64, true, false, "", ""},
+		{"two IPv4 ranges", "10.71.0.0/16", "10.244.0.0/16,10.245.0.0/16", 24, 64, true, false, "", ""},
+		{"three ranges", "10.71.0.0/16", "10.244.0.0/16,fd00::/48,10.245.0.0/16", 24, 64, true, false, "", ""},
+		{"overlap", "10.244.0.0/24", "10.244.0.0/16", 24, 64, true, false, "", ""},
+		{"IPv6 overlap", "fd00:10:244::/112", "fd00:10:244::/56", 24, 64, true, false, "", ""},
+		{"IPv4 mask too small", "10.71.0.0/16", "10.244.0.0/16", 8, 64, true, false, "", ""},
+		{"IPv4 mask too large", "10.71.0.0/16", "10.244.0.0/16", 33, 64, true, false, "", ""},
+		{"IPv6 mask too small", "fd00:10:96::/112", "fd00:10:244::/56", 24, 48, true, false, "", ""},
+		{"IPv6 mask too large", "fd00:10:96::/112", "fd00:10:244::/56", 24, 129, true, false, "", ""},
+		{"dual-stack IPv6 mask checked", "10.71.0.0/16,fd00:10:96::/112", "10.244.0.0/16,fd00:10:244::/56", 24, 48, true, false, "", ""},
+		{"invalid CIDR", "10.71.0.0/16", "10.244.0.0", 24, 64, true, false, "", ""},
+		{"empty", "10.71.0.0/16", " , ", 24, 64, true, false, "", ""},
+	}
+	for _, test := range tests {
+		flags := Kubernetes{
+			ServiceClusterIPRange: test.serviceRange,
+			PodNetworkCIDR:        test.podNetwork,
+			NodeCIDRMaskSize:      test.maskSize,
+			NodeCIDRMaskSizeIPv6:  test.maskSizeIPv6,
+		}
+		err := flags.validateNetworks()
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected error, got none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if flags.IsDualStack() != test.dualStack {
+			t.Errorf("%s: expected dual-stack %v, got %v", test.name, test.dualStack, flags.IsDualStack())
+		}
+		if flags.IPFamily() != test.primaryFamily {
+			t.Errorf("%s: expected IP family %s, got %s", test.name, test.primaryFamily, flags.IPFamily())
+		}
+		if cidr := flags.PodNetworkCIDRFor(IPFamilyIPv6); cidr != test.podCIDRForIPv6 {
+			t.Errorf("%s: expected IPv6 pod network CIDR '%s', got '%s'", test.name, test.podCIDRForIPv6, cidr)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/rs/zerolog"
+)
+
+// LoadBalancer config (haproxy in front of all apiservers)
+type LoadBalancer struct {
+	Enabled bool // If set, haproxy balances apiserver traffic over all control-plane nodes
+	Port    int  // Port haproxy listens on (defaults to 6443 on dedicated load-balancer nodes, 8443 on control-plane nodes)
+}
+
+const (
+	// APIServerPort is the port the apiserver listens on.
+	APIServerPort = 6443
+
+	defaultLoadBalancerPort             = APIServerPort
+	defaultControlPlaneLoadBalancerPort = 8443
+)
+
+// setupDefaults fills given flags with default value
+func (flags *LoadBalancer) setupDefaults(log zerolog.Logger, nodes []NodeSpec) error {
+	dedicated := hasLoadBalancerNodes(nodes)
+	if dedicated {
+		// Nodes with the load-balancer role imply a load-balancer
+		flags.Enabled = true
+	}
+	if !flags.Enabled {
+		return nil
+	}
+	if flags.Port == 0 {
+		if dedicated {
+			flags.Port = defaultLoadBalancerPort
+		} else {
+			flags.Port = defaultControlPlaneLoadBalancerPort
+		}
+	}
+	if flags.Port < 1 || flags.Port > 65535 {
+		return maskAny(fmt.Errorf("Invalid load-balancer port %d", flags.Port))
+	}
+	if flags.Port == APIServerPort {
+		for _, n := range nodes {
+			if containsString(n.Roles, RoleLoadBalancer) && containsString(n.Roles, RoleControlPlane) {
+				return maskAny(fmt.Errorf("Load-balancer port %d of control-plane node %s conflicts with the apiserver", flags.Port, n.Name))
+			}
+		}
+		if !dedicated {
+			return maskAny(fmt.Errorf("Load-balancer port %d on control-plane nodes conflicts with the apiserver", flags.Port))
+		}
+	}
+	return nil
+}
+
+// hasLoadBalancerNodes returns true if the given inventory contains load-balancer nodes.
+func hasLoadBalancerNodes(nodes []NodeSpec) bool {
+	for _, n := range nodes {
+		if containsString(n.Roles, RoleLoadBalancer) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadBalancerNodes returns all nodes that run the apiserver load-balancer.
+// These are the nodes with the load-balancer role, or all control-plane nodes
+// if there are no such nodes.
+func (c *ServiceContext) LoadBalancerNodes() []Node {
+	if !c.flags.LoadBalancer.Enabled {
+		return nil
+	}
+	var result []Node
+	for _, n := range c.nodes {
+		if n.HasRole(RoleLoadBalancer) {
+			result = append(result, *n)
+		}
+	}
+	if len(result) > 0 {
+		return result
+	}
+	for _, n := range c.nodes {
+		if n.IsControlPlane {
+			result = append(result, *n)
+		}
+	}
+	return result
+}
+
+// IsLoadBalancerNode returns true if the given node runs the apiserver load-balancer.
+func (c *ServiceContext) IsLoadBalancerNode(n Node) bool {
+	return indexOfNode(c.LoadBalancerNodes(), n) >= 0
+}
+
+// VirtualIPNodes returns all nodes that can hold the virtual IP of the apiserver.
+// These are the load-balancer nodes (if any), otherwise the control-plane nodes.
+func (c *ServiceContext) VirtualIPNodes() []Node {
+	if c.flags.ControlPlane.APIServerVirtualIP == "" {
+		return nil
+	}
+	if lbNodes := c.LoadBalancerNodes(); len(lbNodes) > 0 {
+		return lbNodes
+	}
+	var result []Node
+	for _, n := range c.nodes {
+		if n.IsControlPlane {
+			result = append(result, *n)
+		}
+	}
+	return result
+}
+
+// GetVirtualIPNodeIndex returns the index of the given node in the list of nodes
+// that can hold the virtual IP of the apiserver, or -1 if not found.
+func (c *ServiceContext) GetVirtualIPNodeIndex(n Node) int {
+	return indexOfNode(c.VirtualIPNodes(), n)
+}
+
+// indexOfNode returns the index of the given node in the given list, or -1 if not found.
+func indexOfNode(list []Node, n Node) int {
+	for i, x := range list {
+		if n.Name == x.Name || n.Address == x.Address {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetAPIServerPort returns the port clients use to reach the apiserver.
+func (c *ServiceContext) GetAPIServerPort() int {
+	if c.flags.LoadBalancer.Enabled {
+		return c.flags.LoadBalancer.Port
+	}
+	return APIServerPort
+}
+
+// GetAPIServerURL returns the URL of the apiserver.
+func (c *ServiceContext) GetAPIServerURL() string {
+	return "https://" + net.JoinHostPort(c.GetAPIServer(), strconv.Itoa(c.GetAPIServerPort()))
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+// NetworkProvider is implemented by the network layers of the cluster.
+type NetworkProvider interface {
+	// Name returns the name of the provider, as used in the cluster specification.
+	Name() string
+	// Init deploys the network layer into the cluster.
+	Init(ctx context.Context, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+	// ResetMachine removes the CNI configuration & network interfaces of the provider from the given machine.
+	ResetMachine(ctx context.Context, node Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+}
+
+// Network config
+type Network struct {
+	Provider string // Network layer of the cluster (flannel|calico)
+}
+
+// Calico config
+type Calico struct {
+	Datastore string // Where calico stores its data (kubernetes|etcd)
+	IPIPMode  string // IP-in-IP encapsulation between nodes (Always|CrossSubnet|Never)
+	MTU       int    // MTU of pod interfaces
+	Interface string // Name of the interface used for traffic between nodes (empty to autodetect)
+}
+
+const (
+	NetworkProviderFlannel = "flannel"
+	NetworkProviderCalico  = "calico"
+
+	CalicoDatastoreKubernetes = "kubernetes"
+	CalicoDatastoreEtcd       = "etcd"
+
+	CalicoIPIPAlways      = "Always"
+	CalicoIPIPCrossSubnet = "CrossSubnet"
+	CalicoIPIPNever       = "Never"
+
+	defaultNetworkProvider = NetworkProviderFlannel
+	defaultCalicoDatastore = CalicoDatastoreKubernetes
+	defaultCalicoIPIPMode  = CalicoIPIPAlways
+	defaultCalicoMTU       = 1440 // 1500 - IP-in-IP header
+	defaultCalicoMTUNoIPIP = 1500
+
+	// Minimum calico version that supports dual-stack networking
+	minCalicoDualStackVersion = "v3.11.0"
+)
+
+// setupDefaults fills given flags with default value
+func (flags *Network) setupDefaults(log zerolog.Logger) error {
+	if flags.Provider == "" {
+		flags.Provider = defaultNetworkProvider
+	}
+	switch flags.Provider {
+	case NetworkProviderFlannel, NetworkProviderCalico:
+		// OK
+	default:
+		return maskAny(fmt.Errorf("Unknown network provider '%s', expected %s or %s", flags.Provider, NetworkProviderFlannel, NetworkProviderCalico))
+	}
+	return nil
+}
+
+// validateIPFamilies checks that the network provider supports the IP families of the cluster.
+func (flags Network) validateIPFamilies(kubernetes Kubernetes, images Images) error {
+	switch flags.Provider {
+	case NetworkProviderFlannel:
+		if kubernetes.IsDualStack() || kubernetes.IPFamily() != IPFamilyIPv4 {
+			return maskAny(fmt.Errorf("Network provider %s supports IPv4 pod networks only, use %s for IPv6 or dual-stack", NetworkProviderFlannel, NetworkProviderCalico))
+		}
+	case NetworkProviderCalico:
+		if kubernetes.IsDualStack() && util.CompareVersions(images.CalicoVersion, minCalicoDualStackVersion) < 0 {
+			return maskAny(fmt.Errorf("Dual-stack networking requires calico %s or higher", minCalicoDualStackVersion))
+		}
+	}
+	return nil
+}
+
+// IsCalico returns true if calico is the network layer.
+func (flags Network) IsCalico() bool {
+	return flags.Provider == NetworkProviderCalico
+}
+
+// IsFlannel returns true if flannel is the network layer.
+func (flags Network) IsFlannel() bool {
+	return flags.Provider == NetworkProviderFlannel
+}
+
+// setupDefaults fills given flags with default value
+func (flags *Calico) setupDefaults(log zerolog.Logger) error {
+	if flags.Datastore == "" {
+		flags.Datastore = defaultCalicoDatastore
+	}
+	switch flags.Datastore {
+	case CalicoDatastoreKubernetes, CalicoDatastoreEtcd:
+		// OK
+	default:
+		return maskAny(fmt.Errorf("Unknown calico datastore '%s', expected %s or %s", flags.Datastore, CalicoDatastoreKubernetes, CalicoDatastoreEtcd))
+	}
+	if flags.IPIPMode == "" {
+		flags.IPIPMode = defaultCalicoIPIPMode
+	}
+	switch flags.IPIPMode {
+	case CalicoIPIPAlways, CalicoIPIPCrossSubnet, CalicoIPIPNever:
+		// OK
+	default:
+		return maskAny(fmt.Errorf("Unknown calico IP-in-IP mode '%s', expected %s, %s or %s", flags.IPIPMode, CalicoIPIPAlways, CalicoIPIPCrossSubnet, CalicoIPIPNever))
+	}
+	if flags.MTU == 0 {
+		if flags.IPIPMode == CalicoIPIPNever {
+			flags.MTU = defaultCalicoMTUNoIPIP
+		} else {
+			flags.MTU = defaultCalicoMTU
+		}
+	}
+	if flags.MTU < 576 || flags.MTU > 9000 {
+		return maskAny(fmt.Errorf("Invalid calico MTU %d", flags.MTU))
+	}
+	return nil
+}
+
+// IsEtcdDatastore returns true if calico stores its data in ETCD.
+func (flags Calico) IsEtcdDatastore() bool {
+	return flags.Datastore == CalicoDatastoreEtcd
+}
+
+// KernelModules returns the kernel modules needed by calico.
+func (flags Calico) KernelModules() []string {
+	if flags.IPIPMode != CalicoIPIPNever {
+		return []string{"ipip"}
+	}
+	return nil
+}
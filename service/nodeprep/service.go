@@ -0,0 +1,299 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodeprep
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	ServiceName = "node-prep"
+
+	modulesPath   = "/etc/modules-load.d/helix.conf"
+	sysctlPath    = "/etc/sysctl.d/90-helix.conf"
+	fstabPath     = "/etc/fstab"
+	fstabMarker   = "#helix# "
+	piCmdlinePath = "/boot/cmdline.txt"
+
+	// Files recording the changes made by InitMachine, such that ResetMachine reverts only those
+	stateDir            = "/var/lib/helix/node-prep"
+	cmdlineOptionsState = stateDir + "/cmdline-options"
+	dphysSwapfileState  = stateDir + "/dphys-swapfile-disabled"
+	swapState           = stateDir + "/swap-disabled"
+
+	configFileMode = os.FileMode(0644)
+
+	distroRaspbian = "raspbian"
+	distroUbuntu   = "ubuntu"
+	distroDebian   = "debian"
+)
+
+var (
+	piCgroupOptions = []string{"cgroup_enable=cpuset", "cgroup_enable=memory", "cgroup_memory=1"}
+)
+
+func NewService() service.Service {
+	return &nodePrepService{}
+}
+
+type nodePrepService struct {
+}
+
+func (t *nodePrepService) Name() string {
+	return ServiceName
+}
+
+func (t *nodePrepService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	return nil
+}
+
+// FixesPreflightChecks returns the preflight checks that are fixed by this service.
+func (t *nodePrepService) FixesPreflightChecks() []string {
+	return []string{service.CheckSysctl, service.CheckSwap}
+}
+
+// InitNode detects the distribution of the node.
+// Only Raspbian needs specific steps, other distributions are not rejected.
+func (t *nodePrepService) InitNode(ctx context.Context, node *service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	if node.Distribution == "" {
+		result, err := client.Run(ctx, log, ". /etc/os-release && echo $ID", "", true)
+		if err != nil {
+			return maskAny(err)
+		}
+		node.Distribution = strings.TrimSpace(result)
+		switch node.Distribution {
+		case distroRaspbian, distroUbuntu, distroDebian:
+			log.Info().Msgf("Found '%s' distribution on node", node.Distribution)
+		default:
+			log.Warn().Msgf("Found unknown distribution '%s' on node, Raspbian specific steps are skipped", node.Distribution)
+		}
+	}
+
+	return nil
+}
+
+// InitMachine loads kernel modules, configures sysctls, disables swap
+// and (on Raspberry Pi) enables the memory cgroup.
+func (t *nodePrepService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	// Kernel modules
+	log.Info().Msg("Loading kernel modules")
+	kernelModules := flags.KernelModules()
+	if err := client.UpdateFile(ctx, log, modulesPath, []byte(strings.Join(kernelModules, "\n")+"\n"), configFileMode); err != nil {
+		return maskAny(err)
+	}
+	for _, m := range kernelModules {
+		if _, err := client.Run(ctx, log, "sudo modprobe "+m, "", false); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Sysctls
+	log.Info().Msg("Configuring sysctls")
+	var sysctls []string
+	for key, value := range flags.Sysctls() {
+		sysctls = append(sysctls, key+" = "+value)
+	}
+	sort.Strings(sysctls)
+	if err := client.UpdateFile(ctx, log, sysctlPath, []byte(strings.Join(sysctls, "\n")+"\n"), configFileMode); err != nil {
+		return maskAny(err)
+	}
+	if _, err := client.Run(ctx, log, "sudo sysctl -p "+sysctlPath, "", false); err != nil {
+		return maskAny(err)
+	}
+
+	// Swap
+	log.Info().Msg("Disabling swap")
+	if node.Distribution == distroRaspbian {
+		if enabled, err := client.Run(ctx, log, "systemctl is-enabled dphys-swapfile || true", "", true); err != nil {
+			return maskAny(err)
+		} else if strings.TrimSpace(enabled) == "enabled" {
+			if err := client.UpdateFile(ctx, log, dphysSwapfileState, nil, configFileMode); err != nil {
+				return maskAny(err)
+			}
+			if _, err := client.Run(ctx, log, "sudo systemctl disable --now dphys-swapfile", "", true); err != nil {
+				log.Warn().Err(err).Msg("Failed to disable dphys-swapfile")
+			}
+		}
+	}
+	if swaps, err := client.Run(ctx, log, "tail -n +2 /proc/swaps", "", true); err != nil {
+		return maskAny(err)
+	} else if strings.TrimSpace(swaps) != "" {
+		if err := client.UpdateFile(ctx, log, swapState, nil, configFileMode); err != nil {
+			return maskAny(err)
+		}
+	}
+	if _, err := client.Run(ctx, log, "sudo swapoff -a", "", false); err != nil {
+		return maskAny(err)
+	}
+	if _, err := client.Run(ctx, log, fmt.Sprintf(`sudo sed -i '/^[^#].*[[:space:]]swap[[:space:]]/s/^/%s/' %s`, fstabMarker, fstabPath), "", false); err != nil {
+		return maskAny(err)
+	}
+
+	// Memory cgroup on Raspberry Pi
+	if node.Distribution == distroRaspbian {
+		cmdline, err := client.Run(ctx, log, "cat "+piCmdlinePath, "", false)
+		if err != nil {
+			return maskAny(err)
+		}
+		fields := strings.Fields(cmdline)
+		var added []string
+		for _, opt := range piCgroupOptions {
+			if !containsString(fields, opt) {
+				added = append(added, opt)
+			}
+		}
+		if len(fields) > 0 && len(added) > 0 {
+			log.Info().Msg("Enabling memory cgroup")
+			// Record the added options (merged with those of earlier runs) before changing the kernel command line
+			recorded, err := readState(ctx, log, client, cmdlineOptionsState)
+			if err != nil {
+				return maskAny(err)
+			}
+			for _, opt := range added {
+				if !containsString(recorded, opt) {
+					recorded = append(recorded, opt)
+				}
+			}
+			if err := client.UpdateFile(ctx, log, cmdlineOptionsState, []byte(strings.Join(recorded, "\n")+"\n"), configFileMode); err != nil {
+				return maskAny(err)
+			}
+			if err := writeCmdline(ctx, log, client, append(fields, added...)); err != nil {
+				return maskAny(err)
+			}
+			log.Warn().Msg("Node must be rebooted to enable the memory cgroup")
+		}
+	}
+
+	return nil
+}
+
+// ResetMachine reverts the changes made by InitMachine, as recorded on the machine.
+func (t *nodePrepService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	// Kernel command line options added on Raspberry Pi
+	added, err := readState(ctx, log, client, cmdlineOptionsState)
+	if err != nil {
+		return maskAny(err)
+	}
+	if len(added) > 0 {
+		cmdline, err := client.Run(ctx, log, "cat "+piCmdlinePath, "", false)
+		if err != nil {
+			return maskAny(err)
+		}
+		var fields []string
+		for _, f := range strings.Fields(cmdline) {
+			if !containsString(added, f) {
+				fields = append(fields, f)
+			}
+		}
+		if len(fields) > 0 && len(fields) != len(strings.Fields(cmdline)) {
+			if err := writeCmdline(ctx, log, client, fields); err != nil {
+				return maskAny(err)
+			}
+		}
+	}
+
+	// Swap
+	if _, err := client.Run(ctx, log, fmt.Sprintf(`sudo sed -i 's/^%s//' %s`, fstabMarker, fstabPath), "", false); err != nil {
+		return maskAny(err)
+	}
+	if found, err := hasState(ctx, log, client, swapState); err != nil {
+		return maskAny(err)
+	} else if found {
+		if _, err := client.Run(ctx, log, "sudo swapon -a", "", true); err != nil {
+			log.Warn().Err(err).Msg("Failed to enable swap")
+		}
+	}
+	if found, err := hasState(ctx, log, client, dphysSwapfileState); err != nil {
+		return maskAny(err)
+	} else if found {
+		if _, err := client.Run(ctx, log, "sudo systemctl enable --now dphys-swapfile", "", true); err != nil {
+			log.Warn().Err(err).Msg("Failed to enable dphys-swapfile")
+		}
+	}
+
+	// Sysctls (values are restored at next boot)
+	if err := client.RemoveFile(ctx, log, sysctlPath); err != nil {
+		return maskAny(err)
+	}
+
+	// Kernel modules (modules stay loaded until next boot)
+	if err := client.RemoveFile(ctx, log, modulesPath); err != nil {
+		return maskAny(err)
+	}
+
+	// Recorded changes have been reverted
+	if err := client.RemoveDirectory(ctx, log, stateDir); err != nil {
+		return maskAny(err)
+	}
+
+	return nil
+}
+
+// writeCmdline replaces the kernel command line (on Raspberry Pi) with the given fields.
+// The file is written in place, since /boot is a vfat filesystem that does not support changing permissions.
+func writeCmdline(ctx context.Context, log zerolog.Logger, client util.SSHClient, fields []string) error {
+	if _, err := client.Run(ctx, log, "sudo tee "+piCmdlinePath, strings.Join(fields, " ")+"\n", true); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// readState returns the lines of the given state file, or nil if it does not exist.
+func readState(ctx context.Context, log zerolog.Logger, client util.SSHClient, statePath string) ([]string, error) {
+	content, err := client.Run(ctx, log, fmt.Sprintf("sudo cat %s 2>/dev/null || true", statePath), "", true)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	return strings.Fields(content), nil
+}
+
+// hasState returns true if the given state file exists.
+func hasState(ctx context.Context, log zerolog.Logger, client util.SSHClient, statePath string) (bool, error) {
+	result, err := client.Run(ctx, log, fmt.Sprintf("sudo test -e %s && echo yes || true", statePath), "", true)
+	if err != nil {
+		return false, maskAny(err)
+	}
+	return strings.TrimSpace(result) == "yes", nil
+}
+
+// containsString returns true if the given list contains the given value.
+func containsString(list []string, value string) bool {
+	for _, x := range list {
+		if x == value {
+			return true
+		}
+	}
+	return false
+}
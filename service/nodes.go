@@ -16,6 +16,7 @@ package service
 
 import (
 	"net"
+	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
@@ -23,15 +24,105 @@ import (
 
 // Node holds the name and address of a single cluster member.
 type Node struct {
-	Name           string // Hostname
-	Address        string // IP address
-	IsControlPlane bool
-	Architecture   string
+	Name            string // Hostname
+	Address         string // IP address
+	InternalAddress string // IP address used for traffic within the cluster (empty means Address)
+	IsControlPlane  bool
+	Roles           []string          // Explicit roles (from inventory)
+	Labels          map[string]string // Labels of the Kubernetes node (from inventory)
+	Taints          []Taint           // Taints of the Kubernetes node (from inventory)
+	Architecture    string
+	Distribution    string  // ID of the Linux distribution (from /etc/os-release)
+	CgroupDriver    string  // Cgroup driver used by the container runtime (cgroupfs|systemd)
+	CgroupVersion   int     // Version of the cgroup hierarchy (1|2)
+	Kubelet         Kubelet // Kubelet settings that override the cluster wide settings (from inventory)
+
+	inInventory bool // Set if the node is specified in the inventory (instead of discovered)
+}
+
+const (
+	// CgroupDriverCgroupfs is the cgroup driver that manages cgroups directly.
+	CgroupDriverCgroupfs = "cgroupfs"
+	// CgroupDriverSystemd is the cgroup driver that manages cgroups through systemd.
+	CgroupDriverSystemd = "systemd"
+)
+
+const (
+	// RoleControlPlane is the role of nodes that are part of the control-plane.
+	RoleControlPlane = "control-plane"
+	// RoleWorker is the role of nodes that are not part of the control-plane.
+	RoleWorker = "worker"
+	// RoleEtcd is the role of nodes that only run an ETCD member.
+	RoleEtcd = "etcd"
+	// RoleLoadBalancer is the role of nodes that run the apiserver load-balancer.
+	RoleLoadBalancer = "load-balancer"
+)
+
+// HasRole returns true if the node has the given role.
+func (n Node) HasRole(role string) bool {
+	if len(n.Roles) > 0 {
+		return containsString(n.Roles, role)
+	}
+	switch role {
+	case RoleControlPlane:
+		return n.IsControlPlane
+	case RoleWorker:
+		return !n.IsControlPlane
+	default:
+		return false
+	}
+}
+
+// GetRoles returns all roles of the node.
+func (n Node) GetRoles() []string {
+	if len(n.Roles) > 0 {
+		return n.Roles
+	}
+	if n.IsControlPlane {
+		return []string{RoleControlPlane}
+	}
+	return []string{RoleWorker}
+}
+
+// IsEtcdMember returns true if the node runs an ETCD member.
+func (n Node) IsEtcdMember() bool {
+	return n.IsControlPlane || n.HasRole(RoleEtcd)
+}
+
+// IsKubernetesNode returns true if the node is registered in the Kubernetes cluster.
+// Nodes that only have the etcd and/or load-balancer role run a standalone kubelet
+// for their static pods, but are not part of the Kubernetes cluster.
+func (n Node) IsKubernetesNode() bool {
+	return n.HasRole(RoleControlPlane) || n.HasRole(RoleWorker)
+}
+
+// GetInternalAddress returns the IP address used for traffic within the cluster.
+func (n Node) GetInternalAddress() string {
+	if n.InternalAddress != "" {
+		return n.InternalAddress
+	}
+	return n.Address
+}
+
+// IsInInventory returns true if the node is specified in the inventory (instead of discovered).
+func (n Node) IsInInventory() bool {
+	return n.inInventory
+}
+
+// isValidRole returns true if the given role is known.
+func isValidRole(role string) bool {
+	switch role {
+	case RoleControlPlane, RoleWorker, RoleEtcd, RoleLoadBalancer:
+		return true
+	default:
+		return false
+	}
 }
 
 // CreateNodes inspects all names/addresses in the given list and resolves
 // everything that is not already an IP address.
-func CreateNodes(nameList []string, isControlPlane bool) ([]*Node, error) {
+// Resolved addresses of the given IP family (IPv4|IPv6) are preferred.
+func CreateNodes(nameList []string, isControlPlane bool, ipFamily string) ([]*Node, error) {
 	if len(nameList) == 0 {
 		return nil, nil
 	}
@@ -46,7 +137,7 @@ func CreateNodes(nameList []string, isControlPlane bool) ([]*Node, error) {
 			if net.ParseIP(n) != nil {
 				// Input is an IP address
 				result[i] = &Node{
-					Name:           "node-" + n,
+					Name:           nodeNameForAddress(n),
 					Address:        n,
 					IsControlPlane: isControlPlane,
 				}
@@ -56,11 +147,11 @@ func CreateNodes(nameList []string, isControlPlane bool) ([]*Node, error) {
 				if err != nil {
 					errorsChan <- maskAny(errors.Wrapf(err, "Failed to resolve '%s'", n))
 				} else if len(addrs) == 0 {
-					errorsChan <- maskAny(errors.Wrapf(err, "Found not addresses for '%s'", n))
+					errorsChan <- maskAny(errors.Errorf("Found no addresses for '%s'", n))
 				} else {
 					result[i] = &Node{
 						Name:           n,
-						Address:        addrs[0],
+						Address:        selectAddress(addrs, ipFamily),
 						IsControlPlane: isControlPlane,
 					}
 				}
@@ -75,3 +166,19 @@ func CreateNodes(nameList []string, isControlPlane bool) ([]*Node, error) {
 		return result, nil
 	}
 }
+
+// nodeNameForAddress returns the name of a node that is specified by its IP address.
+func nodeNameForAddress(address string) string {
+	return "node-" + strings.Replace(address, ":", "-", -1)
+}
+
+// selectAddress returns the first address of the given IP family (IPv4|IPv6) in the given list.
+// If there is no such address, the first address is returned.
+func selectAddress(addrs []string, ipFamily string) string {
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ipFamilyOf(ip) == ipFamily {
+			return addr
+		}
+	}
+	return addrs[0]
+}
@@ -0,0 +1,403 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pulcy/helix/util"
+)
+
+const (
+	// Names of preflight checks
+	CheckKernelModules = "kernel-modules"
+	CheckSysctl        = "sysctl"
+	CheckSwap          = "swap"
+	CheckDocker        = "docker"
+	CheckDisk          = "disk"
+	CheckClockSkew     = "clock-skew"
+	CheckPorts         = "ports"
+	CheckSudo          = "sudo"
+	CheckReverseDNS    = "reverse-dns"
+	CheckManifestsDir  = "manifests-dir"
+
+	defaultMinDockerVersion = "1.11.0"
+	defaultMinFreeDiskMB    = 2048
+	defaultMaxClockSkew     = time.Second * 5
+
+	preflightManifestsDir = "/etc/kubernetes/manifests"
+	preflightDiskPath     = "/var/lib"
+)
+
+var (
+	allChecks = []string{
+		CheckKernelModules, CheckSysctl, CheckSwap, CheckDocker, CheckDisk,
+		CheckClockSkew, CheckPorts, CheckSudo, CheckReverseDNS, CheckManifestsDir,
+	}
+)
+
+// requiredPort is a port that must be available on a node.
+type requiredPort struct {
+	Port         int
+	ControlPlane bool   // If set, the port is only required on control-plane nodes
+	Etcd         bool   // If set, the port is only required on ETCD members
+	OwnerPath    string // If this path exists, the port is expected to be used by an earlier installation
+}
+
+var (
+	requiredPorts = []requiredPort{
+		{Port: 6443, ControlPlane: true, OwnerPath: "/etc/kubernetes/manifests/kube-apiserver.yaml"},
+		{Port: 2379, Etcd: true, OwnerPath: "/etc/kubernetes/manifests/etcd.yaml"},
+		{Port: 2380, Etcd: true, OwnerPath: "/etc/kubernetes/manifests/etcd.yaml"},
+		{Port: 10250, OwnerPath: "/etc/systemd/system/kubelet.service"},
+	}
+)
+
+// Preflight configures the read-only checks that are run on all nodes
+// before anything is changed.
+type Preflight struct {
+	Skip             bool          // If set, no preflight checks are run
+	IgnoreChecks     []string      // Names of checks whose failures are ignored
+	MinDockerVersion string        // Minimum version of docker
+	MinFreeDiskMB    int           // Minimum free disk space (in MB) in /var/lib
+	MaxClockSkew     time.Duration // Maximum difference between the clocks of the nodes
+}
+
+// ServicePreflightFixer is implemented by services that fix the
+// problems found by some preflight checks.
+// Failures of those checks do not stop Run.
+type ServicePreflightFixer interface {
+	Service
+	FixesPreflightChecks() []string
+}
+
+// PreflightFailure describes a single failed preflight check.
+type PreflightFailure struct {
+	Node    string // Name of the node on which the check failed (empty when not node specific)
+	Check   string // Name of the failed check
+	Message string // Description of the problem
+}
+
+// PreflightError is the cause of errors returned by Run & RunPreflight
+// when one or more preflight checks failed.
+type PreflightError struct {
+	Failures []PreflightFailure
+}
+
+// Error implements the error interface.
+func (e *PreflightError) Error() string {
+	lines := []string{fmt.Sprintf("%d preflight check(s) failed:", len(e.Failures))}
+	for _, f := range e.Failures {
+		if f.Node != "" {
+			lines = append(lines, fmt.Sprintf("- %s on node %s: %s", f.Check, f.Node, f.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("- %s: %s", f.Check, f.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// setupDefaults fills given flags with default value
+func (flags *Preflight) setupDefaults(log zerolog.Logger) error {
+	if flags.MinDockerVersion == "" {
+		flags.MinDockerVersion = defaultMinDockerVersion
+	}
+	if flags.MinFreeDiskMB == 0 {
+		flags.MinFreeDiskMB = defaultMinFreeDiskMB
+	}
+	if flags.MaxClockSkew == 0 {
+		flags.MaxClockSkew = defaultMaxClockSkew
+	}
+	if flags.MinFreeDiskMB < 0 {
+		return maskAny(fmt.Errorf("MinFreeDiskMB cannot be negative"))
+	}
+	if flags.MaxClockSkew < 0 {
+		return maskAny(fmt.Errorf("MaxClockSkew cannot be negative"))
+	}
+	for _, c := range flags.IgnoreChecks {
+		if !containsString(allChecks, c) {
+			return maskAny(fmt.Errorf("Unknown preflight check '%s', expected one of %s", c, strings.Join(allChecks, ", ")))
+		}
+	}
+	return nil
+}
+
+// RunPreflight runs all preflight checks on all nodes of the cluster,
+// without changing anything.
+// All failures are returned at once in a PreflightError.
+func RunPreflight(ctx context.Context, deps ServiceDependencies, flags ServiceFlags, services []Service) error {
+	sctx, err := NewServiceContext(deps.Logger, flags, true)
+	if err != nil {
+		return maskAny(err)
+	}
+	clients, err := dialMachines(ctx, deps, flags, sctx.nodes)
+	if err != nil {
+		return maskAny(err)
+	}
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	return maskAny(runPreflight(ctx, deps, flags, services, sctx, clients))
+}
+
+// runPreflight runs all preflight checks on all given nodes.
+func runPreflight(ctx context.Context, deps ServiceDependencies, flags ServiceFlags, services []Service, sctx *ServiceContext, clients []util.SSHClient) error {
+	log := deps.Logger
+	if flags.DryRun {
+		log.Info().Msg("Skipping preflight checks in dry-run mode")
+		return nil
+	}
+	log.Info().Msg("Running preflight checks")
+
+	nodes := sctx.nodes
+	var mutex sync.Mutex
+	var failures []PreflightFailure
+	offsets := make(map[int]time.Duration)
+	add := func(node *Node, check, format string, args ...interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		f := PreflightFailure{Check: check, Message: fmt.Sprintf(format, args...)}
+		if node != nil {
+			f.Node = node.Name
+		}
+		failures = append(failures, f)
+	}
+	runParallel(allIndexes(nodes), 0, func(i int) error {
+		if offset, ok := checkNode(ctx, log.With().Str("host", nodes[i].Name).Logger(), sctx, flags, nodes[i], clients[i], add); ok {
+			mutex.Lock()
+			offsets[i] = offset
+			mutex.Unlock()
+		}
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
+		return maskAny(err)
+	}
+
+	// Compare clocks of all nodes
+	if len(offsets) > 1 {
+		minIdx, maxIdx := -1, -1
+		for i, o := range offsets {
+			if minIdx < 0 || o < offsets[minIdx] {
+				minIdx = i
+			}
+			if maxIdx < 0 || o > offsets[maxIdx] {
+				maxIdx = i
+			}
+		}
+		if skew := offsets[maxIdx] - offsets[minIdx]; skew > flags.Preflight.MaxClockSkew {
+			add(nil, CheckClockSkew, "clocks of nodes %s and %s differ %s (max %s)", nodes[minIdx].Name, nodes[maxIdx].Name, skew, flags.Preflight.MaxClockSkew)
+		}
+	}
+
+	// Filter ignored checks & checks fixed by services
+	fixedBy := make(map[string]string)
+	for _, s := range services {
+		if fixer, ok := s.(ServicePreflightFixer); ok {
+			for _, c := range fixer.FixesPreflightChecks() {
+				fixedBy[c] = s.Name()
+			}
+		}
+	}
+	var result []PreflightFailure
+	for _, f := range failures {
+		if containsString(flags.Preflight.IgnoreChecks, f.Check) {
+			log.Warn().Str("host", f.Node).Msgf("Ignoring failed %s check: %s", f.Check, f.Message)
+			continue
+		}
+		if name, found := fixedBy[f.Check]; found {
+			log.Info().Str("host", f.Node).Msgf("Failed %s check will be fixed by %s service: %s", f.Check, name, f.Message)
+			continue
+		}
+		result = append(result, f)
+	}
+	if len(result) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			if result[i].Node != result[j].Node {
+				return result[i].Node < result[j].Node
+			}
+			return result[i].Check < result[j].Check
+		})
+		return maskAny(&PreflightError{Failures: result})
+	}
+	log.Info().Msg("All preflight checks passed")
+	return nil
+}
+
+// checkNode runs all node specific preflight checks on the given node.
+// It returns the offset of the clock of the node compared to the local clock
+// and true if that clock could be read.
+func checkNode(ctx context.Context, log zerolog.Logger, sctx *ServiceContext, flags ServiceFlags, node *Node, client util.SSHClient, add func(node *Node, check, format string, args ...interface{})) (time.Duration, bool) {
+	run := func(cmd string) (string, error) {
+		out, err := client.Run(ctx, log, cmd, "", true)
+		return strings.TrimSpace(out), err
+	}
+
+	// Sudo without password
+	if _, err := run("sudo -n true"); err != nil {
+		add(node, CheckSudo, "sudo requires a password: %v", err)
+	}
+
+	// Kernel modules
+	for _, m := range flags.KernelModules() {
+		if _, err := run(fmt.Sprintf("test -d /sys/module/%s || /sbin/modinfo %s", m, m)); err != nil {
+			add(node, CheckKernelModules, "kernel module %s is not available", m)
+		}
+	}
+
+	// Sysctls
+	requiredSysctls := flags.Sysctls()
+	for _, key := range sortedKeys(requiredSysctls) {
+		expected := requiredSysctls[key]
+		path := "/proc/sys/" + strings.Replace(key, ".", "/", -1)
+		if value, err := run("cat " + path); err != nil {
+			add(node, CheckSysctl, "%s is not available", key)
+		} else if value != expected {
+			add(node, CheckSysctl, "%s is %s, expected %s", key, value, expected)
+		}
+	}
+
+	// Swap
+	if out, err := run("tail -n +2 /proc/swaps"); err != nil {
+		add(node, CheckSwap, "cannot read /proc/swaps: %v", err)
+	} else if out != "" {
+		add(node, CheckSwap, "swap is enabled")
+	}
+
+	// Docker (containerd is installed by helix)
+	if !flags.ContainerRuntime.IsContainerd() {
+		if version, err := run("sudo -n docker version --format '{{.Server.Version}}'"); err != nil {
+			add(node, CheckDocker, "docker is not installed or not running")
+		} else if util.CompareVersions(version, flags.Preflight.MinDockerVersion) < 0 {
+			add(node, CheckDocker, "docker version %s is older than %s", version, flags.Preflight.MinDockerVersion)
+		}
+	}
+
+	// Free disk space
+	if out, err := run("df -Pk " + preflightDiskPath + " | tail -n 1"); err != nil {
+		add(node, CheckDisk, "cannot determine free disk space of %s: %v", preflightDiskPath, err)
+	} else if fields := strings.Fields(out); len(fields) < 4 {
+		add(node, CheckDisk, "unexpected output of df: %s", out)
+	} else if availKB, err := strconv.ParseInt(fields[3], 10, 64); err != nil {
+		add(node, CheckDisk, "unexpected output of df: %s", out)
+	} else if availMB := availKB / 1024; availMB < int64(flags.Preflight.MinFreeDiskMB) {
+		add(node, CheckDisk, "%dMB available in %s, need %dMB", availMB, preflightDiskPath, flags.Preflight.MinFreeDiskMB)
+	}
+
+	// Ports
+	if out, err := run("ss -ltn 2>/dev/null || netstat -ltn"); err != nil {
+		add(node, CheckPorts, "cannot list listening ports: %v", err)
+	} else {
+		inUse := listeningPorts(out)
+		ports := append([]requiredPort{}, requiredPorts...)
+		if sctx.IsLoadBalancerNode(*node) {
+			ports = append(ports, requiredPort{Port: flags.LoadBalancer.Port, OwnerPath: "/etc/kubernetes/manifests/haproxy.yaml"})
+		}
+		for _, p := range ports {
+			if (p.ControlPlane && !node.IsControlPlane) || (p.Etcd && !node.IsEtcdMember()) || !inUse[p.Port] {
+				continue
+			}
+			if _, err := run("test -e " + p.OwnerPath); err == nil {
+				// Used by an earlier installation
+				continue
+			}
+			add(node, CheckPorts, "port %d is already in use", p.Port)
+		}
+	}
+
+	// Manifests directory must be writable (or creatable)
+	if _, err := run(fmt.Sprintf("d=%s; while [ ! -d $d ]; do d=$(dirname $d); done; sudo -n test -w $d", preflightManifestsDir)); err != nil {
+		add(node, CheckManifestsDir, "%s is not writable", preflightManifestsDir)
+	}
+
+	// Reverse DNS (not needed for nodes in the inventory)
+	if !node.inInventory {
+		if names, err := net.LookupAddr(node.Address); err != nil || len(names) == 0 {
+			add(node, CheckReverseDNS, "no reverse DNS entry for %s", node.Address)
+		} else if node.Name != nodeNameForAddress(node.Address) && !matchesHostName(names, node.Name) {
+			add(node, CheckReverseDNS, "%s resolves to %s, expected %s", node.Address, strings.Join(names, ", "), node.Name)
+		}
+	}
+
+	// Clock
+	before := time.Now()
+	out, err := run("date +%s")
+	after := time.Now()
+	if err != nil {
+		add(node, CheckClockSkew, "cannot read clock: %v", err)
+		return 0, false
+	}
+	remote, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		add(node, CheckClockSkew, "unexpected output of date: %s", out)
+		return 0, false
+	}
+	local := before.Add(after.Sub(before) / 2)
+	return time.Unix(remote, 0).Sub(local), true
+}
+
+// listeningPorts parses the output of `ss -ltn` or `netstat -ltn`
+// and returns all ports that are listened on.
+func listeningPorts(output string) map[int]bool {
+	result := make(map[int]bool)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		local := fields[3]
+		idx := strings.LastIndex(local, ":")
+		if idx < 0 {
+			continue
+		}
+		if port, err := strconv.Atoi(local[idx+1:]); err == nil {
+			result[port] = true
+		}
+	}
+	return result
+}
+
+// matchesHostName returns true if one of the given (reverse DNS) names
+// matches the given hostname.
+func matchesHostName(names []string, hostName string) bool {
+	for _, n := range names {
+		n = strings.TrimSuffix(n, ".")
+		if strings.EqualFold(n, hostName) || strings.EqualFold(strings.SplitN(n, ".", 2)[0], hostName) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of the given map in sorted order.
+func sortedKeys(m map[string]string) []string {
+	result := make([]string, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
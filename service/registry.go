@@ -0,0 +1,147 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Registry holds custom services that are run alongside the built-in services.
+type Registry struct {
+	mutex   sync.Mutex
+	entries []registryEntry
+}
+
+type registryEntry struct {
+	service   Service
+	dependsOn []string
+}
+
+var (
+	// DefaultRegistry is the registry used by Register.
+	DefaultRegistry = NewRegistry()
+)
+
+// NewRegistry creates a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the given service to the default registry.
+// See Registry.Register.
+func Register(s Service, dependsOn ...string) error {
+	return maskAny(DefaultRegistry.Register(s, dependsOn...))
+}
+
+// Register adds the given service to the registry.
+// The service will be initialized after all services with given names
+// (and reset before them).
+func (r *Registry) Register(s Service, dependsOn ...string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, e := range r.entries {
+		if e.service.Name() == s.Name() {
+			return maskAny(fmt.Errorf("Service %s is already registered", s.Name()))
+		}
+	}
+	r.entries = append(r.entries, registryEntry{
+		service:   s,
+		dependsOn: dependsOn,
+	})
+	return nil
+}
+
+// Clone returns a copy of the registry.
+func (r *Registry) Clone() *Registry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return &Registry{
+		entries: append([]registryEntry(nil), r.entries...),
+	}
+}
+
+// Merge returns the given (ordered) list of services, extended with all
+// registered services.
+// Every registered service is placed after the last of its dependencies,
+// behind registered services that were placed there before.
+// Services without dependencies are placed at the end.
+// Registered services that depend on the same service keep their registration order.
+func (r *Registry) Merge(services []Service) ([]Service, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result := append([]Service(nil), services...)
+	indexOf := func(name string) int {
+		last := -1
+		for i, s := range result {
+			if s.Name() == name {
+				last = i
+			}
+		}
+		return last
+	}
+	for _, e := range r.entries {
+		if indexOf(e.service.Name()) >= 0 {
+			return nil, maskAny(fmt.Errorf("Service %s conflicts with an existing service", e.service.Name()))
+		}
+	}
+
+	pending := append([]registryEntry(nil), r.entries...)
+	inserted := make(map[string]bool)
+	for len(pending) > 0 {
+		var remaining []registryEntry
+		for _, e := range pending {
+			pos := len(result)
+			if len(e.dependsOn) > 0 {
+				pos = -1
+				for _, dep := range e.dependsOn {
+					idx := indexOf(dep)
+					if idx < 0 {
+						pos = -1
+						break
+					}
+					if idx+1 > pos {
+						pos = idx + 1
+					}
+				}
+			}
+			if pos < 0 {
+				// Not all dependencies are available (yet)
+				remaining = append(remaining, e)
+				continue
+			}
+			// Keep registration order: place it after services that were registered earlier
+			// and have already been placed after the same dependency.
+			for pos < len(result) && inserted[result[pos].Name()] {
+				pos++
+			}
+			result = append(result[:pos], append([]Service{e.service}, result[pos:]...)...)
+			inserted[e.service.Name()] = true
+		}
+		if len(remaining) == len(pending) {
+			var names []string
+			for _, e := range remaining {
+				names = append(names, e.service.Name())
+			}
+			return nil, maskAny(fmt.Errorf("Unknown or circular dependencies in services: %s", strings.Join(names, ", ")))
+		}
+		pending = remaining
+	}
+	return result, nil
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type testService string
+
+func (s testService) Name() string { return string(s) }
+
+func (s testService) Prepare(ctx context.Context, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags, willInit bool) error {
+	return nil
+}
+
+func TestRegistryMerge(t *testing.T) {
+	type registration struct {
+		name      string
+		dependsOn []string
+	}
+	tests := []struct {
+		name     string
+		services []string
+		register []registration
+		expected []string
+		fails    bool
+	}{
+		{
+			name:     "no registered services",
+			services: []string{"a", "b"},
+			expected: []string{"a", "b"},
+		},
+		{
+			name:     "after dependency",
+			services: []string{"a", "b", "c"},
+			register: []registration{{"x", []string{"a"}}},
+			expected: []string{"a", "x", "b", "c"},
+		},
+		{
+			name:     "after last dependency",
+			services: []string{"a", "b", "c"},
+			register: []registration{{"x", []string{"b", "a"}}},
+			expected: []string{"a", "b", "x", "c"},
+		},
+		{
+			name:     "without dependencies at the end",
+			services: []string{"a", "b"},
+			register: []registration{{"x", nil}, {"y", nil}},
+			expected: []string{"a", "b", "x", "y"},
+		},
+		{
+			name:     "same dependency keeps registration order",
+			services: []string{"a", "b"},
+			register: []registration{{"x", []string{"a"}}, {"y", []string{"a"}}, {"z", []string{"a"}}},
+			expected: []string{"a", "x", "y", "z", "b"},
+		},
+		{
+			name:     "dependency on registered service",
+			services: []string{"a", "b"},
+			register: []registration{{"x", []string{"a"}}, {"y", []string{"x"}}, {"z", []string{"a"}}},
+			expected: []string{"a", "x", "y", "z", "b"},
+		},
+		{
+			name:     "dependency registered later",
+			services: []string{"a", "b"},
+			register: []registration{{"y", []string{"x"}}, {"x", []string{"a"}}},
+			expected: []string{"a", "x", "y", "b"},
+		},
+		{
+			name:     "unknown dependency",
+			services: []string{"a"},
+			register: []registration{{"x", []string{"unknown"}}},
+			fails:    true,
+		},
+		{
+			name:     "circular dependency",
+			services: []string{"a"},
+			register: []registration{{"x", []string{"y"}}, {"y", []string{"x"}}},
+			fails:    true,
+		},
+		{
+			name:     "conflict with existing service",
+			services: []string{"a"},
+			register: []registration{{"a", nil}},
+			fails:    true,
+		},
+	}
+	for _, test := range tests {
+		r := NewRegistry()
+		for _, x := range test.register {
+			if err := r.Register(testService(x.name), x.dependsOn...); err != nil {
+				t.Fatalf("%s: Register(%s) failed: %v", test.name, x.name, err)
+			}
+		}
+		var services []Service
+		for _, name := range test.services {
+			services = append(services, testService(name))
+		}
+		result, err := r.Merge(services)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected error, got none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		var names []string
+		for _, s := range result {
+			names = append(names, s.Name())
+		}
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, names)
+		}
+	}
+}
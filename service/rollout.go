@@ -0,0 +1,155 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Rollout holds the settings that control how many nodes are
+// changed at the same time.
+type Rollout struct {
+	Parallelism         int           // Maximum number of nodes processed concurrently (0 means unlimited)
+	BatchSize           int           // Number of nodes per rolling batch (0 means all nodes in a single batch)
+	PauseBetweenBatches time.Duration // Time to wait between two batches
+}
+
+// ServiceDisruptive is implemented by services that temporarily
+// affect the availability of a node while being changed.
+// Control-plane nodes are processed one at a time for such services.
+type ServiceDisruptive interface {
+	Service
+	IsDisruptive() bool
+}
+
+// setupDefaults validates the rollout settings.
+func (flags *Rollout) setupDefaults(log zerolog.Logger) error {
+	if flags.Parallelism < 0 {
+		return maskAny(fmt.Errorf("Parallelism cannot be negative"))
+	}
+	if flags.BatchSize < 0 {
+		return maskAny(fmt.Errorf("Batch size cannot be negative"))
+	}
+	if flags.PauseBetweenBatches < 0 {
+		return maskAny(fmt.Errorf("Pause between batches cannot be negative"))
+	}
+	return nil
+}
+
+// isDisruptive returns true if the given service has declared itself disruptive.
+func isDisruptive(s Service) bool {
+	if d, ok := s.(ServiceDisruptive); ok {
+		return d.IsDisruptive()
+	}
+	return false
+}
+
+// createBatches splits the indexes of the given nodes into rolling batches.
+// When disruptive is set, every control-plane node gets a batch of its own
+// and these batches come first.
+func (flags Rollout) createBatches(nodes []*Node, disruptive bool) [][]int {
+	var result [][]int
+	var rest []int
+	for i, n := range nodes {
+		if disruptive && n.IsControlPlane {
+			result = append(result, []int{i})
+		} else {
+			rest = append(rest, i)
+		}
+	}
+	batchSize := flags.BatchSize
+	if batchSize == 0 {
+		batchSize = len(rest)
+	}
+	for len(rest) > 0 {
+		size := batchSize
+		if size > len(rest) {
+			size = len(rest)
+		}
+		result = append(result, rest[:size])
+		rest = rest[size:]
+	}
+	return result
+}
+
+// runBatches calls the given function for the index of every node,
+// batch after batch, honoring the configured parallelism.
+// It stops at the first batch that resulted in an error.
+func (flags Rollout) runBatches(ctx context.Context, log zerolog.Logger, nodes []*Node, disruptive bool, fn func(i int) error) error {
+	batches := flags.createBatches(nodes, disruptive)
+	for b, batch := range batches {
+		if b > 0 && flags.PauseBetweenBatches > 0 {
+			log.Info().Msgf("Waiting %s before next batch", flags.PauseBetweenBatches)
+			select {
+			case <-time.After(flags.PauseBetweenBatches):
+				// Continue
+			case <-ctx.Done():
+				return maskAny(ctx.Err())
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return maskAny(err)
+		}
+		if err := runParallel(batch, flags.Parallelism, fn); err != nil {
+			return maskAny(err)
+		}
+	}
+	return nil
+}
+
+// runParallel calls the given function for every given index,
+// with at most parallelism invocations at the same time (0 means unlimited).
+// It returns the first error that occurred.
+func runParallel(indexes []int, parallelism int, fn func(i int) error) error {
+	if parallelism <= 0 || parallelism > len(indexes) {
+		parallelism = len(indexes)
+	}
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, parallelism)
+	errors := make(chan error, len(indexes))
+	for _, i := range indexes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(i); err != nil {
+				errors <- maskAny(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errors)
+	if err, ok := <-errors; ok {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// allIndexes returns the indexes of all given nodes.
+func allIndexes(nodes []*Node) []int {
+	result := make([]int, len(nodes))
+	for i := range nodes {
+		result[i] = i
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// testNodes creates nodes, where the nodes at the given indexes are control-plane nodes.
+func testNodes(count int, controlPlane ...int) []*Node {
+	result := make([]*Node, count)
+	for i := range result {
+		result[i] = &Node{}
+	}
+	for _, i := range controlPlane {
+		result[i].IsControlPlane = true
+	}
+	return result
+}
+
+func TestCreateBatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		batchSize  int
+		nodes      []*Node
+		disruptive bool
+		expected   [][]int
+	}{
+		{"no nodes", 0, nil, false, nil},
+		{"single batch", 0, testNodes(3), false, [][]int{{0, 1, 2}}},
+		{"batch size", 2, testNodes(5), false, [][]int{{0, 1}, {2, 3}, {4}}},
+		{"batch size larger than nodes", 10, testNodes(3), false, [][]int{{0, 1, 2}}},
+		{"control-plane not disruptive", 2, testNodes(4, 1, 3), false, [][]int{{0, 1}, {2, 3}}},
+		{"control-plane first when disruptive", 0, testNodes(4, 1, 3), true, [][]int{{1}, {3}, {0, 2}}},
+		{"control-plane only", 2, testNodes(2, 0, 1), true, [][]int{{0}, {1}}},
+		{"control-plane & batch size", 1, testNodes(3, 2), true, [][]int{{2}, {0}, {1}}},
+	}
+	for _, test := range tests {
+		flags := Rollout{BatchSize: test.batchSize}
+		result := flags.createBatches(test.nodes, test.disruptive)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, result)
+		}
+	}
+}
+
+func TestRunBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		batchSize   int
+		parallelism int
+		nodes       []*Node
+		failAt      int // Index of the node that fails (-1 for none)
+		expected    []int
+		fails       bool
+	}{
+		{"all nodes", 0, 0, testNodes(3), -1, []int{0, 1, 2}, false},
+		{"parallelism", 0, 1, testNodes(3), -1, []int{0, 1, 2}, false},
+		{"batches", 1, 0, testNodes(3, 2), -1, []int{2, 0, 1}, false},
+		{"stops after failed batch", 1, 0, testNodes(3), 1, []int{0, 1}, true},
+	}
+	for _, test := range tests {
+		flags := Rollout{BatchSize: test.batchSize, Parallelism: test.parallelism}
+		var mutex sync.Mutex
+		var called []int
+		err := flags.runBatches(context.Background(), zerolog.Nop(), test.nodes, true, func(i int) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			called = append(called, i)
+			if i == test.failAt {
+				return errors.New("failed")
+			}
+			return nil
+		})
+		if test.fails && err == nil {
+			t.Errorf("%s: expected error, got none", test.name)
+		} else if !test.fails && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+		if test.parallelism == 1 || test.batchSize == 1 {
+			// Order is deterministic
+			if !reflect.DeepEqual(called, test.expected) {
+				t.Errorf("%s: expected calls %v, got %v", test.name, test.expected, called)
+			}
+		} else if len(called) != len(test.expected) {
+			t.Errorf("%s: expected %d calls, got %d", test.name, len(test.expected), len(called))
+		}
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	for _, parallelism := range []int{0, 1, 2, 5, 10} {
+		var mutex sync.Mutex
+		running, maxRunning, calls := 0, 0, 0
+		err := runParallel([]int{0, 1, 2, 3, 4}, parallelism, func(i int) error {
+			mutex.Lock()
+			running++
+			calls++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+			defer func() {
+				mutex.Lock()
+				running--
+				mutex.Unlock()
+			}()
+			if i == 3 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+		if err == nil {
+			t.Errorf("parallelism %d: expected error, got none", parallelism)
+		}
+		if calls != 5 {
+			t.Errorf("parallelism %d: expected 5 calls, got %d", parallelism, calls)
+		}
+		if parallelism > 0 && maxRunning > parallelism {
+			t.Errorf("parallelism %d: got %d concurrent calls", parallelism, maxRunning)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// Script configures a custom service that uploads files and
+// runs commands on selected nodes.
+type Script struct {
+	Name      string       // Name of the service
+	DependsOn []string     // Names of services that must be initialized before this one
+	Roles     []string     // Roles of the nodes to run on (empty means all nodes)
+	Files     []ScriptFile // Files to upload during init (and remove during reset)
+	Init      []string     // Commands to run during init (after uploading files)
+	Reset     []string     // Commands to run during reset (before removing files)
+}
+
+// ScriptFile is a file uploaded by a script service.
+type ScriptFile struct {
+	Path    string // Path of the file on the node
+	Content string // Content of the file
+	Source  string // Path of a local file containing the content (alternative to Content)
+	Mode    string // Octal file mode (defaults to 0644)
+}
+
+// setupDefaults fills given flags with default value
+func (flags *Script) setupDefaults(log zerolog.Logger) error {
+	if flags.Name == "" {
+		return maskAny(fmt.Errorf("Script must have a name"))
+	}
+	for _, r := range flags.Roles {
+		if !isValidRole(r) {
+			return maskAny(fmt.Errorf("Script %s has unknown role '%s'", flags.Name, r))
+		}
+	}
+	for _, f := range flags.Files {
+		if f.Path == "" {
+			return maskAny(fmt.Errorf("Script %s has a file without path", flags.Name))
+		}
+		if f.Content != "" && f.Source != "" {
+			return maskAny(fmt.Errorf("Script %s file %s cannot have both content and source", flags.Name, f.Path))
+		}
+	}
+	return nil
+}
+
+// AppliesTo returns true if the script must run on the given node.
+func (flags Script) AppliesTo(node Node) bool {
+	if len(flags.Roles) == 0 {
+		return true
+	}
+	for _, r := range flags.Roles {
+		if node.HasRole(r) {
+			return true
+		}
+	}
+	return false
+}
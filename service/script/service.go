@@ -0,0 +1,138 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package script
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/pulcy/helix/service"
+	"github.com/pulcy/helix/util"
+)
+
+var (
+	maskAny = errors.WithStack
+)
+
+const (
+	defaultFileMode = os.FileMode(0644)
+)
+
+// NewService creates a new service that uploads files and runs
+// commands as configured in the given script.
+func NewService(script service.Script) service.Service {
+	return &scriptService{
+		script: script,
+	}
+}
+
+type scriptService struct {
+	script service.Script
+	files  []file
+}
+
+type file struct {
+	Path    string
+	Content []byte
+	Mode    os.FileMode
+}
+
+func (t *scriptService) Name() string {
+	return t.script.Name
+}
+
+// Prepare loads the content of all files of the script.
+func (t *scriptService) Prepare(ctx context.Context, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags, willInit bool) error {
+	t.files = nil
+	for _, f := range t.script.Files {
+		x := file{
+			Path:    f.Path,
+			Content: []byte(f.Content),
+			Mode:    defaultFileMode,
+		}
+		if f.Mode != "" {
+			mode, err := strconv.ParseUint(f.Mode, 8, 32)
+			if err != nil {
+				return maskAny(errors.Wrapf(err, "Invalid mode of file %s in script %s", f.Path, t.Name()))
+			}
+			x.Mode = os.FileMode(mode)
+		}
+		if f.Source != "" && willInit {
+			content, err := ioutil.ReadFile(f.Source)
+			if err != nil {
+				return maskAny(err)
+			}
+			x.Content = content
+		}
+		t.files = append(t.files, x)
+	}
+	return nil
+}
+
+// InitMachine uploads all files and runs all init commands of the script.
+func (t *scriptService) InitMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	if !t.script.AppliesTo(node) {
+		log.Info().Msgf("No %s on this machine", t.Name())
+		return nil
+	}
+
+	// Upload files
+	for _, f := range t.files {
+		if err := client.UpdateFile(ctx, log, f.Path, f.Content, f.Mode); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Run commands
+	for _, cmd := range t.script.Init {
+		if _, err := client.Run(ctx, log, cmd, "", false); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// ResetMachine runs all reset commands of the script and removes all files.
+func (t *scriptService) ResetMachine(ctx context.Context, node service.Node, client util.SSHClient, sctx *service.ServiceContext, deps service.ServiceDependencies, flags service.ServiceFlags) error {
+	log := deps.Logger.With().Str("host", node.Name).Logger()
+
+	if !t.script.AppliesTo(node) {
+		log.Info().Msgf("No %s on this machine", t.Name())
+		return nil
+	}
+
+	// Run commands
+	for _, cmd := range t.script.Reset {
+		if _, err := client.Run(ctx, log, cmd, "", false); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	// Remove files
+	for _, f := range t.files {
+		if err := client.RemoveFile(ctx, log, f.Path); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
@@ -15,11 +15,11 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
-	"sync"
 
 	"github.com/rs/zerolog"
 
@@ -28,45 +28,50 @@ import (
 
 type Service interface {
 	Name() string
-	Prepare(sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags, willInit bool) error
+	Prepare(ctx context.Context, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags, willInit bool) error
 }
 
 type ServiceIniter interface {
 	Service
-	Init(sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+	Init(ctx context.Context, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
 }
 
 type ServiceReseter interface {
 	Service
-	Reset(sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+	Reset(ctx context.Context, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
 }
 
 type ServiceMachines interface {
 	Service
-	InitMachine(node Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
-	ResetMachine(node Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+	InitMachine(ctx context.Context, node Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+	ResetMachine(ctx context.Context, node Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
 }
 
 type ServiceNodeInitializer interface {
 	Service
-	InitNode(node *Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
+	InitNode(ctx context.Context, node *Node, client util.SSHClient, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags) error
 }
 
 type ServiceDependencies struct {
 	Logger         zerolog.Logger
+	DialSSH        util.SSHDialer // Used to connect to machines (defaults to util.DialSSH)
 	EtcdCA         util.CA
 	KubernetesCA   util.CA
 	ServiceAccount struct {
 		Cert string
 		Key  string
 	}
+	BootstrapToken     util.BootstrapToken // Token used by worker kubelets to request a client certificate
+	KeepalivedPassword string              // Password used to authenticate VRRP advertisements
+	EncryptionKeys     util.EncryptionKeys // Keys used to encrypt secrets at rest (the first key is used for writing)
 }
 
 type ServiceFlags struct {
 	// General
 	DryRun       bool
-	LocalConfDir string   // Path of local directory containing configuration (like ca certificates) files.
-	Members      []string // IP/hostname of all machines (no need to include control-plane members)
+	LocalConfDir string     // Path of local directory containing configuration (like ca certificates) files.
+	Members      []string   // IP/hostname of all machines (no need to include control-plane members)
+	Nodes        []NodeSpec // Explicit inventory of nodes (merged with members)
 	SSH          struct {
 		User string
 	}
@@ -74,14 +79,64 @@ type ServiceFlags struct {
 	// Docker images
 	Images Images
 
+	// Container runtime
+	ContainerRuntime ContainerRuntime
+
 	// Control plane
 	ControlPlane ControlPlane
 
+	// Keepalived (virtual IP of the apiserver)
+	Keepalived Keepalived
+
+	// Load-balancer in front of all apiservers
+	LoadBalancer LoadBalancer
+
+	// Customizations of control-plane components
+	APIServer         ControlPlaneComponent
+	ControllerManager ControlPlaneComponent
+	Scheduler         ControlPlaneComponent
+
+	// Audit logging of the apiserver
+	Audit Audit
+
+	// Encryption of secrets at rest
+	Encryption Encryption
+
 	// ETCD
 	Etcd Etcd
 
 	// Kubernetes config
 	Kubernetes Kubernetes
+
+	// Kubelet config
+	Kubelet Kubelet
+
+	// Kube-proxy config
+	KubeProxy KubeProxy
+
+	// Network layer
+	Network Network
+
+	// Flannel config (if network provider is flannel)
+	Flannel Flannel
+
+	// Calico config (if network provider is calico)
+	Calico Calico
+
+	// Rollout settings
+	Rollout Rollout
+
+	// Timeouts of service steps
+	Timeouts Timeouts
+
+	// Custom script services
+	Scripts []Script
+
+	// Hooks around services & nodes
+	Hooks Hooks
+
+	// Checks run before anything is changed
+	Preflight Preflight
 }
 
 type ServiceContext struct {
@@ -91,7 +146,28 @@ type ServiceContext struct {
 
 // SetupDefaults fills given flags with default value
 func (flags *ServiceFlags) SetupDefaults(log zerolog.Logger, isSetup bool) error {
-	if err := flags.ControlPlane.setupDefaults(log, isSetup); err != nil {
+	if err := setupInventoryDefaults(log, flags.Nodes); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.ControlPlane.setupDefaults(log, isSetup && !hasControlPlaneNodes(flags.Nodes)); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Keepalived.setupDefaults(log, flags.ControlPlane.APIServerVirtualIP); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.LoadBalancer.setupDefaults(log, flags.Nodes); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.APIServer.validate(ComponentAPIServer); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.ControllerManager.validate(ComponentControllerManager); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Scheduler.validate(ComponentScheduler); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Audit.setupDefaults(log, flags.APIServer); err != nil {
 		return maskAny(err)
 	}
 	if err := flags.Etcd.setupDefaults(log); err != nil {
@@ -100,23 +176,162 @@ func (flags *ServiceFlags) SetupDefaults(log zerolog.Logger, isSetup bool) error
 	if err := flags.Kubernetes.setupDefaults(log); err != nil {
 		return maskAny(err)
 	}
-	if err := flags.Images.setupDefaults(log, flags.Kubernetes.Version); err != nil {
+	if err := flags.Encryption.setupDefaults(log, flags.Kubernetes.Version); err != nil {
 		return maskAny(err)
 	}
+	if err := flags.Kubelet.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.KubeProxy.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Network.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Images.setupDefaults(log, flags.Kubernetes.Version, flags.Network.Provider); err != nil {
+		return maskAny(err)
+	}
+	if flags.Network.IsFlannel() {
+		if err := flags.Flannel.setupDefaults(log, flags.Images.FlannelVersion); err != nil {
+			return maskAny(err)
+		}
+	}
+	if flags.Network.IsCalico() {
+		if err := flags.Calico.setupDefaults(log); err != nil {
+			return maskAny(err)
+		}
+	}
+	if err := flags.Network.validateIPFamilies(flags.Kubernetes, flags.Images); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.ContainerRuntime.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Rollout.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Timeouts.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Hooks.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	if err := flags.Preflight.setupDefaults(log); err != nil {
+		return maskAny(err)
+	}
+	for i := range flags.Scripts {
+		if err := flags.Scripts[i].setupDefaults(log); err != nil {
+			return maskAny(err)
+		}
+	}
 	return nil
 }
 
-// CreateNodes creates a list of Node objects for all members.
+// CreateNodes creates a list of Node objects for all members and all nodes in the inventory.
+// Nodes in the inventory take precedence over discovered nodes.
 func (flags *ServiceFlags) CreateNodes(log zerolog.Logger, isSetup bool) ([]*Node, error) {
-	nodes, err := CreateNodes(flags.Members, false)
+	ipFamily := flags.Kubernetes.IPFamily()
+	nodes, err := CreateNodes(flags.Members, false, ipFamily)
 	if err != nil {
 		return nil, maskAny(err)
 	}
-	cpNodes, err := flags.ControlPlane.createNodes(log)
+	cpNodes, err := flags.ControlPlane.createNodes(log, ipFamily)
 	if err != nil {
 		return nil, maskAny(err)
 	}
-	return mergeNodes(nodes, cpNodes), nil
+	inventoryNodes, err := createInventoryNodes(flags.Nodes, ipFamily)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	return mergeNodes(mergeNodes(nodes, cpNodes), inventoryNodes), nil
+}
+
+// NewServiceContext creates a context for the given flags, containing all nodes of the cluster.
+func NewServiceContext(log zerolog.Logger, flags ServiceFlags, isSetup bool) (*ServiceContext, error) {
+	nodes, err := flags.CreateNodes(log, isSetup)
+	if err != nil {
+		return nil, maskAny(err)
+	}
+	if err := flags.Kubernetes.validateNodeAddresses(nodes); err != nil {
+		return nil, maskAny(err)
+	}
+	return &ServiceContext{
+		flags: flags,
+		nodes: nodes,
+	}, nil
+}
+
+// Nodes returns all nodes of the cluster.
+func (c *ServiceContext) Nodes() []Node {
+	result := make([]Node, len(c.nodes))
+	for i, n := range c.nodes {
+		result[i] = *n
+	}
+	return result
+}
+
+// Sysctls returns the sysctls (name -> value) that must be set on all nodes.
+func (flags ServiceFlags) Sysctls() map[string]string {
+	result := map[string]string{
+		"net.bridge.bridge-nf-call-iptables":  "1",
+		"net.bridge.bridge-nf-call-ip6tables": "1",
+		"net.ipv4.ip_forward":                 "1",
+	}
+	if flags.Kubernetes.IsDualStack() || flags.Kubernetes.IPFamily() == IPFamilyIPv6 {
+		// Only when needed, since it disables router advertisements on the host
+		result["net.ipv6.conf.all.forwarding"] = "1"
+	}
+	return result
+}
+
+// KernelModules returns the kernel modules that must be loaded on all nodes.
+func (flags ServiceFlags) KernelModules() []string {
+	result := []string{"br_netfilter", "overlay"}
+	switch flags.Network.Provider {
+	case NetworkProviderFlannel:
+		result = append(result, flags.Flannel.KernelModules()...)
+	case NetworkProviderCalico:
+		result = append(result, flags.Calico.KernelModules()...)
+	}
+	result = append(result, flags.KubeProxy.KernelModules()...)
+	return result
+}
+
+// LoadCertificates loads the certificate authorities and service account certificate
+// from the given local configuration directory.
+// Certificates that do not exist yet are created.
+func (deps *ServiceDependencies) LoadCertificates(confDir string) error {
+	var err error
+	// Create ETCD CA
+	deps.EtcdCA, err = util.NewCA("ETCD CA", filepath.Join(confDir, "etcd-ca.crt"), filepath.Join(confDir, "etcd-ca.key"))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create Kubernetes CA
+	deps.KubernetesCA, err = util.NewCA("Kubernetes CA", filepath.Join(confDir, "kubernetes-ca.crt"), filepath.Join(confDir, "kubernetes-ca.key"))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create service account certificate
+	deps.ServiceAccount.Cert, deps.ServiceAccount.Key, err = util.NewServiceAccountCertificate(filepath.Join(confDir, "kubernetes-sa.pub"), filepath.Join(confDir, "kubernetes-sa.key"))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create kubelet bootstrap token
+	deps.BootstrapToken, err = util.NewBootstrapToken(filepath.Join(confDir, "bootstrap-token"))
+	if err != nil {
+		return maskAny(err)
+	}
+
+	// Create keepalived password (VRRP passwords are limited to 8 characters)
+	deps.KeepalivedPassword, err = util.NewPassword(filepath.Join(confDir, "keepalived-password"), keepalivedPasswordLength)
+	if err != nil {
+		return maskAny(err)
+	}
+	return nil
 }
 
 // GetControlPlaneIndex returns the index of the given node in the control plan (0...)
@@ -134,13 +349,22 @@ func (c *ServiceContext) GetControlPlaneIndex(n Node) int {
 }
 
 // mergeNodes returns a list of all nodes in a & b, last node wins.
+// Nodes are considered equal when their names or addresses are equal.
 func mergeNodes(a, b []*Node) []*Node {
 	m := make(map[string]*Node)
-	for _, x := range a {
+	add := func(x *Node) {
+		for k, existing := range m {
+			if existing.Address == x.Address {
+				delete(m, k)
+			}
+		}
 		m[x.Name] = x
 	}
+	for _, x := range a {
+		add(x)
+	}
 	for _, x := range b {
-		m[x.Name] = x
+		add(x)
 	}
 	result := make([]*Node, 0, len(m))
 	for _, v := range m {
@@ -158,6 +382,9 @@ func (c *ServiceContext) GetAPIServer() string {
 	if c.flags.ControlPlane.APIServerDNSName != "" {
 		return c.flags.ControlPlane.APIServerDNSName
 	}
+	if lbNodes := c.LoadBalancerNodes(); len(lbNodes) > 0 {
+		return lbNodes[0].Address
+	}
 	return c.nodes[0].Address
 }
 
@@ -178,110 +405,98 @@ func (c *ServiceContext) AllArchitectures() []string {
 	return result
 }
 
+// DaemonSetArchitecture is an architecture for which daemon sets are created.
+type DaemonSetArchitecture struct {
+	Name              string // Architecture as used by Kubernetes (in the beta.kubernetes.io/arch label)
+	ImageArchitecture string // Architecture of the images to use
+}
+
+// DaemonSetArchitectures returns the architectures of the Kubernetes nodes, for which daemon sets must be created.
+// Since Kubernetes reports armv6 nodes as arm, armv6 images are used for all arm nodes
+// when the cluster contains armv6 nodes.
+func (c *ServiceContext) DaemonSetArchitectures() []DaemonSetArchitecture {
+	m := make(map[string]string)
+	for _, x := range c.nodes {
+		if !x.IsKubernetesNode() {
+			continue
+		}
+		arch := x.Architecture
+		name := KubernetesArchitecture(arch)
+		if _, found := m[name]; !found || arch == "armv6" {
+			m[name] = arch
+		}
+	}
+	result := make([]DaemonSetArchitecture, 0, len(m))
+	for k, v := range m {
+		result = append(result, DaemonSetArchitecture{Name: k, ImageArchitecture: v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// KubernetesArchitecture returns the architecture name used by Kubernetes for the given architecture.
+func KubernetesArchitecture(arch string) string {
+	if arch == "armv6" {
+		return "arm"
+	}
+	return arch
+}
+
 // Run all prepare & Setup logic of the given services.
-func Run(deps ServiceDependencies, flags ServiceFlags, services []Service) error {
-	// Prepare local conf dir
-	confDir := flags.LocalConfDir
-	if err := os.MkdirAll(confDir, 0755); err != nil {
+// Unless disabled, all preflight checks must pass before anything is changed.
+func Run(ctx context.Context, deps ServiceDependencies, flags ServiceFlags, services []Service) error {
+	// Prepare context
+	sctx, err := NewServiceContext(deps.Logger, flags, true)
+	if err != nil {
 		return maskAny(err)
 	}
 
-	// Prepare context
-	nodes, err := flags.CreateNodes(deps.Logger, true)
+	// Dial machines
+	clients, err := dialMachines(ctx, deps, flags, sctx.nodes)
 	if err != nil {
 		return maskAny(err)
 	}
-	sctx := &ServiceContext{
-		flags: flags,
-		nodes: nodes,
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	// Run preflight checks
+	if !flags.Preflight.Skip {
+		if err := runPreflight(ctx, deps, flags, services, sctx, clients); err != nil {
+			return maskAny(err)
+		}
 	}
 
-	// Create ETCD CA
-	deps.EtcdCA, err = util.NewCA("ETCD CA", filepath.Join(confDir, "etcd-ca.crt"), filepath.Join(confDir, "etcd-ca.key"))
-	if err != nil {
+	// Prepare local conf dir
+	confDir := flags.LocalConfDir
+	if err := os.MkdirAll(confDir, 0755); err != nil {
 		return maskAny(err)
 	}
 
-	// Create Kubernetes CA
-	deps.KubernetesCA, err = util.NewCA("Kubernetes CA", filepath.Join(confDir, "kubernetes-ca.crt"), filepath.Join(confDir, "kubernetes-ca.key"))
-	if err != nil {
+	// Load (or create) certificates
+	if err := deps.LoadCertificates(confDir); err != nil {
 		return maskAny(err)
 	}
 
-	// Create service account certificate
-	deps.ServiceAccount.Cert, deps.ServiceAccount.Key, err = util.NewServiceAccountCertificate(filepath.Join(confDir, "kubernetes-sa.pub"), filepath.Join(confDir, "kubernetes-sa.key"))
-	if err != nil {
+	// Load (or create) encryption keys
+	if err := deps.LoadEncryptionKeys(confDir, flags.Encryption); err != nil {
 		return maskAny(err)
 	}
 
 	// Prepare all services
 	for _, s := range services {
 		deps.Logger.Info().Msgf("Preparing %s service", s.Name())
-		if err := s.Prepare(sctx, deps, flags, true); err != nil {
-			return maskAny(err)
+		if err := s.Prepare(ctx, sctx, deps, flags, true); err != nil {
+			return newServiceError(s, "prepare", nil, err)
 		}
 	}
 
-	// Dial machines
-	clients, err := dialMachines(deps.Logger, flags, sctx.nodes)
-	if err != nil {
-		return maskAny(err)
-	}
-	defer func() {
-		for _, c := range clients {
-			c.Close()
-		}
-	}()
-
 	// Setup all services on all machines
 	for _, s := range services {
-		if initer, ok := s.(ServiceIniter); ok {
-			if err := initer.Init(sctx, deps, flags); err != nil {
-				return maskAny(err)
-			}
-		}
-		if sNode, ok := s.(ServiceNodeInitializer); ok {
-			wg := sync.WaitGroup{}
-			errors := make(chan error, len(clients))
-			defer close(errors)
-			for i, client := range clients {
-				wg.Add(1)
-				go func(client util.SSHClient, node *Node) {
-					defer wg.Done()
-					if err := sNode.InitNode(node, client, sctx, deps, flags); err != nil {
-						errors <- maskAny(err)
-					}
-				}(client, nodes[i])
-			}
-			wg.Wait()
-			select {
-			case err := <-errors:
-				return maskAny(err)
-			default:
-				// Continue
-			}
-		}
-		if sMachine, ok := s.(ServiceMachines); ok {
-			wg := sync.WaitGroup{}
-			errors := make(chan error, len(clients))
-			defer close(errors)
-			for i, client := range clients {
-				wg.Add(1)
-				go func(client util.SSHClient, node Node) {
-					defer wg.Done()
-					deps.Logger.Info().Msgf("Setting up %s service on %s", s.Name(), node.Name)
-					if err := sMachine.InitMachine(node, client, sctx, deps, flags); err != nil {
-						errors <- maskAny(err)
-					}
-				}(client, *nodes[i])
-			}
-			wg.Wait()
-			select {
-			case err := <-errors:
-				return maskAny(err)
-			default:
-				// Continue
-			}
+		if err := initService(ctx, s, sctx, deps, flags, clients); err != nil {
+			return maskAny(err)
 		}
 	}
 
@@ -289,26 +504,23 @@ func Run(deps ServiceDependencies, flags ServiceFlags, services []Service) error
 }
 
 // Reset all prepare & Setup logic of the given services.
-func Reset(deps ServiceDependencies, flags ServiceFlags, services []Service) error {
+func Reset(ctx context.Context, deps ServiceDependencies, flags ServiceFlags, services []Service) error {
 	// Prepare context
-	nodes, err := flags.CreateNodes(deps.Logger, true)
+	sctx, err := NewServiceContext(deps.Logger, flags, false)
 	if err != nil {
 		return maskAny(err)
 	}
-	sctx := &ServiceContext{
-		nodes: nodes,
-	}
 
 	// Prepare all services
 	for _, s := range services {
 		deps.Logger.Info().Msgf("Preparing %s service", s.Name())
-		if err := s.Prepare(sctx, deps, flags, false); err != nil {
-			return maskAny(err)
+		if err := s.Prepare(ctx, sctx, deps, flags, false); err != nil {
+			return newServiceError(s, "prepare", nil, err)
 		}
 	}
 
 	// Dial machines
-	clients, err := dialMachines(deps.Logger, flags, sctx.nodes)
+	clients, err := dialMachines(ctx, deps, flags, sctx.nodes)
 	if err != nil {
 		return maskAny(err)
 	}
@@ -320,83 +532,146 @@ func Reset(deps ServiceDependencies, flags ServiceFlags, services []Service) err
 
 	// Reset all services on all machines
 	for _, s := range services {
-		if sNode, ok := s.(ServiceNodeInitializer); ok {
-			wg := sync.WaitGroup{}
-			errors := make(chan error, len(clients))
-			defer close(errors)
-			for i, client := range clients {
-				wg.Add(1)
-				go func(client util.SSHClient, node *Node) {
-					defer wg.Done()
-					if err := sNode.InitNode(node, client, sctx, deps, flags); err != nil {
-						errors <- maskAny(err)
-					}
-				}(client, nodes[i])
+		if err := resetService(ctx, s, sctx, deps, flags, clients); err != nil {
+			return maskAny(err)
+		}
+	}
+
+	return nil
+}
+
+// initService runs all setup logic of the given service (surrounded by hooks),
+// limited by the timeout configured for that service.
+func initService(ctx context.Context, s Service, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags, clients []util.SSHClient) error {
+	ctx, cancel := flags.Timeouts.withTimeout(ctx, s.Name())
+	defer cancel()
+	nodes := sctx.nodes
+	env := hookEnv{Phase: "init", Service: s.Name()}
+
+	if err := runHooks(ctx, deps.Logger, flags, flags.Hooks.BeforeService, env); err != nil {
+		return newServiceError(s, "before-service-hook", nil, err)
+	}
+	err := func() error {
+		if initer, ok := s.(ServiceIniter); ok {
+			if err := initer.Init(ctx, sctx, deps, flags); err != nil {
+				return newServiceError(s, "init", nil, err)
 			}
-			wg.Wait()
-			select {
-			case err := <-errors:
+		}
+		if sNode, ok := s.(ServiceNodeInitializer); ok {
+			if err := runParallel(allIndexes(nodes), flags.Rollout.Parallelism, func(i int) error {
+				return newServiceError(s, "init-node", nodes[i], sNode.InitNode(ctx, nodes[i], clients[i], sctx, deps, flags))
+			}); err != nil {
 				return maskAny(err)
-			default:
-				// Continue
 			}
 		}
 		if sMachine, ok := s.(ServiceMachines); ok {
-			wg := sync.WaitGroup{}
-			errors := make(chan error, len(clients))
-			defer close(errors)
-			for i, client := range clients {
-				wg.Add(1)
-				go func(client util.SSHClient, node Node) {
-					defer wg.Done()
-					deps.Logger.Info().Msgf("Resetting %s service on %s", s.Name(), node.Name)
-					if err := sMachine.ResetMachine(node, client, sctx, deps, flags); err != nil {
-						errors <- maskAny(err)
-					}
-				}(client, *nodes[i])
+			if err := runMachines(ctx, s, "init-machine", sctx, deps, flags, clients, env, func(node Node, client util.SSHClient) error {
+				deps.Logger.Info().Msgf("Setting up %s service on %s", s.Name(), node.Name)
+				return sMachine.InitMachine(ctx, node, client, sctx, deps, flags)
+			}); err != nil {
+				return maskAny(err)
 			}
-			wg.Wait()
-			select {
-			case err := <-errors:
+		}
+		return nil
+	}()
+	if err != nil {
+		runFailureHooks(ctx, deps.Logger, flags, sctx, clients, env, err)
+		return maskAny(err)
+	}
+	if err := runHooks(ctx, deps.Logger, flags, flags.Hooks.AfterService, env); err != nil {
+		return newServiceError(s, "after-service-hook", nil, err)
+	}
+	return nil
+}
+
+// resetService runs all reset logic of the given service (surrounded by hooks),
+// limited by the timeout configured for that service.
+func resetService(ctx context.Context, s Service, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags, clients []util.SSHClient) error {
+	ctx, cancel := flags.Timeouts.withTimeout(ctx, s.Name())
+	defer cancel()
+	nodes := sctx.nodes
+	env := hookEnv{Phase: "reset", Service: s.Name()}
+
+	if err := runHooks(ctx, deps.Logger, flags, flags.Hooks.BeforeService, env); err != nil {
+		return newServiceError(s, "before-service-hook", nil, err)
+	}
+	err := func() error {
+		if sNode, ok := s.(ServiceNodeInitializer); ok {
+			if err := runParallel(allIndexes(nodes), flags.Rollout.Parallelism, func(i int) error {
+				return newServiceError(s, "init-node", nodes[i], sNode.InitNode(ctx, nodes[i], clients[i], sctx, deps, flags))
+			}); err != nil {
 				return maskAny(err)
-			default:
-				// Continue
 			}
 		}
-		if reseter, ok := s.(ServiceReseter); ok {
-			if err := reseter.Reset(sctx, deps, flags); err != nil {
+		if sMachine, ok := s.(ServiceMachines); ok {
+			if err := runMachines(ctx, s, "reset-machine", sctx, deps, flags, clients, env, func(node Node, client util.SSHClient) error {
+				deps.Logger.Info().Msgf("Resetting %s service on %s", s.Name(), node.Name)
+				return sMachine.ResetMachine(ctx, node, client, sctx, deps, flags)
+			}); err != nil {
 				return maskAny(err)
 			}
 		}
+		if reseter, ok := s.(ServiceReseter); ok {
+			if err := reseter.Reset(ctx, sctx, deps, flags); err != nil {
+				return newServiceError(s, "reset", nil, err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		runFailureHooks(ctx, deps.Logger, flags, sctx, clients, env, err)
+		return maskAny(err)
+	}
+	if err := runHooks(ctx, deps.Logger, flags, flags.Hooks.AfterService, env); err != nil {
+		return newServiceError(s, "after-service-hook", nil, err)
 	}
-
 	return nil
 }
 
+// runMachines calls the given function for all nodes in rolling batches,
+// surrounded by the node hooks.
+func runMachines(ctx context.Context, s Service, step string, sctx *ServiceContext, deps ServiceDependencies, flags ServiceFlags, clients []util.SSHClient, env hookEnv, fn func(node Node, client util.SSHClient) error) error {
+	nodes := sctx.nodes
+	return flags.Rollout.runBatches(ctx, deps.Logger, nodes, isDisruptive(s), func(i int) error {
+		nodeEnv := env
+		nodeEnv.Node = nodes[i]
+		nodeEnv.Client = clients[i]
+		if err := runHooks(ctx, deps.Logger, flags, flags.Hooks.BeforeNode, nodeEnv); err != nil {
+			return newServiceError(s, "before-node-hook", nodes[i], err)
+		}
+		if err := fn(*nodes[i], clients[i]); err != nil {
+			return newServiceError(s, step, nodes[i], err)
+		}
+		if err := runHooks(ctx, deps.Logger, flags, flags.Hooks.AfterNode, nodeEnv); err != nil {
+			return newServiceError(s, "after-node-hook", nodes[i], err)
+		}
+		return nil
+	})
+}
+
 // dialMachines opens connections to all clients.
-func dialMachines(log zerolog.Logger, flags ServiceFlags, nodes []*Node) ([]util.SSHClient, error) {
+func dialMachines(ctx context.Context, deps ServiceDependencies, flags ServiceFlags, nodes []*Node) ([]util.SSHClient, error) {
+	dial := deps.DialSSH
+	if dial == nil {
+		dial = util.DialSSH
+	}
 	clients := make([]util.SSHClient, len(nodes))
-	wg := sync.WaitGroup{}
-	errors := make(chan error, len(nodes))
-	defer close(errors)
-	for i, n := range nodes {
-		wg.Add(1)
-		go func(i int, n *Node) {
-			defer wg.Done()
-			log.Info().Msgf("Dialing %s (%s)", n.Name, n.Address)
-			client, err := util.DialSSH(flags.SSH.User, n.Name, n.Address, flags.DryRun)
-			if err != nil {
-				errors <- maskAny(err)
-			} else {
-				clients[i] = client
+	if err := runParallel(allIndexes(nodes), 0, func(i int) error {
+		n := nodes[i]
+		deps.Logger.Info().Msgf("Dialing %s (%s)", n.Name, n.Address)
+		client, err := dial(ctx, flags.SSH.User, n.Name, n.Address, flags.DryRun)
+		if err != nil {
+			return maskAny(err)
+		}
+		clients[i] = client
+		return nil
+	}); err != nil {
+		for _, c := range clients {
+			if c != nil {
+				c.Close()
 			}
-		}(i, n)
-	}
-	wg.Wait()
-	select {
-	case err := <-errors:
+		}
 		return nil, maskAny(err)
-	default:
-		return clients, nil
 	}
+	return clients, nil
 }
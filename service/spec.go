@@ -0,0 +1,128 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// LoadSpec reads a cluster specification (JSON) from the file with given path
+// into the given flags.
+// Settings found in the specification overwrite the current values of the flags.
+// Field names are matched case-insensitive (e.g. "controlPlane", "scripts").
+// Durations are specified as strings (e.g. "30s").
+func (flags *ServiceFlags) LoadSpec(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return maskAny(err)
+	}
+	var spec interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&spec); err != nil {
+		return maskAny(errors.Wrapf(err, "Failed to parse cluster specification '%s'", path))
+	}
+	spec, err = parseSpecDurations(spec, reflect.TypeOf(*flags), "")
+	if err != nil {
+		return maskAny(errors.Wrapf(err, "Failed to parse cluster specification '%s'", path))
+	}
+	if raw, err = json.Marshal(spec); err != nil {
+		return maskAny(err)
+	}
+	if err := json.Unmarshal(raw, flags); err != nil {
+		return maskAny(errors.Wrapf(err, "Failed to parse cluster specification '%s'", path))
+	}
+	return nil
+}
+
+// parseSpecDurations replaces all duration strings (e.g. "30s") in the given decoded JSON value
+// that are stored in a time.Duration field of the given type, by the number of nanoseconds.
+func parseSpecDurations(v interface{}, t reflect.Type, path string) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		s, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, maskAny(fmt.Errorf("Invalid duration '%s' in '%s': %v", s, path, err))
+		}
+		return int64(d), nil
+	}
+	var err error
+	switch t.Kind() {
+	case reflect.Struct:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key, value := range obj {
+				if field, found := fieldByNameFold(t, key); found {
+					if obj[key], err = parseSpecDurations(value, field.Type, joinSpecPath(path, key)); err != nil {
+						return nil, maskAny(err)
+					}
+				}
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]interface{}); ok {
+			for key, value := range obj {
+				if obj[key], err = parseSpecDurations(value, t.Elem(), joinSpecPath(path, key)); err != nil {
+					return nil, maskAny(err)
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if list, ok := v.([]interface{}); ok {
+			for i, value := range list {
+				if list[i], err = parseSpecDurations(value, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return nil, maskAny(err)
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+// fieldByNameFold returns the exported field of the given struct type
+// that matches the given name case-insensitive (like encoding/json does).
+func fieldByNameFold(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" && strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// joinSpecPath returns the path of a field with given name in the object at given path.
+func joinSpecPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadSpecDurations(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		expected ServiceFlags
+		fails    bool
+	}{
+		{
+			name: "duration strings",
+			spec: `{"rollout": {"pauseBetweenBatches": "30s"}, "timeouts": {"default": "5m"}, "preflight": {"maxClockSkew": "1.5s"}}`,
+			expected: ServiceFlags{
+				Rollout:   Rollout{PauseBetweenBatches: 30 * time.Second},
+				Timeouts:  Timeouts{Default: 5 * time.Minute},
+				Preflight: Preflight{MaxClockSkew: 1500 * time.Millisecond},
+			},
+		},
+		{
+			name: "nanoseconds",
+			spec: `{"rollout": {"pauseBetweenBatches": 30000000000}}`,
+			expected: ServiceFlags{
+				Rollout: Rollout{PauseBetweenBatches: 30 * time.Second},
+			},
+		},
+		{
+			name: "case-insensitive field names",
+			spec: `{"ROLLOUT": {"PauseBetweenBatches": "1m"}}`,
+			expected: ServiceFlags{
+				Rollout: Rollout{PauseBetweenBatches: time.Minute},
+			},
+		},
+		{
+			name: "strings that are not durations",
+			spec: `{"members": ["10s"], "ssh": {"user": "5m"}}`,
+			expected: ServiceFlags{
+				Members: []string{"10s"},
+				SSH:     struct{ User string }{User: "5m"},
+			},
+		},
+		{
+			name:  "invalid duration",
+			spec:  `{"rollout": {"pauseBetweenBatches": "30x"}}`,
+			fails: true,
+		},
+		{
+			name:  "invalid JSON",
+			spec:  `{"rollout": `,
+			fails: true,
+		},
+	}
+	for _, test := range tests {
+		f, err := ioutil.TempFile("", "helix-spec")
+		if err != nil {
+			t.Fatalf("Failed to create temp file: %v", err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.WriteString(test.spec); err != nil {
+			t.Fatalf("Failed to write temp file: %v", err)
+		}
+		f.Close()
+
+		var flags ServiceFlags
+		err = flags.LoadSpec(f.Name())
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected error, got none", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if flags.Rollout != test.expected.Rollout {
+			t.Errorf("%s: expected rollout %+v, got %+v", test.name, test.expected.Rollout, flags.Rollout)
+		}
+		if flags.Timeouts.Default != test.expected.Timeouts.Default {
+			t.Errorf("%s: expected default timeout %s, got %s", test.name, test.expected.Timeouts.Default, flags.Timeouts.Default)
+		}
+		if flags.Preflight.MaxClockSkew != test.expected.Preflight.MaxClockSkew {
+			t.Errorf("%s: expected max clock skew %s, got %s", test.name, test.expected.Preflight.MaxClockSkew, flags.Preflight.MaxClockSkew)
+		}
+		if flags.SSH.User != test.expected.SSH.User || !reflect.DeepEqual(flags.Members, test.expected.Members) {
+			t.Errorf("%s: expected ssh user %q & members %v, got %q & %v", test.name, test.expected.SSH.User, test.expected.Members, flags.SSH.User, flags.Members)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Timeouts holds the maximum duration of the steps of a service.
+type Timeouts struct {
+	Default  time.Duration // Timeout of each step of a service (0 means no timeout)
+	Services []string      // List of <service-name>=<duration> overrides
+
+	perService map[string]time.Duration
+}
+
+// setupDefaults fills given flags with default value
+func (flags *Timeouts) setupDefaults(log zerolog.Logger) error {
+	if flags.Default < 0 {
+		return maskAny(fmt.Errorf("Default timeout cannot be negative"))
+	}
+	flags.perService = make(map[string]time.Duration)
+	for _, x := range flags.Services {
+		parts := strings.SplitN(x, "=", 2)
+		if len(parts) != 2 {
+			return maskAny(fmt.Errorf("Invalid service timeout '%s', expected <service-name>=<duration>", x))
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return maskAny(fmt.Errorf("Invalid duration in service timeout '%s': %v", x, err))
+		}
+		flags.perService[strings.TrimSpace(parts[0])] = d
+	}
+	return nil
+}
+
+// ForService returns the timeout for the steps of the service with given name.
+// Returns 0 if there is no timeout.
+func (flags Timeouts) ForService(name string) time.Duration {
+	if d, found := flags.perService[name]; found {
+		return d
+	}
+	return flags.Default
+}
+
+// withTimeout returns a context that is cancelled when the timeout
+// of the service with given name expires.
+func (flags Timeouts) withTimeout(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	if d := flags.ForService(name); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
@@ -15,25 +15,11 @@
 package main
 
 import (
-	"strings"
-
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/pulcy/helix/helix"
 	"github.com/pulcy/helix/service"
-	"github.com/pulcy/helix/service/architecture"
-	"github.com/pulcy/helix/service/etcd"
-	"github.com/pulcy/helix/service/kubernetes/apiserver"
-	"github.com/pulcy/helix/service/kubernetes/ca"
-	"github.com/pulcy/helix/service/kubernetes/cni"
-	"github.com/pulcy/helix/service/kubernetes/controllermanager"
-	"github.com/pulcy/helix/service/kubernetes/controlplane"
-	"github.com/pulcy/helix/service/kubernetes/coredns"
-	"github.com/pulcy/helix/service/kubernetes/flannel"
-	"github.com/pulcy/helix/service/kubernetes/hyperkube"
-	"github.com/pulcy/helix/service/kubernetes/keepalived"
-	"github.com/pulcy/helix/service/kubernetes/kubelet"
-	"github.com/pulcy/helix/service/kubernetes/proxy"
-	"github.com/pulcy/helix/service/kubernetes/scheduler"
 )
 
 var (
@@ -47,31 +33,7 @@ var (
 	}
 	initFlags  = service.ServiceFlags{}
 	resetFlags = service.ServiceFlags{}
-
-	// Create services to setup
-	boostrapServices = []service.Service{
-		// The order of entries is relevant!
-		architecture.NewService(),
-		cni.NewService(),
-		hyperkube.NewService(),
-		keepalived.NewService(),
-		ca.NewService(),
-		kubelet.NewService(),
-		etcd.NewService(),
-		apiserver.NewService(),
-		scheduler.NewService(),
-		controllermanager.NewService(),
-	}
-	k8sServices = []service.Service{
-		// The order of entries is relevant!
-		architecture.NewService(),
-		controlplane.NewService(),
-		proxy.NewService(),
-		flannel.NewService(),
-		coredns.NewService(),
-	}
-	//	services = k8sServices // append(bootstrapServices, k8sServices...)
-	services = append(boostrapServices, k8sServices...)
+	specPath   string
 )
 
 func init() {
@@ -79,22 +41,44 @@ func init() {
 	f := cmdInit.Flags()
 	// General
 	f.StringVarP(&initFlags.LocalConfDir, "conf-dir", "c", "", "Local directory containing cluster configuration")
+	f.StringVar(&specPath, "spec", "", "Path of cluster specification file (JSON)")
 	f.BoolVar(&initFlags.DryRun, "dry-run", false, "If set, no changes will be made")
 	f.StringSliceVarP(&initFlags.Members, "members", "m", nil, "IP addresses (or hostnames) of normal machines (may include control-plane members)")
 	f.StringVar(&initFlags.SSH.User, "ssh-user", "pi", "SSH user on all machines")
+	f.StringVar(&initFlags.ContainerRuntime.Name, "container-runtime", "", "Container runtime used on all machines (docker|containerd)")
+	// Rollout
+	f.IntVar(&initFlags.Rollout.Parallelism, "parallelism", 0, "Maximum number of nodes changed at the same time (0 means unlimited)")
+	f.IntVar(&initFlags.Rollout.BatchSize, "batch-size", 0, "Number of nodes per rolling batch (0 means all nodes at once)")
+	f.DurationVar(&initFlags.Rollout.PauseBetweenBatches, "pause-between-batches", 0, "Time to wait between rolling batches")
+	// Timeouts
+	f.DurationVar(&initFlags.Timeouts.Default, "timeout", 0, "Maximum duration of each service step (0 means no timeout)")
+	f.StringSliceVar(&initFlags.Timeouts.Services, "service-timeout", nil, "Maximum duration of the steps of a specific service (<service-name>=<duration>)")
+	// Preflight
+	f.BoolVar(&initFlags.Preflight.Skip, "skip-preflight", false, "If set, no preflight checks are run")
+	f.StringSliceVar(&initFlags.Preflight.IgnoreChecks, "ignore-preflight-checks", nil, "Names of preflight checks whose failures are ignored")
 	// Control plane
 	f.StringVar(&initFlags.ControlPlane.APIServerVirtualIP, "apiserver-virtual-ip", "", "Virtual IP address of apiserver")
 	f.StringVar(&initFlags.ControlPlane.APIServerDNSName, "apiserver-dns-name", "", "DNS name of apiserver")
 	f.StringSliceVar(&initFlags.ControlPlane.Members, "control-plane-members", nil, "IP addresses (or hostnames) of control-plane members")
+	f.BoolVar(&initFlags.ControlPlane.Schedulable, "control-plane-schedulable", false, "If set, control-plane nodes are not tainted, allowing normal workloads to run on them")
 	// Kubernetes
 	f.StringVar(&initFlags.Kubernetes.Metadata, "k8s-metadata", "", "Metadata list for kubelet")
 
 	// cmdReset
 	f = cmdReset.Flags()
 	// General
+	f.StringVar(&specPath, "spec", "", "Path of cluster specification file (JSON)")
 	f.BoolVar(&resetFlags.DryRun, "dry-run", false, "If set, no changes will be made")
 	f.StringSliceVar(&resetFlags.Members, "members", nil, "IP addresses (or hostnames) of normal machines (may include control-plane members)")
 	f.StringVar(&resetFlags.SSH.User, "ssh-user", "pi", "SSH user on all machines")
+	f.StringVar(&resetFlags.ContainerRuntime.Name, "container-runtime", "", "Container runtime used on all machines (docker|containerd)")
+	// Rollout
+	f.IntVar(&resetFlags.Rollout.Parallelism, "parallelism", 0, "Maximum number of nodes changed at the same time (0 means unlimited)")
+	f.IntVar(&resetFlags.Rollout.BatchSize, "batch-size", 0, "Number of nodes per rolling batch (0 means all nodes at once)")
+	f.DurationVar(&resetFlags.Rollout.PauseBetweenBatches, "pause-between-batches", 0, "Time to wait between rolling batches")
+	// Timeouts
+	f.DurationVar(&resetFlags.Timeouts.Default, "timeout", 0, "Maximum duration of each service step (0 means no timeout)")
+	f.StringSliceVar(&resetFlags.Timeouts.Services, "service-timeout", nil, "Maximum duration of the steps of a specific service (<service-name>=<duration>)")
 
 	cmdMain.AddCommand(cmdInit)
 	cmdMain.AddCommand(cmdReset)
@@ -102,46 +86,50 @@ func init() {
 
 func runInit(cmd *cobra.Command, args []string) {
 	showVersion(cmd, args)
+	loadSpec(cmd, &initFlags)
 
-	if err := initFlags.SetupDefaults(cliLog, true); err != nil {
-		Exitf("SetupDefaults failed: %#v\n", err)
-	}
-
-	assertArgIsSet(initFlags.LocalConfDir, "--conf-dir")
-	assertArgIsSet(strings.Join(initFlags.Members, ","), "--members")
-
-	deps := service.ServiceDependencies{
-		Logger: cliLog,
-	}
+	c := helix.New(initFlags, helix.WithLogger(cliLog))
 
 	// Go for it
-	if err := service.Run(deps, initFlags, services); err != nil {
-		Exitf("Setup failed: %#v\n", err)
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if err := c.Init(ctx); err != nil {
+		exitOnError("Setup failed", err)
 	}
 	cliLog.Info().Msg("Done")
 }
 
 func runReset(cmd *cobra.Command, args []string) {
 	showVersion(cmd, args)
+	loadSpec(cmd, &resetFlags)
 
-	if err := resetFlags.SetupDefaults(cliLog, false); err != nil {
-		Exitf("SetupDefaults failed: %#v\n", err)
-	}
-
-	assertArgIsSet(strings.Join(resetFlags.Members, ","), "--members")
+	c := helix.New(resetFlags, helix.WithLogger(cliLog))
 
-	deps := service.ServiceDependencies{
-		Logger: cliLog,
+	// Go for it
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if err := c.Reset(ctx); err != nil {
+		exitOnError("Reset failed", err)
 	}
+	cliLog.Info().Msg("Done")
+}
 
-	revServices := make([]service.Service, len(services))
-	for i, s := range services {
-		revServices[len(services)-(1+i)] = s
+// loadSpec loads the cluster specification (if any) into the given flags.
+// Flags that are explicitly set on the command line cannot be changed by the specification.
+func loadSpec(cmd *cobra.Command, flags *service.ServiceFlags) {
+	if specPath == "" {
+		return
 	}
-
-	// Go for it
-	if err := service.Reset(deps, resetFlags, revServices); err != nil {
-		Exitf("Reset failed: %#v\n", err)
+	explicit := make(map[string]string)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		explicit[f.Name] = f.Value.String()
+	})
+	if err := flags.LoadSpec(specPath); err != nil {
+		Exitf("Failed to load cluster specification: %v\n", err)
 	}
-	cliLog.Info().Msg("Done")
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if f.Value.String() != explicit[f.Name] {
+			Exitf("Option --%s conflicts with the cluster specification, set it in only one place\n", f.Name)
+		}
+	})
 }
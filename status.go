@@ -0,0 +1,67 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/pulcy/helix/helix"
+	"github.com/pulcy/helix/service"
+)
+
+var (
+	cmdStatus = &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of all nodes of the cluster",
+		Run:   runStatus,
+	}
+	statusFlags = service.ServiceFlags{}
+)
+
+func init() {
+	f := cmdStatus.Flags()
+	// General
+	f.StringVarP(&statusFlags.LocalConfDir, "conf-dir", "c", "", "Local directory containing cluster configuration")
+	f.StringVar(&specPath, "spec", "", "Path of cluster specification file (JSON)")
+	f.StringSliceVarP(&statusFlags.Members, "members", "m", nil, "IP addresses (or hostnames) of normal machines (may include control-plane members)")
+	// Control plane
+	f.StringVar(&statusFlags.ControlPlane.APIServerVirtualIP, "apiserver-virtual-ip", "", "Virtual IP address of apiserver")
+	f.StringVar(&statusFlags.ControlPlane.APIServerDNSName, "apiserver-dns-name", "", "DNS name of apiserver")
+	f.StringSliceVar(&statusFlags.ControlPlane.Members, "control-plane-members", nil, "IP addresses (or hostnames) of control-plane members")
+
+	cmdMain.AddCommand(cmdStatus)
+}
+
+func runStatus(cmd *cobra.Command, args []string) {
+	loadSpec(cmd, &statusFlags)
+	c := helix.New(statusFlags, helix.WithLogger(cliLog))
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	status, err := c.Status(ctx)
+	if err != nil {
+		exitOnError("Status failed", err)
+	}
+	cliLog.Info().Msgf("APIServer: %s", status.APIServer)
+	for _, n := range status.Nodes {
+		cliLog.Info().
+			Str("address", n.Address).
+			Strs("roles", n.Roles).
+			Bool("registered", n.Registered).
+			Bool("ready", n.Ready).
+			Str("kubelet", n.KubeletVersion).
+			Msg(n.Name)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	bootstrapTokenChars     = "abcdefghijklmnopqrstuvwxyz0123456789"
+	bootstrapTokenIDLen     = 6
+	bootstrapTokenSecretLen = 16
+)
+
+var (
+	bootstrapTokenPattern = regexp.MustCompile(`^([a-z0-9]{6})\.([a-z0-9]{16})$`)
+)
+
+// BootstrapToken is a token used by kubelets to request a client certificate.
+type BootstrapToken struct {
+	ID     string
+	Secret string
+}
+
+// String returns the token in the format used in kubeconfig files (<id>.<secret>).
+func (t BootstrapToken) String() string {
+	return t.ID + "." + t.Secret
+}
+
+// NewBootstrapToken tries to load a bootstrap token from given path, if not found, creates a new one.
+func NewBootstrapToken(tokenPath string) (BootstrapToken, error) {
+	// Try to load from local file
+	content, err := ioutil.ReadFile(tokenPath)
+	if err == nil {
+		m := bootstrapTokenPattern.FindStringSubmatch(strings.TrimSpace(string(content)))
+		if m == nil {
+			return BootstrapToken{}, maskAny(fmt.Errorf("Invalid bootstrap token in %s", tokenPath))
+		}
+		return BootstrapToken{ID: m[1], Secret: m[2]}, nil
+	} else if !os.IsNotExist(err) {
+		// Some other error
+		return BootstrapToken{}, maskAny(err)
+	}
+
+	// Create new token
+	id, err := randomTokenString(bootstrapTokenIDLen)
+	if err != nil {
+		return BootstrapToken{}, maskAny(err)
+	}
+	secret, err := randomTokenString(bootstrapTokenSecretLen)
+	if err != nil {
+		return BootstrapToken{}, maskAny(err)
+	}
+	token := BootstrapToken{ID: id, Secret: secret}
+
+	// Save file
+	if err := ioutil.WriteFile(tokenPath, []byte(token.String()), KeyFileMode); err != nil {
+		return BootstrapToken{}, maskAny(err)
+	}
+	return token, nil
+}
+
+// randomTokenString returns a random string of given length, consisting of characters valid in a bootstrap token.
+func randomTokenString(length int) (string, error) {
+	max := big.NewInt(int64(len(bootstrapTokenChars)))
+	result := make([]byte, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", maskAny(err)
+		}
+		result[i] = bootstrapTokenChars[n.Int64()]
+	}
+	return string(result), nil
+}
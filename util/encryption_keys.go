@@ -0,0 +1,100 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	encryptionKeyNamePrefix = "key"
+	encryptionKeySize       = 32
+)
+
+// EncryptionKey is a key used to encrypt resources at rest.
+type EncryptionKey struct {
+	Name     string // Name of the key
+	Provider string // Provider that uses the key (aescbc|secretbox)
+	Secret   string // Base64 encoded secret
+}
+
+// EncryptionKeys is an ordered list of encryption keys.
+// The first key is used to encrypt, all keys are used to decrypt.
+type EncryptionKeys []EncryptionKey
+
+// LoadEncryptionKeys tries to load encryption keys from given path.
+// If no such file exists, nil is returned.
+func LoadEncryptionKeys(keysPath string) (EncryptionKeys, error) {
+	content, err := ioutil.ReadFile(keysPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, maskAny(err)
+	}
+	var result EncryptionKeys
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 3 {
+			return nil, maskAny(fmt.Errorf("Invalid encryption key in %s, expected '<name> <provider> <secret>'", keysPath))
+		}
+		result = append(result, EncryptionKey{Name: parts[0], Provider: parts[1], Secret: parts[2]})
+	}
+	if len(result) == 0 {
+		return nil, maskAny(fmt.Errorf("No encryption keys in %s", keysPath))
+	}
+	return result, nil
+}
+
+// Save writes the keys to given path.
+func (keys EncryptionKeys) Save(keysPath string) error {
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%s %s %s", k.Name, k.Provider, k.Secret))
+	}
+	if err := ioutil.WriteFile(keysPath, []byte(strings.Join(lines, "\n")+"\n"), KeyFileMode); err != nil {
+		return maskAny(err)
+	}
+	return nil
+}
+
+// NewKey creates a new random key for the given provider,
+// with a name that differs from all existing keys.
+func (keys EncryptionKeys) NewKey(provider string) (EncryptionKey, error) {
+	secret := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return EncryptionKey{}, maskAny(err)
+	}
+	last := 0
+	for _, k := range keys {
+		if n, err := strconv.Atoi(strings.TrimPrefix(k.Name, encryptionKeyNamePrefix)); err == nil && n > last {
+			last = n
+		}
+	}
+	return EncryptionKey{
+		Name:     encryptionKeyNamePrefix + strconv.Itoa(last+1),
+		Provider: provider,
+		Secret:   base64.StdEncoding.EncodeToString(secret),
+	}, nil
+}
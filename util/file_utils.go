@@ -15,6 +15,7 @@
 package util
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,20 +23,27 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// EnsureDirectoryOf checks if the directory of the given file path exists and if not creates it.
+const (
+	// DirFileMode is the mode of directories created for files.
+	DirFileMode = os.FileMode(0755)
+)
+
+// EnsureDirectoryOf checks if the directory of the given file path exists and if not creates it
+// with given permissions.
 // If such a path does exist, it checks if it is a directory, if not an error is returned.
-func (s *sshClient) EnsureDirectoryOf(log zerolog.Logger, filePath string, perm os.FileMode) error {
+func (s *sshClient) EnsureDirectoryOf(ctx context.Context, log zerolog.Logger, filePath string, perm os.FileMode) error {
 	dirPath := filepath.Dir(filePath)
-	if err := s.EnsureDirectory(log, dirPath, perm); err != nil {
+	if err := s.EnsureDirectory(ctx, log, dirPath, perm); err != nil {
 		return maskAny(err)
 	}
 	return nil
 }
 
-// EnsureDirectory checks if a directory with given path exists and if not creates it.
+// EnsureDirectory checks if a directory with given path exists and if not creates it
+// with given permissions. The permissions of an existing directory are not changed.
 // If such a path does exist, it checks if it is a directory, if not an error is returned.
-func (s *sshClient) EnsureDirectory(log zerolog.Logger, dirPath string, perm os.FileMode) error {
-	if _, err := s.Run(log, fmt.Sprintf("sh -c \"sudo mkdir -p %s && sudo chmod 0%o %s\"", dirPath, perm, dirPath), "", true); err != nil {
+func (s *sshClient) EnsureDirectory(ctx context.Context, log zerolog.Logger, dirPath string, perm os.FileMode) error {
+	if _, err := s.Run(ctx, log, fmt.Sprintf("sudo sh -c \"[ -d %s ] || (mkdir -p %s && chmod 0%o %s)\"", dirPath, dirPath, perm, dirPath), "", true); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -43,8 +51,8 @@ func (s *sshClient) EnsureDirectory(log zerolog.Logger, dirPath string, perm os.
 
 // RemoveFile removes the given file.
 // If no such file exists, the request is ignored.
-func (s *sshClient) RemoveFile(log zerolog.Logger, filePath string) error {
-	if _, err := s.Run(log, fmt.Sprintf("sudo rm -f %s", filePath), "", true); err != nil {
+func (s *sshClient) RemoveFile(ctx context.Context, log zerolog.Logger, filePath string) error {
+	if _, err := s.Run(ctx, log, fmt.Sprintf("sudo rm -f %s", filePath), "", true); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -52,8 +60,8 @@ func (s *sshClient) RemoveFile(log zerolog.Logger, filePath string) error {
 
 // RemoveDirectory removes the given directory with its content.
 // If no such directory exists, the request is ignored.
-func (s *sshClient) RemoveDirectory(log zerolog.Logger, dirPath string) error {
-	if _, err := s.Run(log, fmt.Sprintf("sudo rm -rf %s", dirPath), "", true); err != nil {
+func (s *sshClient) RemoveDirectory(ctx context.Context, log zerolog.Logger, dirPath string) error {
+	if _, err := s.Run(ctx, log, fmt.Sprintf("sudo rm -rf %s", dirPath), "", true); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -61,15 +69,15 @@ func (s *sshClient) RemoveDirectory(log zerolog.Logger, dirPath string) error {
 
 // UpdateFile compares the given content with the context of the file at the given filePath and
 // if the content is different, the file is updated.
-// If the file does not exist, it is created.
-func (s *sshClient) UpdateFile(log zerolog.Logger, filePath string, content []byte, perm os.FileMode) error {
-	if err := s.EnsureDirectoryOf(log, filePath, perm); err != nil {
+// If the file does not exist, it is created (missing parent directories are created with DirFileMode).
+func (s *sshClient) UpdateFile(ctx context.Context, log zerolog.Logger, filePath string, content []byte, perm os.FileMode) error {
+	if err := s.EnsureDirectoryOf(ctx, log, filePath, DirFileMode); err != nil {
 		return maskAny(err)
 	}
-	if _, err := s.Run(log, fmt.Sprintf("sudo tee %s", filePath), string(content), true); err != nil {
+	if _, err := s.Run(ctx, log, fmt.Sprintf("sudo tee %s", filePath), string(content), true); err != nil {
 		return maskAny(err)
 	}
-	if _, err := s.Run(log, fmt.Sprintf("sudo chmod 0%o %s", perm, filePath), "", true); err != nil {
+	if _, err := s.Run(ctx, log, fmt.Sprintf("sudo chmod 0%o %s", perm, filePath), "", true); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -0,0 +1,51 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// NewPassword tries to load a password from given path, if not found, creates a new
+// random password of given length.
+func NewPassword(passwordPath string, length int) (string, error) {
+	// Try to load from local file
+	content, err := ioutil.ReadFile(passwordPath)
+	if err == nil {
+		password := strings.TrimSpace(string(content))
+		if password == "" {
+			return "", maskAny(fmt.Errorf("Empty password in %s", passwordPath))
+		}
+		return password, nil
+	} else if !os.IsNotExist(err) {
+		// Some other error
+		return "", maskAny(err)
+	}
+
+	// Create new password
+	password, err := randomTokenString(length)
+	if err != nil {
+		return "", maskAny(err)
+	}
+
+	// Save file
+	if err := ioutil.WriteFile(passwordPath, []byte(password), KeyFileMode); err != nil {
+		return "", maskAny(err)
+	}
+	return password, nil
+}
@@ -16,6 +16,7 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"math/rand"
 	"net"
@@ -33,28 +34,33 @@ type SSHClient interface {
 	io.Closer
 	GetAddress() string
 	GetHostName() string
-	Run(log zerolog.Logger, command, stdin string, quiet bool) (string, error)
+	Run(ctx context.Context, log zerolog.Logger, command, stdin string, quiet bool) (string, error)
 
-	// EnsureDirectoryOf checks if the directory of the given file path exists and if not creates it.
+	// EnsureDirectoryOf checks if the directory of the given file path exists and if not creates it
+	// with given permissions.
 	// If such a path does exist, it checks if it is a directory, if not an error is returned.
-	EnsureDirectoryOf(log zerolog.Logger, filePath string, perm os.FileMode) error
-	// EnsureDirectory checks if a directory with given path exists and if not creates it.
+	EnsureDirectoryOf(ctx context.Context, log zerolog.Logger, filePath string, perm os.FileMode) error
+	// EnsureDirectory checks if a directory with given path exists and if not creates it
+	// with given permissions. The permissions of an existing directory are not changed.
 	// If such a path does exist, it checks if it is a directory, if not an error is returned.
-	EnsureDirectory(log zerolog.Logger, dirPath string, perm os.FileMode) error
+	EnsureDirectory(ctx context.Context, log zerolog.Logger, dirPath string, perm os.FileMode) error
 	// UpdateFile compares the given content with the context of the file at the given filePath and
 	// if the content is different, the file is updated.
-	// If the file does not exist, it is created.
-	UpdateFile(log zerolog.Logger, filePath string, content []byte, perm os.FileMode) error
+	// If the file does not exist, it is created (missing parent directories are created with DirFileMode).
+	UpdateFile(ctx context.Context, log zerolog.Logger, filePath string, content []byte, perm os.FileMode) error
 	// RemoveFile removes the given file.
 	// If no such file exists, the request is ignored.
-	RemoveFile(log zerolog.Logger, filePath string) error
+	RemoveFile(ctx context.Context, log zerolog.Logger, filePath string) error
 	// RemoveDirectory removes the given directory with its content.
 	// If no such directory exists, the request is ignored.
-	RemoveDirectory(log zerolog.Logger, dirPath string) error
+	RemoveDirectory(ctx context.Context, log zerolog.Logger, dirPath string) error
 	// Render updates the given destinationPath according to the given template and options.
-	Render(log zerolog.Logger, templateData, destinationPath string, options interface{}, destinationFileMode os.FileMode, config ...TemplateConfigurator) error
+	Render(ctx context.Context, log zerolog.Logger, templateData, destinationPath string, options interface{}, destinationFileMode os.FileMode, config ...TemplateConfigurator) error
 }
 
+// SSHDialer is a function that opens an SSH connection to a machine.
+type SSHDialer func(ctx context.Context, userName, hostName, address string, dryRun bool) (SSHClient, error)
+
 type sshClient struct {
 	client   *ssh.Client
 	hostName string
@@ -63,7 +69,8 @@ type sshClient struct {
 }
 
 // DialSSH creates a new SSH connection to the given user on the given host.
-func DialSSH(userName, hostName, address string, dryRun bool) (SSHClient, error) {
+// The given context is used to abort the dialing process.
+func DialSSH(ctx context.Context, userName, hostName, address string, dryRun bool) (SSHClient, error) {
 	// To authenticate with the remote server you must pass at least one
 	// implementation of AuthMethod via the Auth field in ClientConfig.
 	config := &ssh.ClientConfig{
@@ -82,12 +89,18 @@ func DialSSH(userName, hostName, address string, dryRun bool) (SSHClient, error)
 		}
 
 		addr := net.JoinHostPort(address, "22")
-		client, err := ssh.Dial("tcp", addr, config)
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return maskAny(err)
+		}
+		c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 		if err != nil {
+			conn.Close()
 			return maskAny(err)
 		}
 		result = &sshClient{
-			client:   client,
+			client:   ssh.NewClient(c, chans, reqs),
 			hostName: hostName,
 			address:  address,
 			dryRun:   dryRun,
@@ -101,7 +114,12 @@ func DialSSH(userName, hostName, address string, dryRun bool) (SSHClient, error)
 		if lastErr == nil {
 			return result, nil
 		}
-		time.Sleep(time.Millisecond * time.Duration(rand.Intn(100)))
+		select {
+		case <-time.After(time.Millisecond * time.Duration(rand.Intn(100))):
+			// Retry
+		case <-ctx.Done():
+			return nil, maskAny(ctx.Err())
+		}
 	}
 	return nil, maskAny(lastErr)
 }
@@ -118,7 +136,9 @@ func (s *sshClient) Close() error {
 	return maskAny(s.client.Close())
 }
 
-func (s *sshClient) Run(log zerolog.Logger, command, stdin string, quiet bool) (string, error) {
+// Run executes the given command on the remote machine.
+// When the given context is cancelled, the remote command is killed.
+func (s *sshClient) Run(ctx context.Context, log zerolog.Logger, command, stdin string, quiet bool) (string, error) {
 	if s.dryRun {
 		log.Info().Msgf("Will run: %s", command)
 		return "", nil
@@ -141,14 +161,39 @@ func (s *sshClient) Run(log zerolog.Logger, command, stdin string, quiet bool) (
 		session.Stdin = strings.NewReader(stdin)
 	}
 
-	if err := session.Run(command); err != nil {
+	if err := session.Start(command); err != nil {
+		return "", maskAny(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if !quiet {
+				log.Error().Msgf("SSH failed: %s", command)
+			}
+			return "", errors.Wrap(err, stdErr.String())
+		}
+	case <-ctx.Done():
+		// Abort the remote command
+		session.Signal(ssh.SIGKILL)
+		session.Close()
 		if !quiet {
-			log.Error().Msgf("SSH failed: %s", command)
+			log.Warn().Msgf("SSH cancelled: %s", command)
 		}
-		return "", errors.Wrapf(err, stdErr.String())
+		return "", maskAny(ctx.Err())
 	}
 
 	out := stdOut.String()
 	out = strings.TrimSuffix(out, "\n")
 	return out, nil
 }
+
+// ShellQuote quotes the given string such that a POSIX shell
+// passes it as a single argument.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
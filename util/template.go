@@ -16,6 +16,8 @@ package util
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"html/template"
 	"os"
 	"strconv"
@@ -33,6 +35,7 @@ func RenderToString(log zerolog.Logger, templateData string, options interface{}
 	funcMap := template.FuncMap{
 		"escape": escape,
 		"quote":  strconv.Quote,
+		"json":   toJSON,
 	}
 	tmpl.Funcs(funcMap)
 	for _, c := range config {
@@ -52,14 +55,14 @@ func RenderToString(log zerolog.Logger, templateData string, options interface{}
 }
 
 // Render updates the given destinationPath according to the given template and options.
-func (s *sshClient) Render(log zerolog.Logger, templateData, destinationPath string, options interface{}, destinationFileMode os.FileMode, config ...TemplateConfigurator) error {
+func (s *sshClient) Render(ctx context.Context, log zerolog.Logger, templateData, destinationPath string, options interface{}, destinationFileMode os.FileMode, config ...TemplateConfigurator) error {
 	content, err := RenderToString(log, templateData, options, config...)
 	if err != nil {
 		return maskAny(err)
 	}
 
 	// Update file
-	if err := s.UpdateFile(log, destinationPath, []byte(content), destinationFileMode); err != nil {
+	if err := s.UpdateFile(ctx, log, destinationPath, []byte(content), destinationFileMode); err != nil {
 		return maskAny(err)
 	}
 	return nil
@@ -69,3 +72,16 @@ func escape(s string) string {
 	s = strconv.Quote(s)
 	return s[1 : len(s)-1]
 }
+
+// toJSON encodes the given value as JSON, without HTML escaping.
+// The result is also a valid YAML (flow) value, which makes it usable
+// for user provided strings in YAML files.
+func toJSON(v interface{}) (template.HTML, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", maskAny(err)
+	}
+	return template.HTML(bytes.TrimSpace(buf.Bytes())), nil
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2018 Pulcy.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares 2 dotted version numbers (e.g. 17.03.2-ce or v1.10.0).
+// Returns -1 if a < b, 1 if a > b, 0 otherwise.
+func CompareVersions(a, b string) int {
+	parse := func(v string) []int {
+		var result []int
+		for _, p := range strings.Split(strings.TrimPrefix(v, "v"), ".") {
+			end := 0
+			for end < len(p) && p[end] >= '0' && p[end] <= '9' {
+				end++
+			}
+			x, _ := strconv.Atoi(p[:end])
+			result = append(result, x)
+			if end < len(p) {
+				// Suffix like -ce, stop here
+				break
+			}
+		}
+		return result
+	}
+	pa, pb := parse(a), parse(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var xa, xb int
+		if i < len(pa) {
+			xa = pa[i]
+		}
+		if i < len(pb) {
+			xb = pb[i]
+		}
+		if xa < xb {
+			return -1
+		} else if xa > xb {
+			return 1
+		}
+	}
+	return 0
+}